@@ -7,6 +7,9 @@ echo "This will watch for changes and restart the server automatically."
 echo "Press Ctrl+C to stop."
 echo ""
 
+# Stamp the build with its commit and time, shown at /version
+BUILDINFO=github.com/AlexM141200/munros-api/src/buildinfo
+
 # Function to build and run the server
 build_and_run() {
     echo "Building application..."
@@ -19,7 +22,8 @@ build_and_run() {
     fi
 
     # Build the application
-    go build -o bin/munros-api ./src/cmd/main.go
+    LDFLAGS="-X $BUILDINFO.Commit=$(git rev-parse HEAD 2>/dev/null) -X $BUILDINFO.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+    go build -ldflags "$LDFLAGS" -o bin/munros-api ./src/cmd/main.go
     if [ $? -ne 0 ]; then
         echo "Build failed"
         return 1
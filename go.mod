@@ -5,9 +5,26 @@ go 1.23.0
 toolchain go1.24.2
 
 require (
-	github.com/a-h/templ v0.3.906 // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
-	github.com/yuin/goldmark v1.4.13 // indirect
+	github.com/a-h/templ v0.3.906
+	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/prometheus/client_golang v1.22.0
+	github.com/yuin/goldmark v1.4.13
+	golang.org/x/crypto v0.36.0
+	golang.org/x/image v0.25.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.62.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
 	golang.org/x/mod v0.26.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
 	golang.org/x/tools v0.35.0 // indirect
+	google.golang.org/protobuf v1.36.5 // indirect
 )
@@ -2,9 +2,13 @@
 
 # Build and run the Munros API server
 
+# Stamp the build with its commit and time, shown at /version
+BUILDINFO=github.com/AlexM141200/munros-api/src/buildinfo
+LDFLAGS="-X $BUILDINFO.Commit=$(git rev-parse HEAD 2>/dev/null) -X $BUILDINFO.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+
 # Build the application
 echo "Building the application..."
-go build -o bin/munros-api ./src/cmd/main.go
+go build -ldflags "$LDFLAGS" -o bin/munros-api ./src/cmd/main.go
 
 # Check if build was successful
 if [ $? -eq 0 ]; then
@@ -14,7 +18,7 @@ if [ $? -eq 0 ]; then
     echo ""
 
     # Run the server
-    ./bin/munros-api
+    ./bin/munros-api "$@"
 else
     echo "Build failed. Please check for errors."
     exit 1
@@ -0,0 +1,106 @@
+package achievements
+
+import (
+	"sort"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Earned is an achievement a user qualifies for. Group is the section or
+// sheet for grouped rules and empty otherwise.
+type Earned struct {
+	AchievementID string
+	Group         string
+	AwardedAt     time.Time
+}
+
+// Evaluate returns every achievement the ascents qualify for, dated by the
+// ascent that completed each one
+func Evaluate(rules []Rule, munros []model.Munro, ascents []model.Ascent) []Earned {
+	var earned []Earned
+	for _, rule := range rules {
+		earned = append(earned, rule.evaluate(munros, ascents)...)
+	}
+	return earned
+}
+
+func (r Rule) evaluate(munros []model.Munro, ascents []model.Ascent) []Earned {
+	hills := map[int]model.Munro{}
+	groupSizes := map[string]int{}
+	for _, m := range munros {
+		if !r.Filter.matchesHill(m) {
+			continue
+		}
+		hills[m.DoBIHNumber] = m
+		for _, g := range r.groups(m) {
+			groupSizes[g]++
+		}
+	}
+
+	// Earliest qualifying ascent of each hill, and every qualifying ascent
+	// for same-day rules
+	first := map[int]time.Time{}
+	var qualifying []model.Ascent
+	for _, a := range ascents {
+		if _, ok := hills[a.MunroID]; !ok || !r.Filter.matchesAscent(a) {
+			continue
+		}
+		qualifying = append(qualifying, a)
+		if t, ok := first[a.MunroID]; !ok || a.ClimbedAt.Before(t) {
+			first[a.MunroID] = a.ClimbedAt
+		}
+	}
+
+	var earned []Earned
+	award := func(group string, at time.Time) {
+		earned = append(earned, Earned{AchievementID: r.ID, Group: group, AwardedAt: at})
+	}
+
+	switch r.Type {
+	case TypeCount, TypeComplete:
+		byGroup := map[string][]time.Time{}
+		for id, t := range first {
+			for _, g := range r.groups(hills[id]) {
+				byGroup[g] = append(byGroup[g], t)
+			}
+		}
+
+		for group, times := range byGroup {
+			sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+			needed := r.Count
+			if r.Type == TypeComplete {
+				needed = groupSizes[group]
+			}
+			if needed > 0 && len(times) >= needed {
+				award(group, times[needed-1])
+			}
+		}
+
+	case TypeSameDay:
+		sort.Slice(qualifying, func(i, j int) bool { return qualifying[i].ClimbedAt.Before(qualifying[j].ClimbedAt) })
+
+		type dayKey struct{ group, day string }
+		days := map[dayKey]map[int]bool{}
+		done := map[string]bool{}
+		for _, a := range qualifying {
+			for _, g := range r.groups(hills[a.MunroID]) {
+				if done[g] {
+					continue
+				}
+				key := dayKey{g, a.ClimbedAt.UTC().Format(time.DateOnly)}
+				if days[key] == nil {
+					days[key] = map[int]bool{}
+				}
+				days[key][a.MunroID] = true
+				if len(days[key]) >= r.Count {
+					award(g, a.ClimbedAt)
+					done[g] = true
+				}
+			}
+		}
+	}
+
+	return earned
+}
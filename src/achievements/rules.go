@@ -0,0 +1,156 @@
+package achievements
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Rule types
+const (
+	// Climb at least Count distinct hills matching the filter
+	TypeCount = "count"
+	// Climb every hill matching the filter. With GroupBy set, the rule is
+	// awarded separately for each group completed.
+	TypeComplete = "complete"
+	// Climb at least Count distinct hills matching the filter on one day
+	TypeSameDay = "same_day"
+)
+
+// Fields rules can group hills by
+const (
+	GroupBySection = "smc_section"
+	GroupBySheet   = "map_1_50k"
+)
+
+// Filter restricts which ascents count towards a rule. Zero values match
+// everything.
+type Filter struct {
+	Classification string   `json:"classification,omitempty"`
+	MinHeight      float64  `json:"min_height,omitempty"`
+	MaxHeight      float64  `json:"max_height,omitempty"`
+	Sections       []string `json:"sections,omitempty"`
+	Months         []int    `json:"months,omitempty"` // months the ascent was made in, 1-12
+}
+
+// Rule defines an achievement
+type Rule struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Filter      Filter `json:"filter"`
+	Count       int    `json:"count,omitempty"`
+	GroupBy     string `json:"group_by,omitempty"`
+}
+
+// LoadRules reads achievement rules from a JSON file
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read achievements file: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse achievements file: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("achievement %q: %w", rule.ID, err)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("achievement %q is defined twice", rule.ID)
+		}
+		seen[rule.ID] = true
+	}
+
+	return rules, nil
+}
+
+func (r Rule) validate() error {
+	if r.ID == "" || r.Name == "" {
+		return fmt.Errorf("id and name are required")
+	}
+
+	switch r.Type {
+	case TypeCount, TypeSameDay:
+		if r.Count < 1 {
+			return fmt.Errorf("count must be at least 1")
+		}
+	case TypeComplete:
+	default:
+		return fmt.Errorf("unknown type %q", r.Type)
+	}
+
+	switch r.GroupBy {
+	case "", GroupBySection, GroupBySheet:
+	default:
+		return fmt.Errorf("unknown group_by %q", r.GroupBy)
+	}
+
+	for _, month := range r.Filter.Months {
+		if month < 1 || month > 12 {
+			return fmt.Errorf("invalid month %d", month)
+		}
+	}
+
+	return nil
+}
+
+// matchesHill reports whether a hill passes the filter's hill criteria
+func (f Filter) matchesHill(m model.Munro) bool {
+	if f.Classification != "" && !strings.EqualFold(f.Classification, m.Classification) {
+		return false
+	}
+	if f.MinHeight > 0 && m.HeightM < f.MinHeight {
+		return false
+	}
+	if f.MaxHeight > 0 && m.HeightM > f.MaxHeight {
+		return false
+	}
+	if len(f.Sections) > 0 && !contains(f.Sections, m.SMCSection) {
+		return false
+	}
+	return true
+}
+
+// matchesAscent reports whether an ascent passes the filter's date criteria
+func (f Filter) matchesAscent(a model.Ascent) bool {
+	if len(f.Months) == 0 {
+		return true
+	}
+	month := int(a.ClimbedAt.Month())
+	for _, m := range f.Months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+// groups returns the groups a hill belongs to under group_by. A hill can sit
+// on several 1:50k sheets.
+func (r Rule) groups(m model.Munro) []string {
+	switch r.GroupBy {
+	case GroupBySection:
+		return []string{m.SMCSection}
+	case GroupBySheet:
+		return strings.Fields(m.Map1to50k)
+	}
+	return []string{""}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
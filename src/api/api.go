@@ -1,75 +1,227 @@
 package api
 
 import (
-	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"path/filepath"
+	"time"
 
 	"context"
 
-	_ "github.com/mattn/go-sqlite3"
-
+	"github.com/AlexM141200/munros-api/src/achievements"
+	"github.com/AlexM141200/munros-api/src/blob"
+	"github.com/AlexM141200/munros-api/src/config"
+	"github.com/AlexM141200/munros-api/src/csv"
+	"github.com/AlexM141200/munros-api/src/dataset"
 	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/logging"
+	"github.com/AlexM141200/munros-api/src/mail"
+	"github.com/AlexM141200/munros-api/src/metrics"
+	"github.com/AlexM141200/munros-api/src/middleware"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/notify"
+	"github.com/AlexM141200/munros-api/src/oidc"
+	"github.com/AlexM141200/munros-api/src/routes"
+	"github.com/AlexM141200/munros-api/src/store"
+	"github.com/AlexM141200/munros-api/src/webhooks"
 )
 
 type APIServer struct {
-	addr string
-}
+	cfg *config.Config
 
-type Application struct {
-	DB *sql.DB
+	workers []worker
 }
 
-func NewAPIServer(addr string) *APIServer {
+func NewAPIServer(cfg *config.Config) *APIServer {
 	return &APIServer{
-		addr: addr,
+		cfg: cfg,
 	}
 }
 
-// Run Function of API Server
+// Run Function of API Server. It serves until ctx is cancelled and then
+// shuts down gracefully.
 func (s *APIServer) Run(ctx context.Context) error {
 
+	//Logs, as configured. Anything still using the log package goes
+	//through the same handler.
+	logger, closeLog, err := logging.New(logging.Options{
+		Level:      s.cfg.Log.Level,
+		Format:     s.cfg.Log.Format,
+		File:       s.cfg.Log.File,
+		MaxSizeMB:  s.cfg.Log.MaxSizeMB,
+		MaxBackups: s.cfg.Log.MaxBackups,
+		MaxAgeDays: s.cfg.Log.MaxAgeDays,
+	})
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	slog.SetDefault(logger)
+
 	//Data directory
-	/*
-	  dataDir := "./data"
-	  dbFilename := "munro.db"
-	*/
+	dataDir := s.cfg.Paths.DataDir
 
 	//Open sqlite database.
-	/*
-	  db, err := sql.Open()
-	  if err != nil {
-	  panic(err)
-	  }
+	db, err := store.Open(s.cfg.Paths.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
 
-	*/
+	//Admins named in the configuration
+	if err := promoteAdmins(db, s.cfg.Admins); err != nil {
+		return err
+	}
 
-	app := &Application{
-		DB: nil,
+	//Achievement rules
+	rules, err := achievements.LoadRules(filepath.Join(dataDir, "achievements.json"))
+	if err != nil {
+		return err
 	}
 
-	router := http.NewServeMux()
+	//External sign-in providers
+	providerConfigs, err := oidc.LoadProviders(filepath.Join(dataDir, "oidc_providers.json"))
+	if err != nil {
+		return err
+	}
+	var providers []*oidc.Provider
+	for _, cfg := range providerConfigs {
+		providers = append(providers, oidc.NewProvider(cfg, nil))
+	}
+
+	//Photo files
+	photos, err := blob.NewDir(filepath.Join(dataDir, "photos"))
+	if err != nil {
+		return err
+	}
 
-	// API Routes
-	handlers.SetupMunroRoutes(router)
+	//Outgoing webhooks, delivered in the background
+	dispatcher := webhooks.NewDispatcher(db)
+	s.Go("webhooks", dispatcher.Run)
 
-	// Frontend Routes
-	handlers.SetupFrontendRoutes(router)
+	//Hill catalogue, reloaded when the file changes
+	datasetPath := s.cfg.Paths.Dataset
+	ds := dataset.New(csv.NewCSVService(datasetPath))
+	if _, err := ds.Reload(); err != nil {
+		return err
+	}
 
-	fs := http.FileServer(http.Dir("./munromark/build/client/"))
+	//Outgoing email, with digests and trip alerts sent on a schedule
+	notifier := notify.New(db, newMailer(s.cfg.Mail, dataDir), ds, s.cfg.SiteURL)
+	s.Go("notifier", notifier.Run)
+
+	h := routes.New(routes.Deps{
+		Dataset:      ds,
+		Store:        db,
+		Photos:       photos,
+		Webhooks:     dispatcher,
+		Notifier:     notifier,
+		Achievements: rules,
+		Providers:    providers,
+		CacheControl: s.cfg.CacheControl,
+		SiteURL:      s.cfg.SiteURL,
+		Logger:       logger,
+	})
+	s.Go("dataset", func(ctx context.Context) {
+		ds.Watch(ctx, datasetPath, 30*time.Second, h.PublishDatasetDiff)
+	})
+
+	//API key usage is counted in memory and written out periodically
+	s.Go("api-usage", func(ctx context.Context) {
+		h.FlushAPIUsage(ctx, 30*time.Second)
+	})
+
+	// API and frontend routes
+	router := handlers.NewRouter(h)
+
+	fs := http.FileServer(http.Dir(s.cfg.Paths.Assets))
 	router.Handle("/assets/", http.StripPrefix("/assets/", fs))
 
 	// Serve static files from public directory
-	publicFS := http.FileServer(http.Dir("./public/"))
+	publicFS := http.FileServer(http.Dir(s.cfg.Paths.Public))
 	router.Handle("/public/", http.StripPrefix("/public/", publicFS))
 
-	_ = app
+	// Vendored HTMX used by the templates
+	htmxFS := http.FileServer(http.Dir(s.cfg.Paths.HTMX))
+	router.Handle("/htmx/", http.StripPrefix("/htmx/", htmxFS))
+
+	//Prometheus metrics, counted for every request
+	m := metrics.New()
+	m.WatchDataset(ds)
+	if s.cfg.Metrics.Enabled {
+		router.Handle("GET "+s.cfg.Metrics.Path, m.Handler(string(s.cfg.Metrics.Token)))
+	}
+
+	// Validated with the rest of the configuration
+	proxies, err := middleware.ParseProxies(s.cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	// Applied to every request, outermost first
+	stack := []middleware.Middleware{
+		middleware.RequestID,
+		middleware.Proxies(proxies),
+		middleware.Logger(logger),
+		middleware.Instrument(m),
+		middleware.AccessLog,
+		middleware.Recover,
+		middleware.CORS(middleware.CORSOptions{
+			AllowedOrigins:   s.cfg.CORS.AllowedOrigins,
+			AllowCredentials: s.cfg.CORS.AllowCredentials,
+			MaxAge:           s.cfg.CORS.MaxAge,
+		}),
+	}
+	if s.cfg.Compression {
+		stack = append(stack, middleware.Compress)
+	}
+
+	server := &http.Server{
+		Addr:              s.cfg.Addr,
+		Handler:           middleware.Chain(router, stack...),
+		ReadHeaderTimeout: s.cfg.Timeouts.ReadHeader,
+		ReadTimeout:       s.cfg.Timeouts.Read,
+		WriteTimeout:      s.cfg.Timeouts.Write,
+		IdleTimeout:       s.cfg.Timeouts.Idle,
+	}
+
+	return s.serve(ctx, server, h)
+}
+
+// Give the admin role to the registered users with the given email
+// addresses
+func promoteAdmins(db *store.Store, emails []string) error {
+	for _, email := range emails {
+		user, err := db.GetUserByEmail(email)
+		if errors.Is(err, store.ErrNotFound) {
+			slog.Warn("Admin has not registered yet", "email", email)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := db.SetUserRole(user.ID, model.RoleAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	server := http.Server{
-		Addr:    s.addr,
-		Handler: router,
+// Send through the configured SMTP server, or write messages to data/mail
+// when there isn't one
+func newMailer(cfg config.Mail, dataDir string) mail.Mailer {
+	if cfg.SMTPAddr != "" {
+		return &mail.SMTP{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: string(cfg.SMTPPassword),
+			From:     cfg.From,
+		}
 	}
 
-	log.Printf("Server running on port %s", s.addr)
-	return server.ListenAndServe()
+	dir := filepath.Join(dataDir, "mail")
+	slog.Info("No SMTP server configured; writing emails to a directory", "dir", dir)
+	return &mail.Dir{Path: dir, From: cfg.From}
 }
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/routes"
+)
+
+// A background task that runs for the life of the server
+type worker struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// Go registers a background worker. Workers are started once the server is
+// set up and their context is cancelled after in-flight requests have
+// drained, so anything those requests queued is still handled. run must
+// return promptly once its context is done.
+func (s *APIServer) Go(name string, run func(ctx context.Context)) {
+	s.workers = append(s.workers, worker{name: name, run: run})
+}
+
+// Start the registered workers, returning a function that stops them and
+// waits for them to return until ctx is done
+func (s *APIServer) startWorkers() func(ctx context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	running := make(map[string]bool)
+	var mu sync.Mutex
+
+	for _, w := range s.workers {
+		wg.Add(1)
+		mu.Lock()
+		running[w.name] = true
+		mu.Unlock()
+
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+			mu.Lock()
+			delete(running, w.name)
+			mu.Unlock()
+		}()
+	}
+
+	return func(deadline context.Context) {
+		cancel()
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-deadline.Done():
+			mu.Lock()
+			for name := range running {
+				slog.Warn("Worker did not stop in time", "worker", name)
+			}
+			mu.Unlock()
+		}
+	}
+}
+
+// Serve until ctx is cancelled, then stop accepting connections, let
+// in-flight requests finish, wait for their emails and stop the workers.
+// Each stage has the whole shutdown timeout, so requests that take it all
+// don't leave the workers no time to flush what they hold.
+func (s *APIServer) serve(ctx context.Context, server *http.Server, h *routes.Handlers) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
+	stopWorkers := s.startWorkers()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve(listener)
+	}()
+	slog.Info("Server running", "addr", s.cfg.Addr)
+
+	select {
+	case err := <-errc:
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeouts.Shutdown)
+		defer cancel()
+		stopWorkers(ctx)
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down; waiting for requests to finish", "timeout", s.cfg.Timeouts.Shutdown)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeouts.Shutdown)
+	defer cancel()
+
+	start := time.Now()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Requests still running; closing connections", "timeout", s.cfg.Timeouts.Shutdown, "err", err)
+		server.Close()
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Error from server", "err", err)
+	}
+
+	// Emails sent on behalf of finished requests
+	backgroundCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeouts.Shutdown)
+	defer cancel()
+	if err := h.WaitForBackground(backgroundCtx); err != nil {
+		slog.Warn("Background sends did not finish in time", "err", err)
+	}
+
+	workersCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeouts.Shutdown)
+	defer cancel()
+	stopWorkers(workersCtx)
+	slog.Info("Shut down", "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,59 @@
+// Package buildinfo says which build of the server is running
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set when building, e.g.
+//
+//	go build -ldflags "-X github.com/AlexM141200/munros-api/src/buildinfo.Commit=$(git rev-parse HEAD)
+//	  -X github.com/AlexM141200/munros-api/src/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Otherwise they're taken from the version control details Go stamps into
+// binaries built from a checkout, where there are any.
+var (
+	Commit    string
+	BuildTime string
+)
+
+// Info describes the running build
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	// Modified is set when the checkout had uncommitted changes
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build's details. Those that aren't known are
+// "unknown".
+func Get() Info {
+	info := Info{Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
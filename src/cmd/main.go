@@ -2,15 +2,45 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/AlexM141200/munros-api/src/api"
+	"github.com/AlexM141200/munros-api/src/config"
 )
 
 func main() {
 
-	ctx := context.Background()
-	server := api.NewAPIServer(":8080")
+	cfg, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.Print {
+		fmt.Print(cfg)
+		return
+	}
 
-	server.Run(ctx)
+	// Stop gracefully on Ctrl-C or a deploy's SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal stops immediately
+		<-ctx.Done()
+		stop()
+	}()
+
+	server := api.NewAPIServer(cfg)
+
+	if err := server.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
 
 }
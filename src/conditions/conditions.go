@@ -0,0 +1,108 @@
+// Package conditions ages condition reports and combines them into a
+// summary of what a hill is like now
+package conditions
+
+import (
+	"math"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+const (
+	// HalfLife is how long it takes a report to lose half its weight
+	HalfLife = 7 * 24 * time.Hour
+	// MaxAge is how long a report counts for at all
+	MaxAge = 30 * 24 * time.Hour
+)
+
+// Cutoff is the earliest observation date still in effect at now
+func Cutoff(now time.Time) string {
+	return now.Add(-MaxAge).Format(time.DateOnly)
+}
+
+// Weight is how much a report observed on the given date (YYYY-MM-DD)
+// counts at now: 1 on the day, halving every HalfLife, and 0 once expired
+func Weight(observedOn string, now time.Time) float64 {
+	observed, err := time.Parse(time.DateOnly, observedOn)
+	if err != nil {
+		return 0
+	}
+
+	age := now.Sub(observed) - 24*time.Hour
+	switch {
+	case age <= 0:
+		return 1
+	case age > MaxAge:
+		return 0
+	}
+	return math.Round(math.Pow(0.5, float64(age)/float64(HalfLife))*100) / 100
+}
+
+// Assessment is the prevailing value of one field across recent reports
+type Assessment struct {
+	Value string `json:"value"`
+	// Confidence is the share of the weighted reports that agree, 0-1
+	Confidence float64 `json:"confidence"`
+}
+
+// Summary combines a hill's recent reports, favouring the newest
+type Summary struct {
+	MunroID        int         `json:"munro_id"`
+	Reports        int         `json:"reports"`
+	LatestObserved string      `json:"latest_observed,omitempty"`
+	SnowCover      *Assessment `json:"snow_cover"`
+	Path           *Assessment `json:"path"`
+	RiverCrossings *Assessment `json:"river_crossings"`
+}
+
+// Summarise combines the reports for one hill. Expired reports are ignored,
+// and a field is nil when no current report observed it.
+func Summarise(munroID int, reports []model.ConditionReport, now time.Time) Summary {
+	summary := Summary{MunroID: munroID}
+	snow := map[string]float64{}
+	path := map[string]float64{}
+	river := map[string]float64{}
+
+	for _, report := range reports {
+		weight := Weight(report.ObservedOn, now)
+		if weight == 0 {
+			continue
+		}
+
+		summary.Reports++
+		if report.ObservedOn > summary.LatestObserved {
+			summary.LatestObserved = report.ObservedOn
+		}
+		if report.SnowCover != "" {
+			snow[report.SnowCover] += weight
+		}
+		if report.Path != "" {
+			path[report.Path] += weight
+		}
+		if report.RiverCrossings != "" {
+			river[report.RiverCrossings] += weight
+		}
+	}
+
+	summary.SnowCover = prevailing(snow)
+	summary.Path = prevailing(path)
+	summary.RiverCrossings = prevailing(river)
+	return summary
+}
+
+func prevailing(weights map[string]float64) *Assessment {
+	var best *Assessment
+	var total float64
+	for value, weight := range weights {
+		total += weight
+		if best == nil || weight > best.Confidence || (weight == best.Confidence && value < best.Value) {
+			best = &Assessment{Value: value, Confidence: weight}
+		}
+	}
+
+	if best != nil {
+		best.Confidence = math.Round(best.Confidence/total*100) / 100
+	}
+	return best
+}
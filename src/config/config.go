@@ -0,0 +1,494 @@
+// Package config reads the server's settings. Each setting can come from a
+// YAML file, a MUNROMARK_* environment variable or a command-line flag, with
+// flags overriding the environment and the environment overriding the file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything that can differ between deployments
+type Config struct {
+	// Address to listen on, e.g. ":8080" or "127.0.0.1:8080"
+	Addr string `yaml:"addr"`
+	// Public address of the site, for links in emails
+	SiteURL string `yaml:"site_url"`
+	// Email addresses of users given the admin role
+	Admins []string `yaml:"admins"`
+
+	Timeouts Timeouts `yaml:"timeouts"`
+	Paths    Paths    `yaml:"paths"`
+	Mail     Mail     `yaml:"mail"`
+	CORS     CORS     `yaml:"cors"`
+	Log      Log      `yaml:"log"`
+	Metrics  Metrics  `yaml:"metrics"`
+	// Addresses or CIDR ranges of reverse proxies whose X-Forwarded-For and
+	// X-Forwarded-Proto headers are believed; without any they're ignored
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Gzip text responses for clients that accept it
+	Compression bool `yaml:"compression"`
+	// Cache-Control sent with hill catalogue responses; empty sends none
+	CacheControl string `yaml:"cache_control"`
+
+	// Print is set by -print-config: show the settings and exit
+	Print bool `yaml:"-"`
+}
+
+// Timeouts limit each connection; see http.Server. Zero means no limit,
+// except for Shutdown.
+type Timeouts struct {
+	ReadHeader time.Duration `yaml:"read_header"`
+	Read       time.Duration `yaml:"read"`
+	Write      time.Duration `yaml:"write"`
+	Idle       time.Duration `yaml:"idle"`
+	// How long each stage of stopping the server is given: in-flight
+	// requests, then the emails they queued, then the workers
+	Shutdown time.Duration `yaml:"shutdown"`
+}
+
+// Paths are relative to the working directory
+type Paths struct {
+	// Database, photos, achievement rules and sign-in providers
+	DataDir string `yaml:"data_dir"`
+	// Hill catalogue CSV; defaults to munrotab_v8.0.1.csv in DataDir
+	Dataset string `yaml:"dataset"`
+	// SQLite database; defaults to munro.db in DataDir
+	Database string `yaml:"database"`
+	// Static files served under /assets/, /public/ and /htmx/
+	Assets string `yaml:"assets"`
+	Public string `yaml:"public"`
+	HTMX   string `yaml:"htmx"`
+}
+
+// Mail is sent through SMTPAddr, or written to DataDir/mail without one
+type Mail struct {
+	From         string `yaml:"from"`
+	SMTPAddr     string `yaml:"smtp_addr"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword Secret `yaml:"smtp_password"`
+}
+
+// CORS says which other sites' pages may call the API
+type CORS struct {
+	// Origins such as "https://example.com", or "*" for any
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// Let browsers send cookies; can't be used with "*"
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// How long browsers may cache preflight responses
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// Log says where logs go and in what form
+type Log struct {
+	// debug, info, warn or error
+	Level string `yaml:"level"`
+	// text (key=value pairs) or json
+	Format string `yaml:"format"`
+	// File to write to instead of stderr; it's rotated by size
+	File string `yaml:"file"`
+	// Size at which the file is rotated, and how many rotated files to keep
+	// and for how long; zero keeps them all
+	MaxSizeMB  int `yaml:"max_size_mb"`
+	MaxBackups int `yaml:"max_backups"`
+	MaxAgeDays int `yaml:"max_age_days"`
+}
+
+// Metrics are served for Prometheus to scrape
+type Metrics struct {
+	Enabled bool `yaml:"enabled"`
+	// Path they're served at
+	Path string `yaml:"path"`
+	// Scrapers must send this as a bearer token when it's set
+	Token Secret `yaml:"token"`
+}
+
+// Secret is a setting that's never printed
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "REDACTED"
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+// Default returns the settings used when nothing else is given
+func Default() *Config {
+	return &Config{
+		Addr:    ":8080",
+		SiteURL: "http://localhost:8080",
+		Timeouts: Timeouts{
+			ReadHeader: 10 * time.Second,
+			Read:       60 * time.Second,
+			Write:      60 * time.Second,
+			Idle:       120 * time.Second,
+			Shutdown:   30 * time.Second,
+		},
+		Paths: Paths{
+			DataDir: "./data",
+			Assets:  "./munromark/build/client/",
+			Public:  "./public/",
+			HTMX:    "./htmx/",
+		},
+		Mail: Mail{
+			From: "MunroMark <noreply@munromark.local>",
+		},
+		CORS: CORS{
+			AllowedOrigins: []string{"*"},
+			MaxAge:         10 * time.Minute,
+		},
+		Compression:  true,
+		CacheControl: "public, max-age=300",
+		Log: Log{
+			Level:      "info",
+			Format:     "text",
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+			MaxAgeDays: 28,
+		},
+		Metrics: Metrics{
+			Enabled: true,
+			Path:    "/metrics",
+		},
+	}
+}
+
+// A setting that can be given as a flag or environment variable
+type setting struct {
+	name  string // the flag; the variable is MUNROMARK_ and this in upper snake case
+	usage string
+	set   func(c *Config, v string) error
+}
+
+func (s setting) env() string {
+	return "MUNROMARK_" + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+func str(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func boolean(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func integer(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// Split a comma-separated list, dropping blanks
+func list(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func duration(field func(c *Config) *time.Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+var settings = []setting{
+	{"addr", "address to listen on", str(func(c *Config) *string { return &c.Addr })},
+	{"site-url", "public address of the site, for links in emails", str(func(c *Config) *string { return &c.SiteURL })},
+	{"admins", "comma-separated emails of users given the admin role", func(c *Config, v string) error {
+		c.Admins = list(v)
+		return nil
+	}},
+	{"read-header-timeout", "time allowed to read request headers", duration(func(c *Config) *time.Duration { return &c.Timeouts.ReadHeader })},
+	{"read-timeout", "time allowed to read a request", duration(func(c *Config) *time.Duration { return &c.Timeouts.Read })},
+	{"write-timeout", "time allowed to write a response", duration(func(c *Config) *time.Duration { return &c.Timeouts.Write })},
+	{"idle-timeout", "how long idle keep-alive connections are kept", duration(func(c *Config) *time.Duration { return &c.Timeouts.Idle })},
+	{"shutdown-timeout", "time given to requests and workers to finish on shutdown", duration(func(c *Config) *time.Duration { return &c.Timeouts.Shutdown })},
+	{"data-dir", "directory holding the database, photos and rules", str(func(c *Config) *string { return &c.Paths.DataDir })},
+	{"dataset", "hill catalogue CSV (default munrotab_v8.0.1.csv in the data directory)", str(func(c *Config) *string { return &c.Paths.Dataset })},
+	{"database", "SQLite database (default munro.db in the data directory)", str(func(c *Config) *string { return &c.Paths.Database })},
+	{"assets-dir", "static files served under /assets/", str(func(c *Config) *string { return &c.Paths.Assets })},
+	{"public-dir", "static files served under /public/", str(func(c *Config) *string { return &c.Paths.Public })},
+	{"htmx-dir", "static files served under /htmx/", str(func(c *Config) *string { return &c.Paths.HTMX })},
+	{"cors-origins", "comma-separated origins whose pages may call the API, or *", func(c *Config, v string) error {
+		c.CORS.AllowedOrigins = list(v)
+		return nil
+	}},
+	{"cors-credentials", "let cross-origin requests send cookies", boolean(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+	{"cors-max-age", "how long browsers may cache preflight responses", duration(func(c *Config) *time.Duration { return &c.CORS.MaxAge })},
+	{"trusted-proxies", "comma-separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-* headers are believed", func(c *Config, v string) error {
+		c.TrustedProxies = list(v)
+		return nil
+	}},
+	{"compression", "gzip text responses", boolean(func(c *Config) *bool { return &c.Compression })},
+	{"cache-control", "Cache-Control sent with hill catalogue responses", str(func(c *Config) *string { return &c.CacheControl })},
+	{"log-level", "least severe log level written: debug, info, warn or error", str(func(c *Config) *string { return &c.Log.Level })},
+	{"log-format", "log format: text or json", str(func(c *Config) *string { return &c.Log.Format })},
+	{"log-file", "file to log to instead of stderr, rotated by size", str(func(c *Config) *string { return &c.Log.File })},
+	{"log-max-size", "size in MB at which the log file is rotated", integer(func(c *Config) *int { return &c.Log.MaxSizeMB })},
+	{"log-max-backups", "number of rotated log files kept (0 for all)", integer(func(c *Config) *int { return &c.Log.MaxBackups })},
+	{"log-max-age", "days rotated log files are kept (0 for ever)", integer(func(c *Config) *int { return &c.Log.MaxAgeDays })},
+	{"metrics", "serve Prometheus metrics", boolean(func(c *Config) *bool { return &c.Metrics.Enabled })},
+	{"metrics-path", "path metrics are served at", str(func(c *Config) *string { return &c.Metrics.Path })},
+	{"metrics-token", "bearer token scrapers must send for metrics", func(c *Config, v string) error {
+		c.Metrics.Token = Secret(v)
+		return nil
+	}},
+	{"mail-from", "sender of outgoing email", str(func(c *Config) *string { return &c.Mail.From })},
+	{"smtp-addr", "SMTP server host:port; without one emails are written to files", str(func(c *Config) *string { return &c.Mail.SMTPAddr })},
+	{"smtp-username", "SMTP user name", str(func(c *Config) *string { return &c.Mail.SMTPUsername })},
+	{"smtp-password", "SMTP password", func(c *Config, v string) error {
+		c.Mail.SMTPPassword = Secret(v)
+		return nil
+	}},
+}
+
+// A flag whose value is kept to be applied after the file and environment
+type pendingFlag struct {
+	value string
+}
+
+func (f *pendingFlag) String() string { return f.value }
+
+func (f *pendingFlag) Set(v string) error {
+	f.value = v
+	return nil
+}
+
+// Load reads the settings from the command-line arguments (without the
+// program name), the environment as seen through getenv, and the file named
+// by -config or MUNROMARK_CONFIG, then checks them. Usage is written to
+// output for -h or a bad flag.
+func Load(args []string, getenv func(string) string, output io.Writer) (*Config, error) {
+	fs := flag.NewFlagSet("munros-api", flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", getenv("MUNROMARK_CONFIG"), "YAML file of settings (env MUNROMARK_CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the settings, with secrets redacted, and exit")
+	pending := make(map[string]*pendingFlag)
+	for _, s := range settings {
+		pending[s.name] = &pendingFlag{}
+		fs.Var(pending[s.name], s.name, s.usage+" (env "+s.env()+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	c := Default()
+	if *configFile != "" {
+		if err := c.readFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v := getenv(s.env()); v != "" {
+			if err := s.set(c, v); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env(), err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.name == f.Name {
+				if err := s.set(c, pending[s.name].value); err != nil {
+					flagErr = errors.Join(flagErr, fmt.Errorf("-%s: %w", s.name, err))
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if c.Paths.Dataset == "" {
+		c.Paths.Dataset = filepath.Join(c.Paths.DataDir, "munrotab_v8.0.1.csv")
+	}
+	if c.Paths.Database == "" {
+		c.Paths.Database = filepath.Join(c.Paths.DataDir, "munro.db")
+	}
+	c.Print = *printConfig
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Unknown keys are errors so a misspelt setting isn't silently ignored
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every problem with the settings
+func (c *Config) Validate() error {
+	var errs []error
+	problem := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		problem("addr %q: %v", c.Addr, err)
+	}
+	if u, err := url.Parse(c.SiteURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problem("site_url %q must be an absolute http or https URL", c.SiteURL)
+	}
+	for _, email := range c.Admins {
+		if _, err := mail.ParseAddress(email); err != nil {
+			problem("admin %q is not an email address", email)
+		}
+	}
+
+	if c.Timeouts.ReadHeader < 0 || c.Timeouts.Read < 0 || c.Timeouts.Write < 0 || c.Timeouts.Idle < 0 {
+		problem("timeouts must not be negative")
+	}
+	if c.Timeouts.Shutdown <= 0 {
+		problem("timeouts.shutdown must be positive")
+	}
+
+	if info, err := os.Stat(c.Paths.DataDir); err != nil || !info.IsDir() {
+		problem("data_dir %q is not a directory", c.Paths.DataDir)
+	}
+	if info, err := os.Stat(c.Paths.Dataset); err != nil || info.IsDir() {
+		problem("dataset %q is not a file", c.Paths.Dataset)
+	}
+	// Static directories may be missing, e.g. before the frontend is built
+	for _, dir := range []string{c.Paths.Assets, c.Paths.Public, c.Paths.HTMX} {
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			problem("static path %q is not a directory", dir)
+		}
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				problem("cors.allowed_origins can't be * when cors.allow_credentials is set")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			problem("cors origin %q must be a scheme and host, e.g. https://example.com", origin)
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		problem("cors.max_age must not be negative")
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			problem("trusted proxy %q is not an IP address or CIDR range", proxy)
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		problem("log.level %q must be debug, info, warn or error", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		problem("log.format %q must be text or json", c.Log.Format)
+	}
+	if c.Log.MaxSizeMB <= 0 || c.Log.MaxBackups < 0 || c.Log.MaxAgeDays < 0 {
+		problem("log.max_size_mb must be positive, and log.max_backups and log.max_age_days not negative")
+	}
+
+	if c.Metrics.Enabled {
+		path := c.Metrics.Path
+		if !strings.HasPrefix(path, "/") || path == "/" || strings.ContainsAny(path, "{} ") {
+			problem("metrics.path %q must be a path such as /metrics", path)
+		}
+		for _, prefix := range []string{"/api/", "/assets/", "/public/", "/htmx/", "/auth/", "/admin/", "/feed/", "/groups/", "/munros/", "/reports/"} {
+			if strings.HasPrefix(path, prefix) {
+				problem("metrics.path %q is under %s, which is already served", path, prefix)
+			}
+		}
+		// Registering a route twice stops the server starting, and the
+		// pages would be hidden from GET requests
+		if slices.Contains([]string{"/healthz", "/readyz", "/version", "/map", "/feed", "/admin"}, path) {
+			problem("metrics.path %q is already served", path)
+		}
+	}
+
+	if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+		problem("mail.from %q is not an email address", c.Mail.From)
+	}
+	if c.Mail.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Mail.SMTPAddr); err != nil {
+			problem("mail.smtp_addr %q: %v", c.Mail.SMTPAddr, err)
+		}
+	}
+	if (c.Mail.SMTPUsername == "") != (c.Mail.SMTPPassword == "") {
+		problem("mail.smtp_username and mail.smtp_password must be given together")
+	}
+
+	return errors.Join(errs...)
+}
+
+// String returns the settings as YAML with secrets redacted
+func (c *Config) String() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The default settings, with the data directory and dataset pointing at
+// files that exist
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+
+	c := Default()
+	c.Paths.DataDir = t.TempDir()
+	c.Paths.Dataset = filepath.Join(c.Paths.DataDir, "munros.csv")
+	if err := os.WriteFile(c.Paths.Dataset, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("default settings are invalid: %v", err)
+	}
+	return c
+}
+
+func TestValidateMetricsPath(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"/metrics", true},
+		{"/internal/metrics", true},
+		{"metrics", false},
+		{"/", false},
+		{"/metrics/{name}", false},
+		{"/healthz", false},
+		{"/readyz", false},
+		{"/version", false},
+		{"/feed", false},
+		{"/feed/metrics", false},
+		{"/map", false},
+		{"/admin", false},
+		{"/admin/metrics", false},
+		{"/auth/metrics", false},
+		{"/munros/metrics", false},
+		{"/api/metrics", false},
+		{"/assets/metrics", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			c := validConfig(t)
+			c.Metrics.Path = tt.path
+			err := c.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("Validate() = %v, want no error", err)
+			}
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "metrics.path")) {
+				t.Errorf("Validate() = %v, want a metrics.path error", err)
+			}
+		})
+	}
+
+	// The path doesn't matter when metrics are off
+	c := validConfig(t)
+	c.Metrics.Enabled = false
+	c.Metrics.Path = "/healthz"
+	if err := c.Validate(); err != nil {
+		t.Errorf("with metrics disabled: Validate() = %v", err)
+	}
+}
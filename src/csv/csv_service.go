@@ -22,6 +22,11 @@ func NewCSVService(filePath string) *CSVService {
 	}
 }
 
+// Path is the CSV file read
+func (s *CSVService) Path() string {
+	return s.filePath
+}
+
 // ConvertOSGridToLatLon converts Ordnance Survey grid coordinates to latitude and longitude
 func ConvertOSGridToLatLon(easting, northing float64) (float64, float64) {
 	// Constants for OSGB36 to WGS84 conversion
@@ -0,0 +1,330 @@
+// Package dataset keeps the hill catalogue in memory and reloads it when
+// the source file changes, reporting what changed
+package dataset
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Source reads the full catalogue, e.g. csv.CSVService
+type Source interface {
+	ReadMunros() ([]model.Munro, error)
+}
+
+// FileSource is a source read from a file, whose details are then kept
+// with the catalogue
+type FileSource interface {
+	Source
+	Path() string
+}
+
+// File describes the file a catalogue was loaded from
+type File struct {
+	// Name of the file, without its directory
+	Name string `json:"name"`
+	// Version read from the name, e.g. "munrotab v8.0.1" from
+	// munrotab_v8.0.1.csv; empty if the name doesn't say
+	Version string `json:"version,omitempty"`
+	// SHA-256 of the contents, in hex
+	Checksum string `json:"checksum"`
+	// When the file was last changed
+	ModTime time.Time `json:"modified_at"`
+}
+
+// Dataset is a cached catalogue. It satisfies the same interface as its
+// source, so handlers can't tell the difference.
+type Dataset struct {
+	source Source
+
+	mu           sync.RWMutex
+	munros       []model.Munro
+	loadedAt     time.Time
+	file         *File
+	loadDuration time.Duration
+	loads        int64
+	loadErrors   int64
+
+	// Reads answered from memory, and those that had to load first
+	hits, misses atomic.Int64
+}
+
+func New(source Source) *Dataset {
+	return &Dataset{source: source}
+}
+
+// ReadMunros returns the catalogue as last loaded, loading it on first use
+func (d *Dataset) ReadMunros() ([]model.Munro, error) {
+	d.mu.RLock()
+	munros := d.munros
+	d.mu.RUnlock()
+
+	if munros == nil {
+		d.misses.Add(1)
+		if _, err := d.Reload(); err != nil {
+			return nil, err
+		}
+		d.mu.RLock()
+		munros = d.munros
+		d.mu.RUnlock()
+	} else {
+		d.hits.Add(1)
+	}
+
+	// Callers are free to filter or sort what they get back
+	return append([]model.Munro(nil), munros...), nil
+}
+
+// LoadedAt is when the catalogue was last read from the source
+func (d *Dataset) LoadedAt() time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadedAt
+}
+
+// Reload re-reads the source and returns how it differs from the previous
+// load. The first load reports no changes.
+func (d *Dataset) Reload() (Diff, error) {
+	start := time.Now()
+	munros, err := d.source.ReadMunros()
+	var file *File
+	if fs, ok := d.source.(FileSource); ok && err == nil {
+		file, err = describeFile(fs.Path())
+	}
+	took := time.Since(start)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err != nil {
+		d.loadErrors++
+		return Diff{}, err
+	}
+	d.loads++
+	d.loadDuration = took
+
+	diff := Diff{Added: []model.Munro{}, Removed: []model.Munro{}, Changed: []HillChange{}}
+	if d.munros != nil {
+		diff = Compare(d.munros, munros)
+	}
+	d.munros = munros
+	d.file = file
+	d.loadedAt = time.Now()
+
+	return diff, nil
+}
+
+// File describes the file the catalogue was last loaded from, or is nil if
+// it hasn't been loaded or its source isn't a file
+func (d *Dataset) File() *File {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.file
+}
+
+// Versioned file names, e.g. munrotab_v8.0.1.csv
+var versionedName = regexp.MustCompile(`^(.+?)[_-]v(\d+(?:\.\d+)*)$`)
+
+func describeFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+	file := &File{Name: name, Checksum: hex.EncodeToString(sum.Sum(nil)), ModTime: info.ModTime().UTC()}
+	if m := versionedName.FindStringSubmatch(strings.TrimSuffix(name, filepath.Ext(name))); m != nil {
+		file.Version = m[1] + " v" + m[2]
+	}
+	return file, nil
+}
+
+// Stats describe the catalogue and how it's been loaded and read
+type Stats struct {
+	Loaded       bool
+	LoadedAt     time.Time
+	LoadDuration time.Duration // of the last successful load
+	Loads        int64
+	LoadErrors   int64
+	Hits         int64
+	Misses       int64
+	// Number of hills by classification, e.g. "MUN" or "TOP"
+	Classifications map[string]int
+}
+
+// Stats returns the catalogue's current figures
+func (d *Dataset) Stats() Stats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stats := Stats{
+		Loaded:          d.munros != nil,
+		LoadedAt:        d.loadedAt,
+		LoadDuration:    d.loadDuration,
+		Loads:           d.loads,
+		LoadErrors:      d.loadErrors,
+		Hits:            d.hits.Load(),
+		Misses:          d.misses.Load(),
+		Classifications: make(map[string]int),
+	}
+	for _, m := range d.munros {
+		// Rows without a DoBIH number are the CSV's totals, not hills
+		if m.DoBIHNumber != 0 {
+			stats.Classifications[m.Classification]++
+		}
+	}
+	return stats
+}
+
+// Watch polls the file at path and reloads the catalogue whenever its
+// modification time changes, passing any differences to onChange. It
+// returns when ctx is cancelled.
+func (d *Dataset) Watch(ctx context.Context, path string, interval time.Duration, onChange func(Diff)) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Error("Error checking dataset", "err", err)
+			continue
+		}
+		if info.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		diff, err := d.Reload()
+		if err != nil {
+			slog.Error("Error reloading dataset", "err", err)
+			continue
+		}
+		slog.Info("Reloaded dataset", "changes", diff.String())
+		if !diff.Empty() {
+			onChange(diff)
+		}
+	}
+}
+
+// Diff describes how the catalogue changed between two loads. Hills are
+// matched by DoBIH number.
+type Diff struct {
+	Added   []model.Munro `json:"added"`
+	Removed []model.Munro `json:"removed"`
+	Changed []HillChange  `json:"changed"`
+}
+
+// HillChange lists the fields that changed for one hill
+type HillChange struct {
+	DoBIHNumber int           `json:"dobih_number"`
+	Name        string        `json:"name"`
+	Fields      []FieldChange `json:"fields"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"` // JSON name
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("%d added, %d removed, %d changed", len(d.Added), len(d.Removed), len(d.Changed))
+}
+
+// Compare two versions of the catalogue. Rows without a DoBIH number (the
+// totals at the foot of the CSV) aren't hills and are ignored.
+func Compare(old, new []model.Munro) Diff {
+	diff := Diff{Added: []model.Munro{}, Removed: []model.Munro{}, Changed: []HillChange{}}
+
+	before := make(map[int]model.Munro, len(old))
+	for _, m := range old {
+		if m.DoBIHNumber != 0 {
+			before[m.DoBIHNumber] = m
+		}
+	}
+	after := make(map[int]bool, len(new))
+
+	for _, m := range new {
+		if m.DoBIHNumber == 0 {
+			continue
+		}
+		after[m.DoBIHNumber] = true
+		prev, ok := before[m.DoBIHNumber]
+		if !ok {
+			diff.Added = append(diff.Added, m)
+			continue
+		}
+		if fields := changedFields(prev, m); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, HillChange{DoBIHNumber: m.DoBIHNumber, Name: m.Name, Fields: fields})
+		}
+	}
+
+	for _, m := range old {
+		if m.DoBIHNumber != 0 && !after[m.DoBIHNumber] {
+			diff.Removed = append(diff.Removed, m)
+		}
+	}
+
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].DoBIHNumber < diff.Changed[j].DoBIHNumber })
+	return diff
+}
+
+func changedFields(a, b model.Munro) []FieldChange {
+	var fields []FieldChange
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		x, y := va.Field(i).Interface(), vb.Field(i).Interface()
+		if x == y {
+			continue
+		}
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields = append(fields, FieldChange{Field: name, Old: x, New: y})
+	}
+
+	return fields
+}
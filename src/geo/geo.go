@@ -0,0 +1,135 @@
+package geo
+
+import "math"
+
+// EarthRadiusM is the mean radius of the Earth in metres
+const EarthRadiusM = 6371008.8
+
+const metresPerDegree = EarthRadiusM * math.Pi / 180
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Distance returns the great-circle distance in metres between two points
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * EarthRadiusM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ClosestOnSegment returns the fraction t (0..1) along the segment a->b that
+// is closest to p, and the distance in metres from p to that point. Distances
+// are small enough for a local equirectangular projection to be accurate.
+func ClosestOnSegment(pLat, pLon, aLat, aLon, bLat, bLon float64) (t, dist float64) {
+	cosLat := math.Cos(toRadians(pLat))
+
+	// Project to metres relative to p
+	ax, ay := (aLon-pLon)*cosLat*metresPerDegree, (aLat-pLat)*metresPerDegree
+	bx, by := (bLon-pLon)*cosLat*metresPerDegree, (bLat-pLat)*metresPerDegree
+
+	dx, dy := bx-ax, by-ay
+	lengthSq := dx*dx + dy*dy
+	if lengthSq > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSq))
+	}
+
+	cx, cy := ax+t*dx, ay+t*dy
+	return t, math.Hypot(cx, cy)
+}
+
+// Index is a fixed-grid spatial index over a set of points, used to find the
+// hills near a position without scanning the whole catalogue.
+type Index struct {
+	cellSize float64 // degrees
+	cells    map[[2]int][]int
+	lats     []float64
+	lons     []float64
+}
+
+// NewIndex builds an index over the given coordinates. Query results are
+// indices into these slices.
+func NewIndex(lats, lons []float64) *Index {
+	idx := &Index{
+		cellSize: 0.05,
+		cells:    make(map[[2]int][]int),
+		lats:     lats,
+		lons:     lons,
+	}
+
+	for i := range lats {
+		key := idx.cell(lats[i], lons[i])
+		idx.cells[key] = append(idx.cells[key], i)
+	}
+
+	return idx
+}
+
+func (idx *Index) cell(lat, lon float64) [2]int {
+	return [2]int{int(math.Floor(lat / idx.cellSize)), int(math.Floor(lon / idx.cellSize))}
+}
+
+// Within returns the indices of all points within radius metres of lat/lon.
+// A search covering more cells than the index has points checks every
+// point instead, so no query costs more than a scan of the whole set.
+func (idx *Index) Within(lat, lon, radius float64) []int {
+	if math.IsNaN(lat) || math.IsNaN(lon) || !(radius >= 0) {
+		return nil
+	}
+
+	dLat := radius / metresPerDegree
+	dLon := radius / (metresPerDegree * math.Max(0.01, math.Cos(toRadians(lat))))
+
+	var found []int
+	rows := math.Floor((lat+dLat)/idx.cellSize) - math.Floor((lat-dLat)/idx.cellSize) + 1
+	cols := math.Floor((lon+dLon)/idx.cellSize) - math.Floor((lon-dLon)/idx.cellSize) + 1
+	if !(rows*cols <= float64(len(idx.lats))) {
+		for i := range idx.lats {
+			if Distance(lat, lon, idx.lats[i], idx.lons[i]) <= radius {
+				found = append(found, i)
+			}
+		}
+		return found
+	}
+
+	minCell := idx.cell(lat-dLat, lon-dLon)
+	maxCell := idx.cell(lat+dLat, lon+dLon)
+	for y := minCell[0]; y <= maxCell[0]; y++ {
+		for x := minCell[1]; x <= maxCell[1]; x++ {
+			for _, i := range idx.cells[[2]int{y, x}] {
+				if Distance(lat, lon, idx.lats[i], idx.lons[i]) <= radius {
+					found = append(found, i)
+				}
+			}
+		}
+	}
+
+	return found
+}
+
+// GridSquare returns the two-letter Ordnance Survey 100km square containing
+// the given easting/northing, e.g. "NN" for Ben Nevis
+func GridSquare(easting, northing float64) string {
+	e := int(math.Floor(easting / 100000))
+	n := int(math.Floor(northing / 100000))
+	if e < 0 || e > 6 || n < 0 || n > 12 {
+		return ""
+	}
+
+	first := (19 - n) - (19-n)%5 + (e+10)/5
+	second := (19-n)*5%25 + e%5
+
+	return string([]byte{gridLetter(first), gridLetter(second)})
+}
+
+// Grid letters run A-Z without I
+func gridLetter(i int) byte {
+	if i > 7 {
+		i++
+	}
+	return byte('A' + i)
+}
@@ -0,0 +1,38 @@
+package geo
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWithin(t *testing.T) {
+	// Ben Nevis, Carn Mor Dearg and Ben Macdui
+	idx := NewIndex([]float64{56.7969, 56.8051, 57.0704}, []float64{-5.0036, -4.9878, -3.6691})
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		radius   float64
+		want     []int
+	}{
+		{"on a summit", 56.7969, -5.0036, 75, []int{0}},
+		{"between two summits", 56.8010, -4.9957, 1000, []int{0, 1}},
+		{"nowhere near", 51.5, -0.1, 1000, nil},
+		// Wide enough to cover more cells than there are points, so every
+		// point is checked instead
+		{"a whole region", 56.9, -4.5, 150000, []int{0, 1, 2}},
+		{"the whole Earth", 0, 0, 2 * EarthRadiusM * 3.15, []int{0, 1, 2}},
+		{"near the pole", 89.99, 0, 5000, nil},
+		{"negative radius", 56.7969, -5.0036, -1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.Within(tt.lat, tt.lon, tt.radius)
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Within = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
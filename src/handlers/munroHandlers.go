@@ -3,19 +3,164 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/AlexM141200/munros-api/src/model"
 	"github.com/AlexM141200/munros-api/src/routes"
 )
 
-func SetupMunroRoutes(router *http.ServeMux) {
+// NewRouter returns a router serving the API and site with h
+func NewRouter(h *routes.Handlers) *http.ServeMux {
+	router := http.NewServeMux()
 
-	router.HandleFunc("/api/munros", routes.HandleGetMunros)
-	router.HandleFunc("/api/munros/{id}", routes.HandleMunroByID)
-	router.HandleFunc("/api/munros/csv", routes.HandleMunrosCSV)
-	router.HandleFunc("/api/munros/all", routes.HandleGetAllMunros)
+	// Health checks and build details, for orchestrators and monitoring
+	SetupHealthRoutes(router, h)
+
+	// API Routes
+	SetupMunroRoutes(router, h)
+	SetupAccountRoutes(router, h)
+
+	// Frontend Routes
+	SetupFrontendRoutes(router, h)
+
+	return router
+}
+
+func SetupHealthRoutes(router *http.ServeMux, h *routes.Handlers) {
+
+	router.HandleFunc("GET /healthz", h.HandleHealthz)
+	router.HandleFunc("GET /readyz", h.HandleReadyz)
+	router.HandleFunc("GET /version", h.HandleVersion)
+}
+
+func SetupMunroRoutes(router *http.ServeMux, h *routes.Handlers) {
+
+	router.HandleFunc("/api/munros", h.WithScope(model.ScopeCatalogueRead, h.WithCatalogueCache(h.HandleGetMunros)))
+	router.HandleFunc("/api/munros/{id}", h.WithScope(model.ScopeCatalogueRead, h.WithCatalogueCache(h.HandleMunroByID)))
+	router.HandleFunc("/api/munros/csv", h.WithScope(model.ScopeCatalogueRead, h.WithCatalogueCache(h.HandleMunrosCSV)))
+	router.HandleFunc("/api/munros/all", h.WithScope(model.ScopeCatalogueRead, h.WithCatalogueCache(h.HandleGetAllMunros)))
+}
+
+func SetupAccountRoutes(router *http.ServeMux, h *routes.Handlers) {
+
+	router.HandleFunc("POST /api/auth/register", h.HandleRegister)
+	router.HandleFunc("POST /api/auth/login", h.HandleLogin)
+	router.HandleFunc("POST /api/auth/logout", h.HandleLogout)
+	router.HandleFunc("GET /api/me", h.HandleMe)
+	router.HandleFunc("DELETE /api/me", h.HandleDeleteAccount)
+	router.HandleFunc("GET /api/me/export", h.HandleExportAccount)
+	router.HandleFunc("GET /api/me/identities", h.HandleGetIdentities)
+	router.HandleFunc("GET /api/auth/providers", h.HandleGetAuthProviders)
+	router.HandleFunc("POST /api/auth/password/forgot", h.HandleForgotPassword)
+	router.HandleFunc("POST /api/auth/password/reset", h.HandleResetPassword)
+	router.HandleFunc("POST /api/me/verification", h.HandleSendVerification)
+	router.HandleFunc("GET /api/me/email-preferences", h.HandleGetEmailPreferences)
+	router.HandleFunc("PUT /api/me/email-preferences", h.HandleSetEmailPreferences)
+
+	router.HandleFunc("GET /api/keys", h.HandleGetAPIKeys)
+	router.HandleFunc("POST /api/keys", h.HandleCreateAPIKey)
+	router.HandleFunc("DELETE /api/keys/{id}", h.HandleDeleteAPIKey)
+	router.HandleFunc("GET /api/keys/{id}/usage", h.HandleGetAPIKeyUsage)
+	router.HandleFunc("GET /api/admin/keys", h.WithScope(model.ScopeAdmin, h.HandleGetAllAPIKeys))
+	router.HandleFunc("PUT /api/admin/keys/{id}/quota", h.WithScope(model.ScopeAdmin, h.HandleSetAPIKeyQuota))
+
+	router.HandleFunc("GET /api/ascents", h.WithScope(model.ScopeAscentsRead, h.HandleGetAscents))
+	router.HandleFunc("POST /api/ascents", h.WithScope(model.ScopeAscentsWrite, h.HandleCreateAscents))
+	router.HandleFunc("DELETE /api/ascents/{id}", h.WithScope(model.ScopeAscentsWrite, h.HandleDeleteAscent))
+	router.HandleFunc("PUT /api/ascents/{id}/visibility", h.WithScope(model.ScopeAscentsWrite, h.HandleSetAscentVisibility))
+
+	router.HandleFunc("POST /api/users/{id}/follow", h.HandleFollow)
+	router.HandleFunc("DELETE /api/users/{id}/follow", h.HandleUnfollow)
+	router.HandleFunc("GET /api/me/following", h.HandleGetFollowing)
+	router.HandleFunc("GET /api/me/followers", h.HandleGetFollowers)
+	router.HandleFunc("DELETE /api/me/followers/{id}", h.HandleRemoveFollower)
+	router.HandleFunc("GET /api/feed", h.HandleGetFeed)
+
+	router.HandleFunc("POST /api/tracks/summits", h.HandleTrackSummits)
+
+	router.HandleFunc("GET /api/plans", h.HandleGetPlans)
+	router.HandleFunc("POST /api/plans", h.HandleCreatePlan)
+	router.HandleFunc("GET /api/plans/{id}", h.HandleGetPlan)
+	router.HandleFunc("PUT /api/plans/{id}", h.HandleUpdatePlan)
+	router.HandleFunc("DELETE /api/plans/{id}", h.HandleDeletePlan)
+	router.HandleFunc("GET /api/plans/{id}/gpx", h.HandlePlanGPX)
+	router.HandleFunc("POST /api/plans/{id}/share", h.HandleSharePlan)
+	router.HandleFunc("DELETE /api/plans/{id}/share", h.HandleUnsharePlan)
+	router.HandleFunc("GET /api/shared/plans/{token}", h.HandleGetSharedPlan)
+	router.HandleFunc("GET /api/shared/plans/{token}/gpx", h.HandleSharedPlanGPX)
+
+	router.HandleFunc("POST /api/calendar/token", h.HandleCreateCalendarToken)
+	router.HandleFunc("DELETE /api/calendar/token", h.HandleDeleteCalendarToken)
+	router.HandleFunc("GET /api/calendar/{file}", h.HandleCalendarFeed)
+
+	router.HandleFunc("GET /api/progress", h.WithScope(model.ScopeAscentsRead, h.HandleGetProgress))
+	router.HandleFunc("GET /api/progress/poster.png", h.HandleProgressPoster)
+	router.HandleFunc("GET /api/certificates", h.HandleGetCertificates)
+	router.HandleFunc("GET /api/certificates/{file}", h.HandleCertificate)
+
+	router.HandleFunc("GET /api/achievements", h.HandleGetAchievements)
+	router.HandleFunc("GET /api/me/achievements", h.HandleGetAwards)
+
+	router.HandleFunc("GET /api/groups", h.HandleGetGroups)
+	router.HandleFunc("POST /api/groups", h.HandleCreateGroup)
+	router.HandleFunc("POST /api/groups/join", h.HandleJoinGroup)
+	router.HandleFunc("GET /api/groups/{id}", h.HandleGetGroup)
+	router.HandleFunc("DELETE /api/groups/{id}/membership", h.HandleLeaveGroup)
+	router.HandleFunc("GET /api/groups/{id}/leaderboard", h.HandleGroupLeaderboard)
+	router.HandleFunc("GET /api/groups/{id}/records", h.HandleGroupRecords)
+
+	router.HandleFunc("GET /api/reports", h.HandleGetReports)
+	router.HandleFunc("POST /api/reports", h.HandleCreateReport)
+	router.HandleFunc("GET /api/reports/{id}", h.HandleGetReport)
+	router.HandleFunc("PUT /api/reports/{id}", h.HandleUpdateReport)
+	router.HandleFunc("DELETE /api/reports/{id}", h.HandleDeleteReport)
+	router.HandleFunc("GET /api/me/reports", h.HandleGetMyReports)
+	router.HandleFunc("GET /api/munros/{id}/reports", h.HandleGetHillReports)
+
+	router.HandleFunc("POST /api/photos", h.HandleUploadPhoto)
+	router.HandleFunc("GET /api/photos/{id}", h.HandleGetPhoto)
+	router.HandleFunc("PUT /api/photos/{id}", h.HandleUpdatePhoto)
+	router.HandleFunc("DELETE /api/photos/{id}", h.HandleDeletePhoto)
+	router.HandleFunc("GET /api/photos/{id}/original", h.HandlePhotoOriginal)
+	router.HandleFunc("GET /api/photos/{id}/thumbnail", h.HandlePhotoThumbnail)
+	router.HandleFunc("GET /api/me/photos", h.HandleGetMyPhotos)
+	router.HandleFunc("GET /api/munros/{id}/photos", h.HandleGetHillPhotos)
+
+	router.HandleFunc("GET /api/munros/{id}/ratings", h.HandleGetHillRatings)
+	router.HandleFunc("PUT /api/munros/{id}/rating", h.HandleSetRating)
+	router.HandleFunc("DELETE /api/munros/{id}/rating", h.HandleDeleteRating)
+	router.HandleFunc("GET /api/munros/{id}/conditions", h.HandleGetHillConditions)
+	router.HandleFunc("POST /api/munros/{id}/conditions", h.HandleCreateCondition)
+	router.HandleFunc("DELETE /api/conditions/{id}", h.HandleDeleteCondition)
+	router.HandleFunc("GET /api/conditions", h.HandleGetRecentConditions)
+
+	router.HandleFunc("POST /api/flags", h.HandleCreateFlag)
+	router.HandleFunc("GET /api/admin/queue", h.WithScope(model.ScopeAdmin, h.HandleGetModerationQueue))
+	router.HandleFunc("POST /api/admin/content/{type}/{id}", h.WithScope(model.ScopeAdmin, h.HandleModerateContent))
+	router.HandleFunc("GET /api/admin/audit", h.WithScope(model.ScopeAdmin, h.HandleGetAuditLog))
+	router.HandleFunc("PUT /api/admin/users/{id}/role", h.WithScope(model.ScopeAdmin, h.HandleSetUserRole))
+	router.HandleFunc("POST /api/admin/dataset/reload", h.WithScope(model.ScopeAdmin, h.HandleReloadDataset))
+
+	router.HandleFunc("GET /api/webhooks", h.HandleGetWebhooks)
+	router.HandleFunc("POST /api/webhooks", h.HandleCreateWebhook)
+	router.HandleFunc("DELETE /api/webhooks/{id}", h.HandleDeleteWebhook)
+	router.HandleFunc("GET /api/webhooks/{id}/deliveries", h.HandleGetDeliveries)
+	router.HandleFunc("POST /api/webhooks/{id}/deliveries/{delivery}/replay", h.HandleReplayDelivery)
 }
 
-func SetupFrontendRoutes(router *http.ServeMux) {
-	router.HandleFunc("/", routes.HandleIndex)
-	router.HandleFunc("/map", routes.HandleMap)
+func SetupFrontendRoutes(router *http.ServeMux, h *routes.Handlers) {
+	router.HandleFunc("/api/", h.HandleAPINotFound)
+	router.HandleFunc("/", h.HandleIndex)
+	router.HandleFunc("/map", h.HandleMap)
+	router.HandleFunc("GET /feed", h.HandleFeedPage)
+	router.HandleFunc("GET /feed/items", h.HandleFeedItems)
+	router.HandleFunc("/groups/{id}", h.HandleGroupPage)
+	router.HandleFunc("/munros/{id}", h.HandleHillPage)
+	router.HandleFunc("/reports/{id}", h.HandleReportPage)
+	router.HandleFunc("/admin", h.HandleAdminPage)
+	router.HandleFunc("GET /auth/oidc/{provider}", h.HandleOIDCLogin)
+	router.HandleFunc("GET /auth/oidc/{provider}/callback", h.HandleOIDCCallback)
+	router.HandleFunc("GET /auth/verify", h.HandleVerifyEmail)
+	router.HandleFunc("GET /auth/reset", h.HandleResetPasswordPage)
+	router.HandleFunc("POST /auth/reset", h.HandleResetPasswordForm)
+	router.HandleFunc("POST /admin/content/{type}/{id}/{action}", h.HandleAdminModerateForm)
 
 }
@@ -0,0 +1,111 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Minimal RFC 5545 writer for publishing all-day events
+
+// Event is an all-day event spanning Start to End inclusive
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	// Optional position of the event, written as GEO
+	Lat, Lon float64
+	HasGeo   bool
+	Modified time.Time
+}
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+type lineWriter struct {
+	w *bufio.Writer
+}
+
+// line writes a content line, folding it at 75 octets without splitting
+// multi-byte characters
+func (lw *lineWriter) line(name, value string) {
+	s := name + ":" + value
+	for first := true; ; first = false {
+		limit := 75
+		if !first {
+			limit = 74 // allow for the leading space
+			lw.w.WriteString(" ")
+		}
+		if len(s) <= limit {
+			lw.w.WriteString(s + "\r\n")
+			return
+		}
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		lw.w.WriteString(s[:cut] + "\r\n")
+		s = s[cut:]
+	}
+}
+
+// Write encodes the calendar as text/calendar
+func (c *Calendar) Write(w io.Writer) error {
+	lw := &lineWriter{w: bufio.NewWriter(w)}
+	now := time.Now().UTC()
+
+	lw.line("BEGIN", "VCALENDAR")
+	lw.line("VERSION", "2.0")
+	lw.line("PRODID", "-//MunroMark//Trips//EN")
+	lw.line("CALSCALE", "GREGORIAN")
+	lw.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME", escapeText(c.Name))
+	}
+
+	for _, e := range c.Events {
+		stamp := e.Modified
+		if stamp.IsZero() {
+			stamp = now
+		}
+
+		lw.line("BEGIN", "VEVENT")
+		lw.line("UID", e.UID)
+		lw.line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		lw.line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+		// DTEND is exclusive for all-day events
+		lw.line("DTEND;VALUE=DATE", e.End.AddDate(0, 0, 1).Format("20060102"))
+		lw.line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			lw.line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Location != "" {
+			lw.line("LOCATION", escapeText(e.Location))
+		}
+		if e.HasGeo {
+			lw.line("GEO", fmt.Sprintf("%.6f;%.6f", e.Lat, e.Lon))
+		}
+		if e.URL != "" {
+			lw.line("URL", e.URL)
+		}
+		lw.line("TRANSP", "TRANSPARENT")
+		lw.line("END", "VEVENT")
+	}
+
+	lw.line("END", "VCALENDAR")
+	return lw.w.Flush()
+}
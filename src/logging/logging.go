@@ -0,0 +1,92 @@
+// Package logging sets up the server's structured logger and carries
+// per-request loggers in contexts
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Options says where logs go and in what form
+type Options struct {
+	// Level is the least severe level written: debug, info, warn or error
+	Level string
+	// Format is text (key=value) or json
+	Format string
+	// File is written to, and rotated, instead of stderr when set
+	File string
+	// When to rotate the file, and how many old files to keep and for how
+	// long; zero keeps them all
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// ParseLevel reads a level name
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// New returns a logger as described by opts, and a function that closes its
+// file, if it has one
+func New(opts Options) (*slog.Logger, func() error, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	closeFn := func() error { return nil }
+	if opts.File != "" {
+		file := &lumberjack.Logger{
+			Filename:   opts.File,
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+		}
+		out, closeFn = file, file.Close
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	case "text", "":
+		handler = slog.NewTextHandler(out, handlerOpts)
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	return slog.New(handler), closeFn, nil
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Lookup returns the logger carried by ctx, if there is one
+func Lookup(ctx context.Context) (*slog.Logger, bool) {
+	logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+	return logger, ok
+}
+
+// FromContext returns the logger carried by ctx, or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := Lookup(ctx); ok {
+		return logger
+	}
+	return slog.Default()
+}
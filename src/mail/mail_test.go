@@ -0,0 +1,160 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessage = Message{
+	To:      "Walker <walker@example.com>",
+	Subject: "Your week on the hills – 3 new Munros",
+	HTML:    "<p>You climbed <b>Ben Nevis</b>.</p>",
+	Text:    "You climbed Ben Nevis.\n" + strings.Repeat("A long line that has to be wrapped. ", 5),
+}
+
+// Parse a built message, checking it has the given content
+func checkMessage(t *testing.T, data []byte, from string, msg Message) {
+	t.Helper()
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Header.Get("From"); got != from {
+		t.Errorf("From = %q, want %q", got, from)
+	}
+	if got := parsed.Header.Get("To"); got != msg.To {
+		t.Errorf("To = %q, want %q", got, msg.To)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	if parsed.Header.Get("Message-ID") == "" || parsed.Header.Get("Date") == "" {
+		t.Error("no Message-ID or Date")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", parsed.Header.Get("Content-Type"), err)
+	}
+	// multipart.Reader undoes the quoted-printable encoding
+	parts := map[string]string{}
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	// Line breaks are sent as CRLF, as email requires
+	if want := strings.ReplaceAll(msg.Text, "\n", "\r\n"); parts["text/plain"] != want {
+		t.Errorf("text part = %q, want %q", parts["text/plain"], want)
+	}
+	if parts["text/html"] != msg.HTML {
+		t.Errorf("HTML part = %q, want %q", parts["text/html"], msg.HTML)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	from := "MunroMark <hello@munromark.test>"
+	data, err := Build(from, testMessage, time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMessage(t, data, from, testMessage)
+
+	if !bytes.Contains(data, []byte("@munromark.test>\r\n")) {
+		t.Error("Message-ID isn't on the sender's domain")
+	}
+	for _, line := range strings.Split(string(data), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line longer than SMTP allows: %d bytes", len(line))
+		}
+	}
+}
+
+func TestBuildRejectsBadHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		msg  Message
+	}{
+		{"invalid recipient", "hello@munromark.test", Message{To: "not an address", Subject: "Hi"}},
+		{"line break in recipient", "hello@munromark.test", Message{To: "walker@example.com\r\nBcc: everyone@example.com", Subject: "Hi"}},
+		{"line break in sender", "hello@munromark.test\r\nBcc: everyone@example.com", Message{To: "walker@example.com", Subject: "Hi"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Build(tt.from, tt.msg, time.Now()); err == nil {
+				t.Error("Build succeeded")
+			}
+		})
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	d := &Dir{Path: dir, From: "hello@munromark.test"}
+
+	for i := 0; i < 2; i++ {
+		if err := d.Send(context.Background(), testMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d .eml files written, want 2", len(files))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkMessage(t, data, d.From, testMessage)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	var m Memory
+
+	if err := m.Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), Message{To: "nobody"}); err == nil {
+		t.Error("sent to an invalid address")
+	}
+
+	sent := m.Messages()
+	if len(sent) != 1 || sent[0] != testMessage {
+		t.Errorf("Messages() = %+v, want the one valid message", sent)
+	}
+	// A copy, so callers can't change what was recorded
+	sent[0].Subject = "changed"
+	if m.Messages()[0].Subject != testMessage.Subject {
+		t.Error("Messages() returned the recorded slice")
+	}
+}
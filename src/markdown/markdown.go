@@ -0,0 +1,99 @@
+// Package markdown renders user-written Markdown to HTML that is safe to put
+// on a page.
+package markdown
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Raw HTML in the source is dropped because the renderer isn't given
+// html.WithUnsafe; links and images are further restricted by sanitizer.
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(sanitizer{}, 100)),
+	),
+)
+
+// Render converts Markdown to sanitised HTML
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// sanitizer removes links and images whose URLs aren't on the allow list
+// (goldmark's own check is case-sensitive and runs before entities are
+// resolved, so "JavaScript:" and "javascript&#58;" slip through) and marks
+// the remaining links as user content.
+type sanitizer struct{}
+
+func (sanitizer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var unsafe []*ast.AutoLink
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Link:
+			if !allowedURL(n.Destination, "http", "https", "mailto") {
+				n.Destination = nil
+			}
+			n.SetAttributeString("rel", []byte("nofollow ugc noopener"))
+		case *ast.Image:
+			if !allowedURL(n.Destination, "http", "https") {
+				n.Destination = nil
+			}
+		case *ast.AutoLink:
+			if !allowedURL(n.URL(source), "http", "https", "mailto") {
+				unsafe = append(unsafe, n)
+			} else {
+				n.SetAttributeString("rel", []byte("nofollow ugc noopener"))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Replaced after the walk, which would otherwise stop at the removed node
+	for _, n := range unsafe {
+		n.Parent().ReplaceChild(n.Parent(), n, ast.NewString(n.Label(source)))
+	}
+}
+
+// Relative URLs are allowed, absolute ones only with one of the given
+// schemes. The destination is checked as the browser will see it, with
+// backslash escapes and character references resolved as the renderer
+// resolves them.
+func allowedURL(dest []byte, schemes ...string) bool {
+	dest = util.UnescapePunctuations(dest)
+	dest = util.ResolveNumericReferences(dest)
+	dest = util.ResolveEntityNames(dest)
+
+	u, err := url.Parse(string(dest))
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		return true
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var urlAttr = regexp.MustCompile(`(?:href|src)="([^"]*)"`)
+
+// The URLs a browser would follow or load from rendered HTML, as it reads
+// them: references resolved and tabs and newlines removed
+func renderedURLs(rendered string) []string {
+	var urls []string
+	for _, m := range urlAttr.FindAllStringSubmatch(rendered, -1) {
+		u := strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return -1
+			}
+			return r
+		}, html.UnescapeString(m[1]))
+		urls = append(urls, strings.TrimSpace(u))
+	}
+	return urls
+}
+
+func TestRenderDropsUnsafeURLs(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"link", "[a](javascript:alert(1))"},
+		{"mixed case scheme", "[a](JavaScript:alert(1))"},
+		{"numeric reference", "[a](javascript&#58;alert(1))"},
+		{"hex reference", "![i](javascript&#x3A;alert(1))"},
+		{"named reference", "[a](JavaScript&colon;alert(1))"},
+		{"escaped colon", `[a](javascript\:alert(1))`},
+		{"tab in scheme", "[a](java&#9;script:alert(1))"},
+		{"data image", "![i](data:image/svg+xml;base64,PHN2Zz4=)"},
+		{"vbscript", "[a](VBScript:msgbox(1))"},
+		{"reference definition", "[a][x]\n\n[x]: javascript&#58;alert(1)"},
+		{"image reference definition", "![i][x]\n\n[x]: JAVASCRIPT&colon;alert(1)"},
+		{"autolink", "<javascript:alert(1)>"},
+		{"raw HTML", `<a href="javascript:alert(1)">a</a>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range renderedURLs(rendered) {
+				if strings.Contains(u, ":") {
+					t.Errorf("Render(%q) = %q, links to %q", tt.source, rendered, u)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderKeepsSafeURLs(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"[walk](https://example.com/ben-nevis)", `<a href="https://example.com/ben-nevis" rel="nofollow ugc noopener">walk</a>`},
+		{"[walk](HTTPS://example.com/)", `<a href="HTTPS://example.com/" rel="nofollow ugc noopener">walk</a>`},
+		{"[mail](mailto:walker@example.com)", `<a href="mailto:walker@example.com" rel="nofollow ugc noopener">mail</a>`},
+		{"[route](/munros/1)", `<a href="/munros/1" rel="nofollow ugc noopener">route</a>`},
+		{"![summit](https://example.com/summit.jpg)", `<img src="https://example.com/summit.jpg" alt="summit">`},
+		{"<https://example.com/>", `<a href="https://example.com/" rel="nofollow ugc noopener">https://example.com/</a>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			rendered, err := Render(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(rendered, tt.want) {
+				t.Errorf("Render(%q) = %q, want it to contain %q", tt.source, rendered, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package metrics collects the server's Prometheus metrics and serves them
+// for scraping
+package metrics
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/AlexM141200/munros-api/src/dataset"
+	"github.com/AlexM141200/munros-api/src/middleware"
+)
+
+const namespace = "munromark"
+
+// Metrics holds the server's metrics in a registry of its own, so separate
+// servers, e.g. in tests, don't share counts
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	responseBytes *prometheus.HistogramVec
+}
+
+// New returns metrics with the HTTP and Go runtime ones registered
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests answered, by method, route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to answer requests, by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		responseBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_response_size_bytes",
+			Help:      "Size of response bodies as sent, after any compression, by method and route pattern.",
+			// 64B to 16MB. The full catalogue is around 400KB, or 65KB gzipped;
+			// errors and 304s are a few hundred bytes or nothing.
+			Buckets: prometheus.ExponentialBuckets(64, 4, 10),
+		}, []string{"method", "route"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.responseBytes,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// ObserveRequest records an answered request. route is the pattern it
+// matched, so hill IDs and the like don't each get their own series.
+func (m *Metrics) ObserveRequest(method, route string, status int, bytes int64, took time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(method, route).Observe(took.Seconds())
+	m.responseBytes.WithLabelValues(method, route).Observe(float64(bytes))
+}
+
+// WatchDataset adds the catalogue's figures, read from ds at each scrape
+func (m *Metrics) WatchDataset(ds *dataset.Dataset) {
+	m.registry.MustRegister(&datasetCollector{ds: ds})
+}
+
+// Handler serves the metrics in the Prometheus text format. With a token,
+// scrapers must send it as "Authorization: Bearer <token>".
+func (m *Metrics) Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return metrics
+	}
+
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{
+				"code":       "unauthorized",
+				"message":    "A valid metrics token is required",
+				"request_id": middleware.RequestIDFrom(r.Context()),
+			})
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+var (
+	datasetLoadSeconds = prometheus.NewDesc(namespace+"_dataset_load_duration_seconds",
+		"Time taken by the last successful load of the hill catalogue.", nil, nil)
+	datasetLoadedAt = prometheus.NewDesc(namespace+"_dataset_last_load_timestamp_seconds",
+		"When the hill catalogue was last loaded, as a Unix time.", nil, nil)
+	datasetLoads = prometheus.NewDesc(namespace+"_dataset_loads_total",
+		"Loads of the hill catalogue, by result.", []string{"result"}, nil)
+	datasetHills = prometheus.NewDesc(namespace+"_dataset_hills",
+		"Hills in the catalogue, by classification.", []string{"classification"}, nil)
+	cacheRequests = prometheus.NewDesc(namespace+"_cache_requests_total",
+		"Reads from in-memory caches, by cache and whether they were answered from memory.", []string{"cache", "result"}, nil)
+)
+
+// Reports the catalogue's figures as they are when scraped
+type datasetCollector struct {
+	ds *dataset.Dataset
+}
+
+func (c *datasetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- datasetLoadSeconds
+	ch <- datasetLoadedAt
+	ch <- datasetLoads
+	ch <- datasetHills
+	ch <- cacheRequests
+}
+
+func (c *datasetCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.ds.Stats()
+
+	if stats.Loaded {
+		ch <- prometheus.MustNewConstMetric(datasetLoadSeconds, prometheus.GaugeValue, stats.LoadDuration.Seconds())
+		ch <- prometheus.MustNewConstMetric(datasetLoadedAt, prometheus.GaugeValue, float64(stats.LoadedAt.UnixNano())/1e9)
+	}
+	ch <- prometheus.MustNewConstMetric(datasetLoads, prometheus.CounterValue, float64(stats.Loads), "success")
+	ch <- prometheus.MustNewConstMetric(datasetLoads, prometheus.CounterValue, float64(stats.LoadErrors), "error")
+	for classification, n := range stats.Classifications {
+		ch <- prometheus.MustNewConstMetric(datasetHills, prometheus.GaugeValue, float64(n), classification)
+	}
+	ch <- prometheus.MustNewConstMetric(cacheRequests, prometheus.CounterValue, float64(stats.Hits), "dataset", "hit")
+	ch <- prometheus.MustNewConstMetric(cacheRequests, prometheus.CounterValue, float64(stats.Misses), "dataset", "miss")
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions says which other sites' pages may call the API
+type CORSOptions struct {
+	// Origins allowed to make requests, e.g. "https://example.com", or "*"
+	// for any
+	AllowedOrigins []string
+	// Whether browsers may send cookies and read responses to them. Can't be
+	// combined with "*".
+	AllowCredentials bool
+	// How long browsers may cache the answer to a preflight request
+	MaxAge time.Duration
+}
+
+const (
+	corsMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsHeaders = "Content-Type, Authorization, X-API-Key, " + RequestIDHeader
+	// Response headers scripts may read besides the simple ones
+	corsExposed = "RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, " + RequestIDHeader
+)
+
+// CORS answers preflight requests and adds the Access-Control headers to
+// responses for allowed origins. Requests from other origins are served
+// without them, so browsers keep the response from the page.
+func CORS(opts CORSOptions) Middleware {
+	anyOrigin := false
+	allowed := make(map[string]bool)
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin != "" && (anyOrigin || allowed[origin]) {
+				if anyOrigin && !opts.AllowCredentials {
+					header.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					header.Set("Access-Control-Allow-Origin", origin)
+				}
+				if opts.AllowCredentials {
+					header.Set("Access-Control-Allow-Credentials", "true")
+				}
+
+				if preflight {
+					header.Set("Access-Control-Allow-Methods", corsMethods)
+					header.Set("Access-Control-Allow-Headers", corsHeaders)
+					header.Set("Access-Control-Max-Age", maxAge)
+				} else {
+					header.Set("Access-Control-Expose-Headers", corsExposed)
+				}
+			}
+
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
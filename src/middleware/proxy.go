@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientKey struct{}
+
+// What's known of the client beyond the connection the request came in on
+type client struct {
+	ip    string
+	https bool
+}
+
+// ParseProxies reads proxy addresses, each an IP or a CIDR range
+func ParseProxies(addrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, addr := range addrs {
+		if prefix, err := netip.ParsePrefix(addr); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		ip, err := netip.ParseAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", addr)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Proxies takes the client's address and scheme from the X-Forwarded-For
+// and X-Forwarded-Proto headers of requests that come through one of the
+// trusted proxies. Anyone can send the headers, so they're ignored on
+// requests from elsewhere, and when no proxies are trusted.
+//
+// ClientIP and IsHTTPS report the result; they're the only places handlers
+// should look.
+func Proxies(trusted []netip.Prefix) Middleware {
+	isTrusted := func(addr string) bool {
+		ip, err := netip.ParseAddr(strings.TrimSpace(addr))
+		if err != nil {
+			return false
+		}
+		ip = ip.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(trusted) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isTrusted(remoteIP(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c := client{ip: remoteIP(r), https: r.TLS != nil}
+			// Each proxy appends the address it was reached from, so the
+			// client is the last one that isn't a trusted proxy
+			var hops []string
+			for _, header := range r.Header.Values("X-Forwarded-For") {
+				hops = append(hops, strings.Split(header, ",")...)
+			}
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if _, err := netip.ParseAddr(hop); err != nil {
+					break
+				}
+				c.ip = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+			if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); proto != "" {
+				c.https = strings.EqualFold(strings.TrimSpace(proto), "https")
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientKey{}, c)))
+		})
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP is the address of the client that made r: its connection's,
+// unless it came through a trusted proxy
+func ClientIP(r *http.Request) string {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.ip
+	}
+	return remoteIP(r)
+}
+
+// IsHTTPS says whether the client used HTTPS, either to this server or to
+// a trusted proxy in front of it
+func IsHTTPS(r *http.Request) bool {
+	if c, ok := r.Context().Value(clientKey{}).(client); ok {
+		return c.https
+	}
+	return r.TLS != nil
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// API key scopes
+const (
+	ScopeCatalogueRead = "catalogue:read"
+	ScopeAscentsRead   = "ascents:read"
+	ScopeAscentsWrite  = "ascents:write"
+	ScopeAdmin         = "admin"
+)
+
+var Scopes = []string{ScopeCatalogueRead, ScopeAscentsRead, ScopeAscentsWrite, ScopeAdmin}
+
+// APIKey lets a third-party app call the API on a user's behalf, limited to
+// its scopes and rate quota
+type APIKey struct {
+	ID     int64    `json:"id"`
+	UserID int64    `json:"user_id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"` // the start of the key, to tell keys apart
+	Scopes []string `json:"scopes"`
+	// Quota: the key's bucket holds Burst requests and refills at
+	// RatePerMinute
+	RatePerMinute int        `json:"rate_per_minute"`
+	Burst         int        `json:"burst"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	// Key is only returned when the key is created
+	Key string `json:"key,omitempty"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyUsage counts a key's requests on one day (UTC)
+type APIKeyUsage struct {
+	Day      string `json:"day"` // YYYY-MM-DD
+	Requests int    `json:"requests"`
+	// Limited is how many requests were refused by the rate limit
+	Limited int `json:"limited"`
+}
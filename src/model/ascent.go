@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Ascent sources
+const (
+	AscentSourceManual = "manual"
+	AscentSourceTrack  = "track"
+)
+
+// Who can see an ascent besides the climber. Followers-only ascents are
+// shown in the feeds of the climber's followers; private ones only count
+// towards the climber's own progress.
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityPrivate   = "private"
+)
+
+var Visibilities = []string{VisibilityPublic, VisibilityFollowers, VisibilityPrivate}
+
+type Ascent struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	MunroID    int       `json:"munro_id"` // DoBIH number
+	ClimbedAt  time.Time `json:"climbed_at"`
+	Notes      string    `json:"notes"`
+	Source     string    `json:"source"`
+	Visibility string    `json:"visibility"`
+	CreatedAt  time.Time `json:"created_at"`
+}
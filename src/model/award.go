@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Award is an achievement earned by a user
+type Award struct {
+	UserID        int64     `json:"user_id"`
+	AchievementID string    `json:"achievement_id"`
+	Group         string    `json:"group,omitempty"` // SMC section or map sheet for grouped achievements
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	AwardedAt     time.Time `json:"awarded_at"`
+	// Who can see the award: the widest visibility of ascents that earn it
+	Visibility string `json:"visibility,omitempty"`
+}
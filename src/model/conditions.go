@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+// Snow cover on a condition report
+const (
+	SnowNone    = "none"
+	SnowPatchy  = "patchy"
+	SnowCovered = "covered"
+)
+
+// Path state on a condition report
+const (
+	PathGood   = "good"
+	PathWet    = "wet"
+	PathEroded = "eroded"
+	PathIcy    = "icy"
+)
+
+// River crossings on a condition report
+const (
+	RiverEasy       = "easy"
+	RiverHigh       = "high"
+	RiverImpassable = "impassable"
+)
+
+// Rating is one user's scores for a hill, each from 1 to 5
+type Rating struct {
+	UserID     int64     `json:"user_id"`
+	MunroID    int       `json:"munro_id"` // DoBIH number
+	Scenery    int       `json:"scenery"`
+	Difficulty int       `json:"difficulty"`
+	Navigation int       `json:"navigation"`
+	Bogginess  int       `json:"bogginess"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// HillRatings is the community average for a hill
+type HillRatings struct {
+	MunroID    int     `json:"munro_id"`
+	Count      int     `json:"count"`
+	Scenery    float64 `json:"scenery"`
+	Difficulty float64 `json:"difficulty"`
+	Navigation float64 `json:"navigation"`
+	Bogginess  float64 `json:"bogginess"`
+}
+
+// ConditionReport records what a hill was like on a given day. Fields left
+// empty weren't observed.
+type ConditionReport struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	AuthorName     string    `json:"author_name"`
+	MunroID        int       `json:"munro_id"`
+	ObservedOn     string    `json:"observed_on"` // YYYY-MM-DD
+	SnowCover      string    `json:"snow_cover,omitempty"`
+	Path           string    `json:"path,omitempty"`
+	RiverCrossings string    `json:"river_crossings,omitempty"`
+	Notes          string    `json:"notes"`
+	Moderation     string    `json:"moderation"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Weight is how much the report still counts, from 1 when fresh down to
+	// 0 when expired; filled in by the API
+	Weight float64 `json:"weight"`
+}
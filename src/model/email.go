@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Purposes of the single-use links sent by email
+const (
+	EmailTokenVerify = "verify"
+	EmailTokenReset  = "reset"
+)
+
+// EmailToken is a link sent to a user's address. It is looked up by the
+// hash of the token and only valid for the address it was sent to.
+type EmailToken struct {
+	UserID    int64
+	Purpose   string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// EmailPreferences are the optional emails a user has chosen to receive
+type EmailPreferences struct {
+	WeeklyDigest bool `json:"weekly_digest"`
+	TripAlerts   bool `json:"trip_alerts"`
+}
+
+// FriendAscent is an ascent shown to the people who climb with its author
+type FriendAscent struct {
+	Ascent
+	DisplayName string `json:"display_name"`
+}
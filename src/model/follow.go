@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// Follow is a user someone follows, or a follower of theirs
+type Follow struct {
+	UserID      int64     `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	Since       time.Time `json:"since"`
+}
+
+// Kinds of feed item
+const (
+	FeedAscent      = "ascent"
+	FeedAchievement = "achievement"
+	FeedReport      = "report"
+)
+
+// FeedItem is one thing a followed user did. Exactly one of Ascent, Report
+// and Award is set, according to Type.
+type FeedItem struct {
+	Type        string    `json:"type"`
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	At          time.Time `json:"at"`
+	Ascent      *Ascent   `json:"ascent,omitempty"`
+	Report      *Report   `json:"report,omitempty"`
+	Award       *Award    `json:"achievement,omitempty"`
+}
+
+// FeedCursor is the position of the last item on a page of the feed. The
+// feed is ordered newest first by At, then Type and ID.
+type FeedCursor struct {
+	At   time.Time `json:"at"`
+	Type string    `json:"type"`
+	ID   int64     `json:"id"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Identity links a user to an account with an external sign-in provider
+type Identity struct {
+	UserID    int64     `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"` // the provider's stable user ID
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PendingLogin is a sign-in that has been sent to a provider and not yet
+// come back. It is looked up by the hash of the state parameter.
+type PendingLogin struct {
+	StateHash string
+	Provider  string
+	Nonce     string
+	Verifier  string // PKCE code verifier
+	Next      string // local path to return to afterwards
+	ExpiresAt time.Time
+}
@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+// Moderation status of user-generated content. Only approved content is
+// shown to other users.
+const (
+	ModerationPending  = "pending"
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+	ModerationHidden   = "hidden"
+)
+
+// Kinds of content that can be moderated
+const (
+	ContentReport    = "report"
+	ContentPhoto     = "photo"
+	ContentCondition = "condition"
+	ContentUser      = "user" // for role changes in the audit log
+)
+
+// Moderator actions
+const (
+	ActionApprove = "approve"
+	ActionReject  = "reject"
+	ActionHide    = "hide"
+	ActionSetRole = "set_role"
+)
+
+// Flag is a user's report of another user's content
+type Flag struct {
+	ID          int64      `json:"id"`
+	ReporterID  int64      `json:"reporter_id"`
+	ContentType string     `json:"content_type"`
+	ContentID   int64      `json:"content_id"`
+	Reason      string     `json:"reason"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// QueueItem is content awaiting a moderator: new posts held for review, and
+// anything with unresolved flags
+type QueueItem struct {
+	ContentType string    `json:"content_type"`
+	ContentID   int64     `json:"content_id"`
+	AuthorID    int64     `json:"author_id"`
+	AuthorName  string    `json:"author_name"`
+	MunroID     int       `json:"munro_id,omitempty"`
+	Summary     string    `json:"summary"`
+	Moderation  string    `json:"moderation"`
+	Flags       int       `json:"flags"`
+	Reasons     []string  `json:"reasons"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ModerationAction is an entry in the moderators' audit log
+type ModerationAction struct {
+	ID            int64     `json:"id"`
+	ModeratorID   int64     `json:"moderator_id"`
+	ModeratorName string    `json:"moderator_name"`
+	Action        string    `json:"action"`
+	ContentType   string    `json:"content_type"`
+	ContentID     int64     `json:"content_id"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at"`
+}
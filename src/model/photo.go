@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Photo is an uploaded summit photo. The files themselves live in a blob
+// store; the URLs are filled in by the API.
+type Photo struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	AuthorName   string     `json:"author_name"`
+	MunroID      int        `json:"munro_id"` // DoBIH number
+	Caption      string     `json:"caption"`
+	Moderation   string     `json:"moderation"`
+	BlobKey      string     `json:"-"`
+	ContentType  string     `json:"content_type"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	Latitude     *float64   `json:"-"` // from EXIF; private to the uploader
+	Longitude    *float64   `json:"-"`
+	TakenAt      *time.Time `json:"taken_at,omitempty"`
+	URL          string     `json:"url"`
+	ThumbnailURL string     `json:"thumbnail_url"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Plan is a named trip or wishlist of hills
+type Plan struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id,omitempty"`
+	Name      string     `json:"name"`
+	StartDate string     `json:"start_date,omitempty"` // YYYY-MM-DD
+	EndDate   string     `json:"end_date,omitempty"`   // YYYY-MM-DD
+	Notes     string     `json:"notes"`
+	Hills     []PlanHill `json:"hills"`
+	// Shared is set while the plan has a share link. The link's token is
+	// only shown when it's made.
+	Shared    bool      `json:"shared"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PlanHill is one stop in a plan, in visiting order
+type PlanHill struct {
+	MunroID int    `json:"munro_id"` // DoBIH number
+	Notes   string `json:"notes"`
+	Munro   *Munro `json:"munro,omitempty"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const (
+	ReportStatusDraft     = "draft"
+	ReportStatusPublished = "published"
+)
+
+// Report is a trip report, written in Markdown, about one or more hills
+type Report struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	AuthorName  string     `json:"author_name"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"` // Markdown
+	HTML        string     `json:"html,omitempty"`
+	Status      string     `json:"status"`
+	Moderation  string     `json:"moderation"`
+	ClimbedOn   string     `json:"climbed_on,omitempty"` // YYYY-MM-DD
+	MunroIDs    []int      `json:"munro_ids"`            // DoBIH numbers
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+}
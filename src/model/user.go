@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type User struct {
+	ID           int64     `json:"id"`
+	Email        string    `json:"email"`
+	DisplayName  string    `json:"display_name"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+	// EmailVerified is set once the user has followed a link sent to their
+	// address, or signed in through a provider that vouches for it
+	EmailVerified bool `json:"email_verified"`
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
@@ -0,0 +1,323 @@
+// Package notify sends MunroMark's own emails: account verification and
+// password resets when they're asked for, and the weekly digest of friends'
+// ascents and upcoming trip alerts on a schedule
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	_ "time/tzdata" // schedules follow UK time wherever the server runs
+
+	"github.com/a-h/templ"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/mail"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+	templates "github.com/AlexM141200/munros-api/src/views"
+)
+
+const (
+	// VerifyTTL and ResetTTL are how long the links in those emails work
+	VerifyTTL = 48 * time.Hour
+	ResetTTL  = time.Hour
+	// A user can't be sent another link of the same kind sooner than this
+	resendInterval = time.Minute
+
+	// Trips are alerted this many days before they start
+	TripAlertDays = 3
+	// Digests go out from Monday morning, covering the week before
+	digestDay  = time.Monday
+	digestHour = 8
+	// How often the scheduled emails are checked for
+	checkInterval = time.Hour
+)
+
+// Kinds of scheduled email, as recorded so each goes out once
+const (
+	kindDigest    = "digest"
+	kindTripAlert = "trip_alert"
+)
+
+// ErrTooSoon is returned when a link was sent to the user moments ago
+var ErrTooSoon = errors.New("an email was sent moments ago")
+
+var ukTime, _ = time.LoadLocation("Europe/London")
+
+// Catalogue supplies hill details for the emails
+type Catalogue interface {
+	ReadMunros() ([]model.Munro, error)
+}
+
+type Notifier struct {
+	store     *store.Store
+	mailer    mail.Mailer
+	catalogue Catalogue
+	// siteURL is the public address links in emails point to, without a
+	// trailing slash
+	siteURL string
+	now     func() time.Time
+}
+
+func New(s *store.Store, mailer mail.Mailer, catalogue Catalogue, siteURL string) *Notifier {
+	return &Notifier{
+		store:     s,
+		mailer:    mailer,
+		catalogue: catalogue,
+		siteURL:   strings.TrimSuffix(siteURL, "/"),
+		now:       time.Now,
+	}
+}
+
+// SendVerification emails the user a link confirming their address
+func (n *Notifier) SendVerification(ctx context.Context, user *model.User) error {
+	link, err := n.newLink(user, model.EmailTokenVerify, VerifyTTL, "/auth/verify")
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Hi %s,\n\nPlease confirm that this is your email address so we can send you digests, trip alerts and password resets:\n\n%s\n\nThe link expires in 48 hours. If you didn't create a MunroMark account, you can ignore this email.\n",
+		user.DisplayName, link)
+	return n.send(ctx, user, "Confirm your MunroMark email address",
+		templates.VerifyEmail(user.DisplayName, link, n.siteURL), text)
+}
+
+// SendPasswordReset emails the user a link to choose a new password
+func (n *Notifier) SendPasswordReset(ctx context.Context, user *model.User) error {
+	link, err := n.newLink(user, model.EmailTokenReset, ResetTTL, "/auth/reset")
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your MunroMark account. Follow this link to choose a new one:\n\n%s\n\nThe link expires in an hour. If you didn't ask for this, you can ignore this email and your password won't change.\n",
+		user.DisplayName, link)
+	return n.send(ctx, user, "Reset your MunroMark password",
+		templates.PasswordReset(user.DisplayName, link, n.siteURL), text)
+}
+
+// Store a single-use token for the user's current address and return the
+// link carrying it
+func (n *Notifier) newLink(user *model.User, purpose string, ttl time.Duration, path string) (string, error) {
+	last, err := n.store.LastEmailTokenAt(user.ID, purpose)
+	if err != nil {
+		return "", err
+	}
+	if n.now().Sub(last) < resendInterval {
+		return "", ErrTooSoon
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		return "", err
+	}
+	if err := n.store.CreateEmailToken(auth.HashToken(token), &model.EmailToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		ExpiresAt: n.now().Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return n.siteURL + path + "?token=" + token, nil
+}
+
+func (n *Notifier) send(ctx context.Context, user *model.User, subject string, html templ.Component, text string) error {
+	var b strings.Builder
+	if err := html.Render(ctx, &b); err != nil {
+		return err
+	}
+	return n.mailer.Send(ctx, mail.Message{To: user.Email, Subject: subject, HTML: b.String(), Text: text})
+}
+
+// Run sends the scheduled emails as they fall due until ctx is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		now := n.now()
+		if err := n.SendDigests(ctx, now); err != nil {
+			slog.Error("Error sending digests", "err", err)
+		}
+		if err := n.SendTripAlerts(ctx, now); err != nil {
+			slog.Error("Error sending trip alerts", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// The start of the digest week containing t: Monday morning, UK time
+func digestWeekStart(t time.Time) time.Time {
+	t = t.In(ukTime)
+	daysSince := (int(t.Weekday()) - int(digestDay) + 7) % 7
+	start := time.Date(t.Year(), t.Month(), t.Day()-daysSince, digestHour, 0, 0, 0, ukTime)
+	if start.After(t) {
+		start = start.AddDate(0, 0, -7)
+	}
+	return start
+}
+
+// SendDigests sends this week's digest to each user who wants one and
+// hasn't had it yet. Users whose friends climbed nothing get no email.
+func (n *Notifier) SendDigests(ctx context.Context, now time.Time) error {
+	weekStart := digestWeekStart(now)
+	year, week := weekStart.ISOWeek()
+	ref := fmt.Sprintf("%d-W%02d", year, week)
+
+	users, err := n.store.ListDigestRecipients()
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	hills, err := n.hills()
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		user := &users[i]
+		claimed, err := n.store.ClaimEmail(user.ID, kindDigest, ref)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		ascents, err := n.store.ListFriendAscents(user.ID, weekStart.AddDate(0, 0, -7))
+		if err != nil {
+			return err
+		}
+		var entries []templates.DigestEntry
+		for _, a := range ascents {
+			if !a.CreatedAt.Before(weekStart) {
+				continue
+			}
+			munro, ok := hills[a.MunroID]
+			if !ok {
+				continue
+			}
+			entries = append(entries, templates.DigestEntry{
+				Climber:   a.DisplayName,
+				Hill:      munro.Name,
+				HeightM:   munro.HeightM,
+				ClimbedAt: a.ClimbedAt,
+				Notes:     a.Notes,
+				Link:      n.hillLink(munro.DoBIHNumber),
+			})
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		var text strings.Builder
+		fmt.Fprintf(&text, "Hi %s, here's what your friends have climbed this week.\n\n", user.DisplayName)
+		for _, e := range entries {
+			fmt.Fprintf(&text, "- %s climbed %s (%.0fm) on %s\n", e.Climber, e.Hill, e.HeightM, e.ClimbedAt.Format("Monday 2 January"))
+			if e.Notes != "" {
+				fmt.Fprintf(&text, "  %s\n", e.Notes)
+			}
+		}
+		fmt.Fprintf(&text, "\n%s\n", n.siteURL)
+
+		if err := n.send(ctx, user, "Your week in the hills",
+			templates.WeeklyDigest(user.DisplayName, entries, n.siteURL), text.String()); err != nil {
+			slog.Error("Error sending digest", "user_id", user.ID, "err", err)
+			n.release(user.ID, kindDigest, ref)
+		}
+	}
+	return nil
+}
+
+// SendTripAlerts emails the owners of plans starting within the next few
+// days, once per plan and start date
+func (n *Notifier) SendTripAlerts(ctx context.Context, now time.Time) error {
+	today := now.In(ukTime)
+	from := today.Format("2006-01-02")
+	to := today.AddDate(0, 0, TripAlertDays).Format("2006-01-02")
+
+	plans, err := n.store.ListTripsStarting(from, to)
+	if err != nil {
+		return err
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+	hills, err := n.hills()
+	if err != nil {
+		return err
+	}
+
+	midnight := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	for i := range plans {
+		plan := &plans[i]
+		ref := fmt.Sprintf("%d:%s", plan.ID, plan.StartDate)
+		claimed, err := n.store.ClaimEmail(plan.UserID, kindTripAlert, ref)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		user, err := n.store.GetUser(plan.UserID)
+		if err != nil {
+			return err
+		}
+		start, _ := time.Parse("2006-01-02", plan.StartDate)
+		days := int(start.Sub(midnight).Hours() / 24)
+
+		var trip []templates.TripHill
+		var text strings.Builder
+		fmt.Fprintf(&text, "Hi %s,\n\n%s Here are the hills you've planned:\n\n", user.DisplayName,
+			templates.TripCountdown(plan.Name, plan.StartDate, days))
+		for _, h := range plan.Hills {
+			munro, ok := hills[h.MunroID]
+			if !ok {
+				continue
+			}
+			trip = append(trip, templates.TripHill{Name: munro.Name, HeightM: munro.HeightM, Link: n.hillLink(munro.DoBIHNumber)})
+			fmt.Fprintf(&text, "- %s (%.0fm) %s\n", munro.Name, munro.HeightM, n.hillLink(munro.DoBIHNumber))
+		}
+		text.WriteString("\nCheck the latest conditions reports and forecast before you set off.\n")
+
+		if err := n.send(ctx, user, plan.Name+" is coming up",
+			templates.TripAlert(user.DisplayName, plan.Name, plan.StartDate, days, trip, n.siteURL), text.String()); err != nil {
+			slog.Error("Error sending trip alert", "plan_id", plan.ID, "err", err)
+			n.release(plan.UserID, kindTripAlert, ref)
+		}
+	}
+	return nil
+}
+
+// Forget a claimed email that failed, so the next check tries again
+func (n *Notifier) release(userID int64, kind, ref string) {
+	if err := n.store.ReleaseEmail(userID, kind, ref); err != nil {
+		slog.Error("Error releasing email", "kind", kind, "user_id", userID, "err", err)
+	}
+}
+
+func (n *Notifier) hills() (map[int]model.Munro, error) {
+	munros, err := n.catalogue.ReadMunros()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]model.Munro, len(munros))
+	for _, m := range munros {
+		byID[m.DoBIHNumber] = m
+	}
+	return byID, nil
+}
+
+func (n *Notifier) hillLink(id int) string {
+	return fmt.Sprintf("%s/munros/%d", n.siteURL, id)
+}
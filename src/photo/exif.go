@@ -0,0 +1,207 @@
+package photo
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Metadata is the little we read from a photo's EXIF before discarding it
+type Metadata struct {
+	// Orientation is the EXIF orientation (1-8); 1 is upright
+	Orientation int
+	HasLocation bool
+	Latitude    float64
+	Longitude   float64
+	// TakenAt is zero when the camera didn't record it
+	TakenAt time.Time
+}
+
+const (
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagOffsetOriginal   = 0x9011
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+)
+
+// Bytes per component of each TIFF field type
+var typeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+var errBadTIFF = errors.New("malformed EXIF data")
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// parseExif reads the metadata we care about from a TIFF-structured EXIF
+// block (the body of a JPEG APP1 segment after "Exif\0\0", or a PNG eXIf chunk)
+func parseExif(data []byte) (Metadata, error) {
+	meta := Metadata{Orientation: 1}
+	if len(data) < 8 {
+		return meta, errBadTIFF
+	}
+
+	t := tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return meta, errBadTIFF
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return meta, errBadTIFF
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:]))
+	if err != nil {
+		return meta, err
+	}
+
+	if e, ok := ifd0[tagOrientation]; ok && e.typ == 3 && e.count >= 1 {
+		if o := int(t.order.Uint16(e.value)); o >= 1 && o <= 8 {
+			meta.Orientation = o
+		}
+	}
+
+	if e, ok := ifd0[tagExifIFD]; ok && e.typ == 4 {
+		if exif, err := t.readIFD(t.order.Uint32(e.value)); err == nil {
+			meta.TakenAt = takenAt(exif)
+		}
+	}
+
+	if e, ok := ifd0[tagGPSIFD]; ok && e.typ == 4 {
+		if gps, err := t.readIFD(t.order.Uint32(e.value)); err == nil {
+			lat, latOK := t.degrees(gps[tagGPSLatitude])
+			lon, lonOK := t.degrees(gps[tagGPSLongitude])
+			if latOK && lonOK {
+				if ascii(gps[tagGPSLatitudeRef]) == "S" {
+					lat = -lat
+				}
+				if ascii(gps[tagGPSLongitudeRef]) == "W" {
+					lon = -lon
+				}
+				// 0,0 is what some cameras write when they have no fix
+				if lat != 0 || lon != 0 {
+					meta.HasLocation, meta.Latitude, meta.Longitude = true, lat, lon
+				}
+			}
+		}
+	}
+
+	return meta, nil
+}
+
+func (t tiff) readIFD(offset uint32) (map[uint16]ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, errBadTIFF
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(t.data) {
+		return nil, errBadTIFF
+	}
+
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		raw := t.data[start+i*12 : start+(i+1)*12]
+		tag := t.order.Uint16(raw)
+		e := ifdEntry{typ: t.order.Uint16(raw[2:]), count: t.order.Uint32(raw[4:])}
+
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		length := uint64(size) * uint64(e.count)
+		if length <= 4 {
+			e.value = raw[8 : 8+length]
+		} else {
+			off := uint64(t.order.Uint32(raw[8:]))
+			if off+length > uint64(len(t.data)) {
+				continue
+			}
+			e.value = t.data[off : off+length]
+		}
+		entries[tag] = e
+	}
+
+	return entries, nil
+}
+
+// Convert a degrees/minutes/seconds triple of rationals to decimal degrees
+func (t tiff) degrees(e ifdEntry) (float64, bool) {
+	if e.typ != 5 || e.count != 3 {
+		return 0, false
+	}
+
+	var parts [3]float64
+	for i := range parts {
+		num := t.order.Uint32(e.value[i*8:])
+		den := t.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			if num != 0 {
+				return 0, false
+			}
+			continue
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
+
+func ascii(e ifdEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimRight(string(e.value), "\x00 ")
+}
+
+// EXIF times are local to the camera; the offset tag, when present, pins them
+// down. Without it we assume UK time, where almost every photo here is taken.
+func takenAt(exif map[uint16]ifdEntry) time.Time {
+	value := ascii(exif[tagDateTimeOriginal])
+	if value == "" {
+		return time.Time{}
+	}
+
+	if offset := ascii(exif[tagOffsetOriginal]); offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return t.UTC()
+		}
+	}
+
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", value, ukTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+// orientationExif builds a minimal EXIF block holding only the orientation,
+// so that stripped photos still display the right way up
+func orientationExif(orientation int) []byte {
+	b := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08")
+	b = binary.BigEndian.AppendUint16(b, 1) // one entry
+	b = binary.BigEndian.AppendUint16(b, tagOrientation)
+	b = binary.BigEndian.AppendUint16(b, 3) // SHORT
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(orientation))
+	b = binary.BigEndian.AppendUint16(b, 0) // padding
+	b = binary.BigEndian.AppendUint32(b, 0) // no next IFD
+	return b
+}
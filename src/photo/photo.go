@@ -0,0 +1,321 @@
+// Package photo prepares uploaded photos for publishing: it reads their
+// location, strips identifying metadata and generates thumbnails.
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	_ "image/png" // registered for image.Decode
+	"time"
+	_ "time/tzdata" // EXIF times are interpreted as UK time wherever the server runs
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSize is the longest side of a thumbnail in pixels
+const ThumbnailSize = 480
+
+// MaxPixels bounds the decoded size of an upload, so a small file can't
+// expand into gigabytes of pixels
+const MaxPixels = 64_000_000
+
+var ErrUnsupported = errors.New("photo must be a JPEG or PNG image")
+
+var ukTime, _ = time.LoadLocation("Europe/London")
+
+// Photo is an upload ready to store
+type Photo struct {
+	// Original is the uploaded file with metadata removed
+	Original    []byte
+	ContentType string
+	// Thumbnail is a JPEG, already rotated upright
+	Thumbnail []byte
+	// Width and Height are as displayed, after orientation is applied
+	Width  int
+	Height int
+	Meta   Metadata
+}
+
+// Process reads a JPEG or PNG upload's metadata, strips it and renders a
+// thumbnail
+func Process(data []byte) (*Photo, error) {
+	var p Photo
+	var err error
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		p.ContentType = "image/jpeg"
+		p.Original, p.Meta, err = stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		p.ContentType = "image/png"
+		p.Original, p.Meta, err = stripPNG(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(p.Original))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("image is too large (%dx%d)", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(p.Original))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	p.Width, p.Height = cfg.Width, cfg.Height
+	if p.Meta.Orientation >= 5 {
+		p.Width, p.Height = cfg.Height, cfg.Width
+	}
+
+	// Scaling first means only the thumbnail's pixels are turned upright
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, orient(thumbnail(img, ThumbnailSize), p.Meta.Orientation), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	p.Thumbnail = thumb.Bytes()
+
+	return &p, nil
+}
+
+// Scale an image so its longest side is at most size pixels
+func thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		size = max(w, h)
+	}
+
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// Apply an EXIF orientation so the image is upright
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 anticlockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// stripJPEG removes every application segment but JFIF, Adobe and the ICC
+// profile from a JPEG, along with comments and anything after its image,
+// returning what EXIF said first. Orientation is kept in a fresh EXIF block.
+func stripJPEG(data []byte) ([]byte, Metadata, error) {
+	meta := Metadata{Orientation: 1}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	var kept [][]byte
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, meta, errors.New("invalid JPEG")
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // fill byte
+			pos++
+			continue
+		}
+
+		// Start of scan: the rest is image data
+		if marker == 0xDA {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, meta, errors.New("invalid JPEG")
+		}
+		segment := data[pos:end]
+		body := segment[4:]
+		pos = end
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(body, []byte("Exif\x00\x00")):
+			if m, err := parseExif(body[6:]); err == nil {
+				meta = m
+			}
+		case marker == 0xE2 && !bytes.HasPrefix(body, []byte("ICC_PROFILE\x00")):
+			// APP2 is the colour profile, which is kept, or MPF and gain map
+			// data describing images after the end of this one, which aren't
+		case marker >= 0xE1 && marker <= 0xEF && marker != 0xE2 && marker != 0xEE, marker == 0xFE:
+			// XMP, IPTC, maker notes and comments can all carry names and
+			// places. Decoding needs none of them, only JFIF (APP0) and
+			// Adobe's colour transform (APP14)
+		default:
+			kept = append(kept, segment)
+		}
+	}
+
+	// EXIF belongs straight after SOI (or the JFIF header)
+	if len(kept) > 0 && kept[0][1] == 0xE0 {
+		out.Write(kept[0])
+		kept = kept[1:]
+	}
+	if meta.Orientation > 1 {
+		exif := orientationExif(meta.Orientation)
+		out.Write([]byte{0xFF, 0xE1})
+		out.Write(binary.BigEndian.AppendUint16(nil, uint16(len(exif)+2)))
+		out.Write(exif)
+	}
+	for _, segment := range kept {
+		out.Write(segment)
+	}
+
+	// Phones append more after the image ends: the other pictures of a
+	// multi-picture file, a motion photo's video or an HDR gain map, each
+	// with metadata of its own. Only the first image is kept.
+	end, err := jpegEnd(data, pos)
+	if err != nil {
+		return nil, meta, err
+	}
+	out.Write(data[pos:end])
+
+	return out.Bytes(), meta, nil
+}
+
+// Find the end of a JPEG's image, given the position of its first start of
+// scan: just after the EOI marker that follows the scans. Progressive
+// images have several scans, with tables between them.
+func jpegEnd(data []byte, pos int) (int, error) {
+	for pos+1 < len(data) {
+		if data[pos] != 0xFF {
+			pos++
+			continue
+		}
+
+		switch marker := data[pos+1]; {
+		case marker == 0xD9:
+			return pos + 2, nil
+		case marker == 0x00, marker == 0xFF, marker >= 0xD0 && marker <= 0xD7:
+			// A stuffed 0xFF byte in the scan data, a fill byte or a restart
+			// marker
+			pos++
+		default:
+			// A segment between scans, whose contents mustn't be mistaken
+			// for markers
+			if pos+4 > len(data) {
+				return 0, errors.New("invalid JPEG")
+			}
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			if length < 2 {
+				return 0, errors.New("invalid JPEG")
+			}
+			pos += 2 + length
+		}
+	}
+	return 0, errors.New("invalid JPEG: no end of image")
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Ancillary PNG chunks that can carry personal details
+var pngTextChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPNG removes text, time and EXIF chunks from a PNG, returning what
+// the EXIF chunk said first. As for JPEGs, orientation is kept.
+func stripPNG(data []byte) ([]byte, Metadata, error) {
+	meta := Metadata{Orientation: 1}
+	var chunks [][]byte
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, meta, errors.New("invalid PNG")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, meta, errors.New("invalid PNG")
+		}
+		kind := string(data[pos+4 : pos+8])
+
+		if kind == "eXIf" {
+			if m, err := parseExif(data[pos+8 : pos+8+length]); err == nil {
+				meta = m
+			}
+		}
+		if !pngTextChunks[kind] {
+			chunks = append(chunks, data[pos:end])
+		}
+
+		pos = end
+		if kind == "IEND" {
+			break
+		}
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for i, chunk := range chunks {
+		out.Write(chunk)
+		// eXIf must come before the image data, so put it straight after IHDR
+		if i == 0 && meta.Orientation > 1 {
+			writePNGChunk(out, "eXIf", orientationExif(meta.Orientation)[6:])
+		}
+	}
+
+	return out.Bytes(), meta, nil
+}
+
+func writePNGChunk(buf *bytes.Buffer, kind string, data []byte) {
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	buf.WriteString(kind)
+	buf.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	buf.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+}
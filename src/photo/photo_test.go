@@ -0,0 +1,271 @@
+package photo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+)
+
+// Ben Nevis summit, as a camera records it: 56°47'48.84"N 5°0'12.96"W
+const (
+	fixtureLat = 56.7969
+	fixtureLon = -5.0036
+)
+
+var fixtureTakenAt = time.Date(2024, 6, 21, 11, 30, 0, 0, time.UTC)
+
+// A TIFF block as cameras write it, with an orientation, the time the
+// photo was taken (in UK summer time) and a GPS position
+func fixtureTIFF(orientation int) []byte {
+	order := binary.BigEndian
+	entry := func(b []byte, tag, typ uint16, count, value uint32) []byte {
+		b = order.AppendUint16(b, tag)
+		b = order.AppendUint16(b, typ)
+		b = order.AppendUint32(b, count)
+		return order.AppendUint32(b, value)
+	}
+	rational := func(b []byte, num, den uint32) []byte {
+		return order.AppendUint32(order.AppendUint32(b, num), den)
+	}
+
+	// IFD0 at 8, with three entries: 2 + 3*12 + 4 bytes
+	const exifIFD, gpsIFD = 8 + 42, 8 + 42 + 18
+	// The Exif IFD has one entry pointing at the time, after the GPS IFD's
+	// four entries
+	const takenAt = gpsIFD + 2 + 4*12 + 4
+	const latitude = takenAt + 20
+	const longitude = latitude + 24
+
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	b = order.AppendUint16(b, 3)
+	b = entry(b, tagOrientation, 3, 1, uint32(orientation)<<16)
+	b = entry(b, tagExifIFD, 4, 1, exifIFD)
+	b = entry(b, tagGPSIFD, 4, 1, gpsIFD)
+	b = order.AppendUint32(b, 0)
+
+	b = order.AppendUint16(b, 1)
+	b = entry(b, tagDateTimeOriginal, 2, 20, takenAt)
+	b = order.AppendUint32(b, 0)
+
+	b = order.AppendUint16(b, 4)
+	b = entry(b, tagGPSLatitudeRef, 2, 2, uint32('N')<<24)
+	b = entry(b, tagGPSLatitude, 5, 3, latitude)
+	b = entry(b, tagGPSLongitudeRef, 2, 2, uint32('W')<<24)
+	b = entry(b, tagGPSLongitude, 5, 3, longitude)
+	b = order.AppendUint32(b, 0)
+
+	b = append(b, "2024:06:21 12:30:00\x00"...)
+	b = rational(rational(rational(b, 56, 1), 47, 1), 4884, 100)
+	b = rational(rational(rational(b, 5, 1), 0, 1), 1296, 100)
+	return b
+}
+
+// An image w by h, red on its left half and blue on its right
+func fixtureImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func segment(marker byte, body []byte) []byte {
+	b := []byte{0xFF, marker}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)+2))
+	return append(b, body...)
+}
+
+// A JPEG laid out as a phone writes a motion or HDR photo: EXIF with GPS,
+// XMP, a comment, a colour profile and an MPF index after SOI, and a second
+// JPEG after the first's EOI. Photoshop's IPTC, Adobe, Ducky and a vendor
+// APP15 segment are thrown in as an editor would add them.
+func fixtureJPEG(t *testing.T, w, h, orientation int) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, fixtureImage(w, h), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xD8})
+	b.Write(segment(0xE1, append([]byte("Exif\x00\x00"), fixtureTIFF(orientation)...)))
+	b.Write(segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>Fort William</x:xmpmeta>")))
+	b.Write(segment(0xFE, []byte("Summit selfie")))
+	b.Write(segment(0xE2, []byte("ICC_PROFILE\x00\x01\x01colour")))
+	b.Write(segment(0xE2, []byte("MPF\x00MM\x00\x2a\x00\x00\x00\x08")))
+	b.Write(segment(0xEC, []byte("Ducky\x00\x01\x00\x04\x00\x00\x00\x5a")))
+	b.Write(segment(0xED, []byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00\x00\x00\x00\x0f\x1c\x02\x5a\x00\x0bGlen Nevis")))
+	b.Write(segment(0xEE, []byte("Adobe\x00\x64\x00\x00\x00\x00\x01")))
+	b.Write(segment(0xEF, []byte("Vendor serial 12345")))
+	b.Write(encoded.Bytes()[2:])
+	// The secondary image, with GPS of its own
+	b.Write([]byte{0xFF, 0xD8})
+	b.Write(segment(0xE1, append([]byte("Exif\x00\x00"), fixtureTIFF(1)...)))
+	b.Write(encoded.Bytes()[2:])
+	return b.Bytes()
+}
+
+// A PNG with an eXIf chunk holding GPS, and text and time chunks
+func fixturePNG(t *testing.T, w, h, orientation int) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, fixtureImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+	// IHDR is always the first chunk, and 25 bytes long
+	ihdrEnd := len(pngSignature) + 25
+
+	var b bytes.Buffer
+	b.Write(data[:ihdrEnd])
+	writePNGChunk(&b, "eXIf", fixtureTIFF(orientation))
+	writePNGChunk(&b, "tEXt", []byte("Comment\x00Summit selfie"))
+	writePNGChunk(&b, "iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta>Fort William</x:xmpmeta>"))
+	writePNGChunk(&b, "tIME", []byte{0x07, 0xE8, 6, 21, 11, 30, 0})
+	b.Write(data[ihdrEnd:])
+	return b.Bytes()
+}
+
+func checkMeta(t *testing.T, meta Metadata, orientation int) {
+	t.Helper()
+
+	if meta.Orientation != orientation {
+		t.Errorf("orientation = %d, want %d", meta.Orientation, orientation)
+	}
+	if !meta.HasLocation || math.Abs(meta.Latitude-fixtureLat) > 1e-4 || math.Abs(meta.Longitude-fixtureLon) > 1e-4 {
+		t.Errorf("location = %v %f,%f, want %f,%f", meta.HasLocation, meta.Latitude, meta.Longitude, fixtureLat, fixtureLon)
+	}
+	if !meta.TakenAt.Equal(fixtureTakenAt) {
+		t.Errorf("taken at %v, want %v", meta.TakenAt, fixtureTakenAt)
+	}
+}
+
+// The stripped file has nothing left to read but the orientation
+func checkStripped(t *testing.T, original []byte, orientation int) {
+	t.Helper()
+
+	again, err := Process(original)
+	if err != nil {
+		t.Fatalf("processing the stripped file: %v", err)
+	}
+	if again.Meta.HasLocation || !again.Meta.TakenAt.IsZero() {
+		t.Errorf("stripped file still has metadata: %+v", again.Meta)
+	}
+	if again.Meta.Orientation != orientation {
+		t.Errorf("stripped file's orientation = %d, want %d", again.Meta.Orientation, orientation)
+	}
+	for _, s := range []string{"Fort William", "Summit selfie", "2024:06:21", "MPF", "Ducky", "Glen Nevis", "Vendor serial"} {
+		if bytes.Contains(original, []byte(s)) {
+			t.Errorf("stripped file still contains %q", s)
+		}
+	}
+}
+
+func TestProcessJPEG(t *testing.T) {
+	data := fixtureJPEG(t, 40, 20, 1)
+
+	p, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ContentType != "image/jpeg" {
+		t.Errorf("content type = %s", p.ContentType)
+	}
+	checkMeta(t, p.Meta, 1)
+	checkStripped(t, p.Original, 1)
+
+	if !bytes.Contains(p.Original, []byte("ICC_PROFILE")) {
+		t.Error("colour profile was removed")
+	}
+	if !bytes.Contains(p.Original, []byte("Adobe")) {
+		t.Error("Adobe colour transform was removed")
+	}
+	// Only the first image is kept
+	if n := bytes.Count(p.Original, []byte{0xFF, 0xD8, 0xFF}); n != 1 {
+		t.Errorf("stripped file has %d images, want 1", n)
+	}
+	if !bytes.HasSuffix(p.Original, []byte{0xFF, 0xD9}) {
+		t.Error("stripped file doesn't end at the first image's EOI")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(p.Original)); err != nil {
+		t.Errorf("stripped file doesn't decode: %v", err)
+	}
+}
+
+func TestProcessPNG(t *testing.T) {
+	data := fixturePNG(t, 40, 20, 1)
+
+	p, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ContentType != "image/png" {
+		t.Errorf("content type = %s", p.ContentType)
+	}
+	checkMeta(t, p.Meta, 1)
+	checkStripped(t, p.Original, 1)
+
+	if _, err := png.Decode(bytes.NewReader(p.Original)); err != nil {
+		t.Errorf("stripped file doesn't decode: %v", err)
+	}
+}
+
+func TestProcessOrientation(t *testing.T) {
+	fixtures := map[string]func(t *testing.T, w, h, orientation int) []byte{
+		"jpeg": fixtureJPEG,
+		"png":  fixturePNG,
+	}
+
+	for name, fixture := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			// Stored sideways; rotated 90° clockwise, the red half is on top
+			p, err := Process(fixture(t, 1200, 600, 6))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMeta(t, p.Meta, 6)
+			checkStripped(t, p.Original, 6)
+
+			if p.Width != 600 || p.Height != 1200 {
+				t.Errorf("size = %dx%d, want 600x1200", p.Width, p.Height)
+			}
+
+			thumb, err := jpeg.Decode(bytes.NewReader(p.Thumbnail))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := thumb.Bounds()
+			if b.Dx() != ThumbnailSize/2 || b.Dy() != ThumbnailSize {
+				t.Fatalf("thumbnail is %dx%d, want %dx%d", b.Dx(), b.Dy(), ThumbnailSize/2, ThumbnailSize)
+			}
+			top := thumb.At(b.Dx()/2, b.Dy()/4)
+			bottom := thumb.At(b.Dx()/2, b.Dy()*3/4)
+			if r, _, blue, _ := top.RGBA(); r < 0xC000 || blue > 0x4000 {
+				t.Errorf("thumbnail's top is %v, want red", top)
+			}
+			if r, _, blue, _ := bottom.RGBA(); blue < 0xC000 || r > 0x4000 {
+				t.Errorf("thumbnail's bottom is %v, want blue", bottom)
+			}
+		})
+	}
+}
+
+func TestProcessRejectsOtherFormats(t *testing.T) {
+	if _, err := Process([]byte("GIF89a")); err != ErrUnsupported {
+		t.Errorf("Process(GIF) = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,144 @@
+package progress
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+type LeaderboardEntry struct {
+	Rank        int    `json:"rank"`
+	UserID      int64  `json:"user_id"`
+	DisplayName string `json:"display_name"`
+	Bagged      int    `json:"bagged"`
+}
+
+// GroupProgress is a club's combined progress and leaderboards
+type GroupProgress struct {
+	Year         int                `json:"year"`
+	Members      int                `json:"members"`
+	Total        int                `json:"total"`
+	Bagged       int                `json:"bagged"` // Munros climbed by at least one member
+	TotalAscents int                `json:"total_ascents"`
+	ThisYear     []LeaderboardEntry `json:"this_year"`
+	AllTime      []LeaderboardEntry `json:"all_time"`
+}
+
+// FirstToBag records which member first climbed a hill
+type FirstToBag struct {
+	MunroID     int       `json:"munro_id"`
+	MunroName   string    `json:"munro_name"`
+	UserID      int64     `json:"user_id"`
+	DisplayName string    `json:"display_name"`
+	ClimbedAt   time.Time `json:"climbed_at"`
+}
+
+func munroSet(munros []model.Munro) map[int]model.Munro {
+	set := make(map[int]model.Munro)
+	for _, m := range munros {
+		if m.Classification == "Munro" {
+			set[m.DoBIHNumber] = m
+		}
+	}
+	return set
+}
+
+// Group works out a group's progress and leaderboards for the given year
+func Group(munros []model.Munro, members []model.GroupMember, ascents []model.Ascent, year int) GroupProgress {
+	catalogue := munroSet(munros)
+
+	allTime := map[int64]map[int]bool{}
+	thisYear := map[int64]map[int]bool{}
+	groupBagged := map[int]bool{}
+	total := 0
+
+	for _, a := range ascents {
+		if _, ok := catalogue[a.MunroID]; !ok {
+			continue
+		}
+		total++
+		groupBagged[a.MunroID] = true
+
+		if allTime[a.UserID] == nil {
+			allTime[a.UserID] = map[int]bool{}
+		}
+		allTime[a.UserID][a.MunroID] = true
+
+		if a.ClimbedAt.Year() == year {
+			if thisYear[a.UserID] == nil {
+				thisYear[a.UserID] = map[int]bool{}
+			}
+			thisYear[a.UserID][a.MunroID] = true
+		}
+	}
+
+	return GroupProgress{
+		Year:         year,
+		Members:      len(members),
+		Total:        len(catalogue),
+		Bagged:       len(groupBagged),
+		TotalAscents: total,
+		ThisYear:     leaderboard(members, thisYear),
+		AllTime:      leaderboard(members, allTime),
+	}
+}
+
+// Rank members by hills bagged. Equal counts share a rank.
+func leaderboard(members []model.GroupMember, bagged map[int64]map[int]bool) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0, len(members))
+	for _, m := range members {
+		entries = append(entries, LeaderboardEntry{UserID: m.UserID, DisplayName: m.DisplayName, Bagged: len(bagged[m.UserID])})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Bagged != entries[j].Bagged {
+			return entries[i].Bagged > entries[j].Bagged
+		}
+		return strings.ToLower(entries[i].DisplayName) < strings.ToLower(entries[j].DisplayName)
+	})
+
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Bagged == entries[i-1].Bagged {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	return entries
+}
+
+// FirstToBagRecords returns, for each Munro climbed by the group, the member
+// who climbed it first. Records are ordered by hill name.
+func FirstToBagRecords(munros []model.Munro, members []model.GroupMember, ascents []model.Ascent) []FirstToBag {
+	catalogue := munroSet(munros)
+	names := make(map[int64]string, len(members))
+	for _, m := range members {
+		names[m.UserID] = m.DisplayName
+	}
+
+	first := map[int]model.Ascent{}
+	for _, a := range ascents {
+		if _, ok := catalogue[a.MunroID]; !ok {
+			continue
+		}
+		if f, ok := first[a.MunroID]; !ok || a.ClimbedAt.Before(f.ClimbedAt) {
+			first[a.MunroID] = a
+		}
+	}
+
+	records := make([]FirstToBag, 0, len(first))
+	for id, a := range first {
+		records = append(records, FirstToBag{
+			MunroID:     id,
+			MunroName:   catalogue[id].Name,
+			UserID:      a.UserID,
+			DisplayName: names[a.UserID],
+			ClimbedAt:   a.ClimbedAt,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].MunroName < records[j].MunroName })
+
+	return records
+}
@@ -0,0 +1,116 @@
+package progress
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Progress is how far a user has got through the Munros, overall and per
+// SMC section. Only hills classified as Munros count; Tops are ignored.
+type Progress struct {
+	Total    int               `json:"total"`
+	Bagged   int               `json:"bagged"`
+	Complete bool              `json:"complete"`
+	Final    *Completion       `json:"completion,omitempty"`
+	Sections []SectionProgress `json:"sections"`
+
+	// First ascent of each bagged Munro, by DoBIH number
+	FirstAscents map[int]time.Time `json:"-"`
+}
+
+type SectionProgress struct {
+	Section  string      `json:"section"`
+	Total    int         `json:"total"`
+	Bagged   int         `json:"bagged"`
+	Complete bool        `json:"complete"`
+	Final    *Completion `json:"completion,omitempty"`
+}
+
+// Completion records when a set of hills was finished, and on which hill
+type Completion struct {
+	At           time.Time `json:"at"`
+	FinalMunroID int       `json:"final_munro_id"`
+}
+
+// FirstAscents returns the earliest ascent of each hill
+func FirstAscents(ascents []model.Ascent) map[int]time.Time {
+	first := make(map[int]time.Time)
+	for _, a := range ascents {
+		if t, ok := first[a.MunroID]; !ok || a.ClimbedAt.Before(t) {
+			first[a.MunroID] = a.ClimbedAt
+		}
+	}
+	return first
+}
+
+// Compute works out a user's progress from their ascents
+func Compute(munros []model.Munro, ascents []model.Ascent) Progress {
+	first := FirstAscents(ascents)
+	p := Progress{FirstAscents: map[int]time.Time{}}
+
+	sections := map[string]*SectionProgress{}
+	var overall Completion
+
+	for _, munro := range munros {
+		if munro.Classification != "Munro" {
+			continue
+		}
+
+		section := sections[munro.SMCSection]
+		if section == nil {
+			section = &SectionProgress{Section: munro.SMCSection, Final: &Completion{}}
+			sections[munro.SMCSection] = section
+		}
+
+		p.Total++
+		section.Total++
+
+		climbed, ok := first[munro.DoBIHNumber]
+		if !ok {
+			continue
+		}
+
+		p.Bagged++
+		section.Bagged++
+		p.FirstAscents[munro.DoBIHNumber] = climbed
+
+		if climbed.After(overall.At) {
+			overall = Completion{At: climbed, FinalMunroID: munro.DoBIHNumber}
+		}
+		if climbed.After(section.Final.At) {
+			*section.Final = Completion{At: climbed, FinalMunroID: munro.DoBIHNumber}
+		}
+	}
+
+	p.Complete = p.Total > 0 && p.Bagged == p.Total
+	if p.Complete {
+		p.Final = &overall
+	}
+
+	p.Sections = make([]SectionProgress, 0, len(sections))
+	for _, section := range sections {
+		section.Complete = section.Bagged == section.Total
+		if !section.Complete {
+			section.Final = nil
+		}
+		p.Sections = append(p.Sections, *section)
+	}
+	sort.Slice(p.Sections, func(i, j int) bool {
+		return sectionLess(p.Sections[i].Section, p.Sections[j].Section)
+	})
+
+	return p
+}
+
+// Sort SMC sections numerically where possible
+func sectionLess(a, b string) bool {
+	ai, aErr := strconv.Atoi(a)
+	bi, bErr := strconv.Atoi(b)
+	if aErr == nil && bErr == nil {
+		return ai < bi
+	}
+	return a < b
+}
@@ -0,0 +1,107 @@
+// Package ratelimit implements in-memory token buckets, one per client
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Quota is a bucket's size and how quickly it refills
+type Quota struct {
+	PerMinute int // tokens added per minute
+	Burst     int // bucket capacity
+}
+
+// Result describes a client's bucket after a request, in the terms of the
+// RateLimit response headers
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed; zero
+	// if it already would be
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64 // tokens per second
+	burst  float64
+}
+
+func (b *bucket) refill(now time.Time) float64 {
+	return math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+}
+
+// Limiter holds a bucket per client key. Buckets that have refilled are
+// forgotten, so memory stays proportional to recently active clients.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	calls   int
+}
+
+// Buckets are pruned every this many requests
+const pruneEvery = 1000
+
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from key's bucket if there is one
+func (l *Limiter) Allow(key string, q Quota) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := float64(q.PerMinute) / 60
+	burst := float64(max(q.Burst, 1))
+
+	l.calls++
+	if l.calls%pruneEvery == 0 {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	// The quota may have changed since the last request
+	b.rate, b.burst = rate, burst
+	b.tokens = b.refill(now)
+	b.last = now
+
+	res := Result{Limit: int(burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else if rate > 0 {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	if rate > 0 {
+		res.Reset = seconds((burst - b.tokens) / rate)
+	}
+	return res
+}
+
+// Drop buckets that would be full by now; a new bucket starts full anyway
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now) >= b.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Round up to whole seconds, as the headers can't carry fractions
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
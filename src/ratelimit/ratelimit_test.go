@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A limiter whose clock only moves when the test moves it
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)
+	l := New()
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestAllowBurstThenRefill(t *testing.T) {
+	l, now := newTestLimiter()
+	q := Quota{PerMinute: 60, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		res := l.Allow("walker", q)
+		if !res.Allowed || res.Limit != 3 || res.Remaining != 2-i {
+			t.Fatalf("request %d: %+v, want allowed with %d remaining", i+1, res, 2-i)
+		}
+	}
+
+	res := l.Allow("walker", q)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Fatalf("over the burst: %+v, want refused, retry after 1s, reset in 3s", res)
+	}
+
+	// One token a second
+	*now = now.Add(time.Second)
+	if res := l.Allow("walker", q); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after a second: %+v, want allowed", res)
+	}
+	if res := l.Allow("walker", q); res.Allowed {
+		t.Errorf("second request after a second: %+v, want refused", res)
+	}
+
+	// Never more than the burst, however long the wait
+	*now = now.Add(time.Hour)
+	if res := l.Allow("walker", q); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("after an hour: %+v, want allowed with 2 remaining", res)
+	}
+}
+
+func TestAllowSeparateClients(t *testing.T) {
+	l, _ := newTestLimiter()
+	q := Quota{PerMinute: 60, Burst: 1}
+
+	if res := l.Allow("ip:203.0.113.1", q); !res.Allowed {
+		t.Fatalf("first client: %+v", res)
+	}
+	if res := l.Allow("ip:203.0.113.1", q); res.Allowed {
+		t.Errorf("first client again: %+v, want refused", res)
+	}
+	if res := l.Allow("ip:203.0.113.2", q); !res.Allowed {
+		t.Errorf("second client: %+v, want allowed", res)
+	}
+}
+
+func TestAllowQuotaChange(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	if res := l.Allow("key:1", Quota{PerMinute: 60, Burst: 1}); !res.Allowed {
+		t.Fatalf("first request: %+v", res)
+	}
+	// An admin lowers the rate to nothing: the empty bucket never refills
+	res := l.Allow("key:1", Quota{PerMinute: 0, Burst: 1})
+	if res.Allowed || res.RetryAfter != 0 || res.Reset != 0 {
+		t.Errorf("with no rate: %+v, want refused without a retry time", res)
+	}
+	// A zero burst still lets a request through now and then
+	if res := l.Allow("key:2", Quota{PerMinute: 60}); !res.Allowed || res.Limit != 1 {
+		t.Errorf("zero burst: %+v, want allowed with a limit of 1", res)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l, now := newTestLimiter()
+	q := Quota{PerMinute: 60, Burst: 10}
+
+	for i := 0; i < pruneEvery-1; i++ {
+		l.Allow(fmt.Sprintf("ip:%d", i), q)
+	}
+	if len(l.buckets) != pruneEvery-1 {
+		t.Fatalf("%d buckets, want %d", len(l.buckets), pruneEvery-1)
+	}
+
+	// Long enough for every bucket to refill
+	*now = now.Add(time.Minute)
+	l.Allow("ip:latest", q)
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after pruning, want only the latest", len(l.buckets))
+	}
+}
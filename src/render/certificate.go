@@ -0,0 +1,65 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"time"
+)
+
+const (
+	certificateWidth  = 1754 // A4 landscape at 150dpi
+	certificateHeight = 1240
+)
+
+var (
+	colorParchment = color.RGBA{0xfd, 0xfb, 0xf5, 0xff}
+	colorBorder    = color.RGBA{0x1e, 0x3a, 0x8a, 0xff}
+	colorGold      = color.RGBA{0xb4, 0x8a, 0x26, 0xff}
+)
+
+// CertificateDetails is what gets printed on a compleation certificate
+type CertificateDetails struct {
+	Name        string
+	Achievement string // e.g. "all 282 Munros"
+	FinalHill   string
+	CompletedAt time.Time
+}
+
+// Certificate renders a compleation certificate
+func Certificate(c CertificateDetails) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, certificateWidth, certificateHeight))
+	fillRect(img, img.Bounds(), colorParchment)
+
+	outer := img.Bounds().Inset(50)
+	strokeRect(img, outer, 12, colorBorder)
+	strokeRect(img, outer.Inset(24), 3, colorGold)
+
+	mid := certificateWidth / 2
+	drawText(img, newFace(true, 36), mid, 250, "MUNROMARK", colorGold, alignCenter)
+	drawText(img, newFace(true, 84), mid, 380, "Certificate of Compleation", colorBorder, alignCenter)
+	drawText(img, newFace(false, 34), mid, 500, "This is to certify that", colorMuted, alignCenter)
+	drawText(img, newFace(true, 72), mid, 610, c.Name, colorText, alignCenter)
+	fillRect(img, image.Rect(mid-400, 640, mid+400, 643), colorGold)
+	drawText(img, newFace(false, 40), mid, 730, "has climbed "+c.Achievement, colorText, alignCenter)
+
+	if c.FinalHill != "" {
+		drawText(img, newFace(false, 32), mid, 820,
+			"finishing on "+c.FinalHill+" on "+c.CompletedAt.Format("2 January 2006"), colorMuted, alignCenter)
+	}
+
+	// Summit motif
+	for x := mid - 90; x <= mid+90; x++ {
+		height := 100 - abs(x-mid)*100/90
+		fillRect(img, image.Rect(x, 1000-height, x+1, 1000), colorBorder)
+	}
+	fillCircle(img, mid, 905, 10, colorGold)
+
+	return img
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
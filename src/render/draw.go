@@ -0,0 +1,86 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Drawing helpers shared by the poster and certificate renderers. Everything
+// is pure Go so images can be produced without external tools or tiles.
+
+var (
+	fontsOnce   sync.Once
+	regularFont *opentype.Font
+	boldFont    *opentype.Font
+)
+
+func loadFonts() {
+	regularFont, _ = opentype.Parse(goregular.TTF)
+	boldFont, _ = opentype.Parse(gobold.TTF)
+}
+
+func newFace(bold bool, size float64) font.Face {
+	fontsOnce.Do(loadFonts)
+
+	f := regularFont
+	if bold {
+		f = boldFont
+	}
+	face, _ := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	return face
+}
+
+// Text alignment relative to the x coordinate
+type align int
+
+const (
+	alignLeft align = iota
+	alignCenter
+	alignRight
+)
+
+// drawText draws s with its baseline at y
+func drawText(img draw.Image, face font.Face, x, y int, s string, c color.Color, a align) {
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face}
+
+	width := d.MeasureString(s).Round()
+	switch a {
+	case alignCenter:
+		x -= width / 2
+	case alignRight:
+		x -= width
+	}
+
+	d.Dot = fixed.P(x, y)
+	d.DrawString(s)
+}
+
+func fillRect(img draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// strokeRect draws a rectangle outline of the given thickness inside r
+func strokeRect(img draw.Image, r image.Rectangle, thickness int, c color.Color) {
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness), c)
+	fillRect(img, image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y), c)
+	fillRect(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+thickness, r.Max.Y), c)
+	fillRect(img, image.Rect(r.Max.X-thickness, r.Min.Y, r.Max.X, r.Max.Y), c)
+}
+
+func fillCircle(img draw.Image, cx, cy, radius int, c color.Color) {
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if x*x+y*y <= radius*radius {
+				img.Set(cx+x, cy+y, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/AlexM141200/munros-api/src/geo"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/progress"
+)
+
+const (
+	posterWidth  = 1200
+	posterHeight = 1600
+	posterMargin = 40
+
+	// OS grid extent covering every Munro, in metres
+	posterMinE = 100000.0
+	posterMaxE = 400000.0
+	posterMinN = 680000.0
+	posterMaxN = 980000.0
+)
+
+var (
+	colorBackground = color.RGBA{0xf9, 0xfa, 0xfb, 0xff}
+	colorText       = color.RGBA{0x1f, 0x29, 0x37, 0xff}
+	colorMuted      = color.RGBA{0x6b, 0x72, 0x80, 0xff}
+	colorGridMinor  = color.RGBA{0xe5, 0xe7, 0xeb, 0xff}
+	colorGridMajor  = color.RGBA{0x9c, 0xa3, 0xaf, 0xff}
+	colorSquare     = color.RGBA{0xd1, 0xd5, 0xdb, 0xff}
+	colorUnbagged   = color.RGBA{0x9c, 0xa3, 0xaf, 0xff}
+	colorBagged     = color.RGBA{0x16, 0xa3, 0x4a, 0xff}
+	colorBaggedEdge = color.RGBA{0x14, 0x53, 0x2d, 0xff}
+	colorAccent     = color.RGBA{0x1d, 0x4e, 0xd8, 0xff}
+)
+
+// Poster renders a progress map: every Munro plotted on the OS grid, with the
+// ones the user has bagged highlighted, plus per-section totals.
+func Poster(name string, munros []model.Munro, p progress.Progress) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, posterWidth, posterHeight))
+	fillRect(img, img.Bounds(), colorBackground)
+
+	// Header
+	drawText(img, newFace(true, 44), posterMargin, 80, "Munro progress: "+name, colorText, alignLeft)
+	drawText(img, newFace(false, 26), posterMargin, 124,
+		fmt.Sprintf("%d of %d Munros bagged (%.0f%%)", p.Bagged, p.Total, percent(p.Bagged, p.Total)),
+		colorMuted, alignLeft)
+
+	// Map
+	mapRect := image.Rect(posterMargin, 160, posterWidth-posterMargin, 160+posterWidth-2*posterMargin)
+	scale := float64(mapRect.Dx()) / (posterMaxE - posterMinE)
+	project := func(e, n float64) (int, int) {
+		return mapRect.Min.X + int((e-posterMinE)*scale), mapRect.Max.Y - int((n-posterMinN)*scale)
+	}
+
+	fillRect(img, mapRect, color.White)
+	for e := posterMinE; e <= posterMaxE; e += 10000 {
+		x, _ := project(e, posterMinN)
+		fillRect(img, image.Rect(x, mapRect.Min.Y, x+1, mapRect.Max.Y), colorGridMinor)
+	}
+	for n := posterMinN; n <= posterMaxN; n += 10000 {
+		_, y := project(posterMinE, n)
+		fillRect(img, image.Rect(mapRect.Min.X, y, mapRect.Max.X, y+1), colorGridMinor)
+	}
+
+	// 100km squares with their letters
+	squareFace := newFace(true, 36)
+	for e := posterMinE; e < posterMaxE; e += 100000 {
+		for n := 700000.0; n < posterMaxN; n += 100000 {
+			x, y := project(e, n+100000)
+			if y < mapRect.Min.Y {
+				y = mapRect.Min.Y
+			}
+			drawText(img, squareFace, x+12, y+44, geo.GridSquare(e, n), colorSquare, alignLeft)
+		}
+	}
+	for e := posterMinE; e <= posterMaxE; e += 100000 {
+		x, _ := project(e, posterMinN)
+		fillRect(img, image.Rect(x-1, mapRect.Min.Y, x+1, mapRect.Max.Y), colorGridMajor)
+	}
+	for n := 700000.0; n <= posterMaxN; n += 100000 {
+		_, y := project(posterMinE, n)
+		fillRect(img, image.Rect(mapRect.Min.X, y-1, mapRect.Max.X, y+1), colorGridMajor)
+	}
+	strokeRect(img, mapRect, 2, colorGridMajor)
+
+	// Unbagged hills first so bagged ones sit on top
+	for _, bagged := range []bool{false, true} {
+		for _, munro := range munros {
+			if munro.Classification != "Munro" {
+				continue
+			}
+			if _, ok := p.FirstAscents[munro.DoBIHNumber]; ok != bagged {
+				continue
+			}
+			x, y := project(munro.XCoord, munro.YCoord)
+			if bagged {
+				fillCircle(img, x, y, 8, colorBaggedEdge)
+				fillCircle(img, x, y, 6, colorBagged)
+			} else {
+				fillCircle(img, x, y, 4, colorUnbagged)
+			}
+		}
+	}
+
+	// Per-section totals
+	top := mapRect.Max.Y + 50
+	drawText(img, newFace(true, 24), posterMargin, top, "By SMC section", colorText, alignLeft)
+
+	labelFace := newFace(false, 20)
+	perRow := 6
+	cellWidth := (posterWidth - 2*posterMargin) / perRow
+	for i, section := range p.Sections {
+		x := posterMargin + (i%perRow)*cellWidth
+		y := top + 40 + (i/perRow)*44
+
+		c := colorMuted
+		if section.Complete {
+			c = colorBagged
+		}
+		drawText(img, labelFace, x, y, fmt.Sprintf("%s: %d/%d", section.Section, section.Bagged, section.Total), c, alignLeft)
+
+		bar := image.Rect(x, y+8, x+cellWidth-24, y+14)
+		fillRect(img, bar, colorGridMinor)
+		bar.Max.X = bar.Min.X + int(float64(bar.Dx())*percent(section.Bagged, section.Total)/100)
+		fillRect(img, bar, c)
+	}
+
+	drawText(img, newFace(false, 16), posterWidth-posterMargin, posterHeight-24, "MunroMark", colorAccent, alignRight)
+
+	return img
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
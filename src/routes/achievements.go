@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/AlexM141200/munros-api/src/achievements"
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Fill in the name and description of each award from its rule
+func (h *Handlers) describeAwards(awards []model.Award) {
+	byID := make(map[string]achievements.Rule, len(h.achievements))
+	for _, rule := range h.achievements {
+		byID[rule.ID] = rule
+	}
+
+	for i := range awards {
+		if rule, ok := byID[awards[i].AchievementID]; ok {
+			awards[i].Name = rule.Name
+			awards[i].Description = rule.Description
+		}
+	}
+}
+
+// Evaluate the achievement rules against all of a user's ascents and store
+// any new awards, which are returned. The visibility of those already held
+// is brought up to date.
+func (h *Handlers) evaluateAchievements(user *model.User) ([]model.Award, error) {
+	if len(h.achievements) == 0 {
+		return nil, nil
+	}
+
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		return nil, err
+	}
+
+	ascents, err := h.store.ListAscents(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// An award is as visible as the ascents it can be earned from: public if
+	// the public ones earn it, for followers if those and the followers-only
+	// ones do, and private otherwise
+	visibility := map[[2]string]string{}
+	for _, v := range []string{model.VisibilityFollowers, model.VisibilityPublic} {
+		var visible []model.Ascent
+		for _, a := range ascents {
+			if a.Visibility == model.VisibilityPublic || a.Visibility == v {
+				visible = append(visible, a)
+			}
+		}
+		for _, e := range achievements.Evaluate(h.achievements, munros, visible) {
+			visibility[[2]string{e.AchievementID, e.Group}] = v
+		}
+	}
+
+	var awards []model.Award
+	for _, e := range achievements.Evaluate(h.achievements, munros, ascents) {
+		award := model.Award{
+			UserID:        user.ID,
+			AchievementID: e.AchievementID,
+			Group:         e.Group,
+			AwardedAt:     e.AwardedAt,
+			Visibility:    model.VisibilityPrivate,
+		}
+		if v, ok := visibility[[2]string{e.AchievementID, e.Group}]; ok {
+			award.Visibility = v
+		}
+		awards = append(awards, award)
+	}
+
+	added, err := h.store.AddAwards(awards)
+	if err != nil {
+		return nil, err
+	}
+	// Ascents may have been hidden or removed since the awards were earned
+	if err := h.store.SetAwardVisibilities(user.ID, awards); err != nil {
+		return nil, err
+	}
+
+	h.describeAwards(added)
+	return added, nil
+}
+
+// List every achievement that can be earned
+func (h *Handlers) HandleGetAchievements(w http.ResponseWriter, r *http.Request) {
+	rules := h.achievements
+	if rules == nil {
+		rules = []achievements.Rule{}
+	}
+
+	h.writeJSONResponse(w, r, rules, http.StatusOK)
+}
+
+// List the achievements the logged-in user has earned
+func (h *Handlers) HandleGetAwards(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	awards, err := h.store.ListAwards(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing awards", "err", err)
+		writeError(w, r, "Failed to read achievements", http.StatusInternalServerError)
+		return
+	}
+
+	h.describeAwards(awards)
+	h.writeJSONResponse(w, r, awards, http.StatusOK)
+}
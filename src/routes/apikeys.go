@@ -0,0 +1,411 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/middleware"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/ratelimit"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+const (
+	// apiKeyPrefix starts every key, so they can't be mistaken for session
+	// tokens
+	apiKeyPrefix      = "mm_"
+	apiKeyHeader      = "X-API-Key"
+	maxAPIKeysPerUser = 10
+	defaultUsageDays  = 30
+	maxUsageDays      = 366
+)
+
+var (
+	// Quota for new keys, until an admin changes it
+	defaultKeyQuota = ratelimit.Quota{PerMinute: 60, Burst: 120}
+	// Quota shared by requests from one address without a key
+	anonymousQuota = ratelimit.Quota{PerMinute: 30, Burst: 60}
+)
+
+type apiKeyContextKey struct{}
+
+// The key a request was authenticated with, and its owner
+type apiCaller struct {
+	key  *model.APIKey
+	user *model.User
+}
+
+func apiCallerFrom(r *http.Request) *apiCaller {
+	caller, _ := r.Context().Value(apiKeyContextKey{}).(*apiCaller)
+	return caller
+}
+
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type quotaRequest struct {
+	RatePerMinute int `json:"rate_per_minute"`
+	Burst         int `json:"burst"`
+}
+
+type usageKey struct {
+	keyID int64
+	day   string
+}
+
+// usageCounter totals requests per key in memory, so the database is
+// written in batches rather than on every request
+type usageCounter struct {
+	mu     sync.Mutex
+	counts map[usageKey]*store.UsageCount
+}
+
+func (c *usageCounter) add(keyID int64, limited bool) {
+	now := time.Now().UTC()
+	k := usageKey{keyID, now.Format("2006-01-02")}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count, ok := c.counts[k]
+	if !ok {
+		count = &store.UsageCount{KeyID: keyID, Day: k.day}
+		c.counts[k] = count
+	}
+	count.Requests++
+	if limited {
+		count.Limited++
+	}
+	count.LastUsed = now
+}
+
+func (c *usageCounter) take() []store.UsageCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make([]store.UsageCount, 0, len(c.counts))
+	for _, count := range c.counts {
+		counts = append(counts, *count)
+	}
+	c.counts = make(map[usageKey]*store.UsageCount)
+	return counts
+}
+
+// Write out the API key usage counted since the last flush
+func (h *Handlers) flushAPIUsage() {
+	counts := h.apiUsage.take()
+	if len(counts) == 0 {
+		return
+	}
+	if err := h.store.AddAPIKeyUsage(counts); err != nil {
+		h.logger.Error("Error recording API key usage", "err", err)
+	}
+}
+
+// FlushAPIUsage writes API key usage to the database every interval until
+// ctx is cancelled, and once more on the way out
+func (h *Handlers) FlushAPIUsage(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.flushAPIUsage()
+			return
+		case <-ticker.C:
+			h.flushAPIUsage()
+		}
+	}
+}
+
+// Read an API key from the X-API-Key header, or a bearer token that looks
+// like one
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return strings.TrimSpace(key)
+	}
+	if token := auth.TokenFromRequest(r); strings.HasPrefix(token, apiKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// Take a token from client's bucket and describe the bucket in the
+// RateLimit headers, writing a 429 if it's empty
+func (h *Handlers) rateLimit(w http.ResponseWriter, r *http.Request, client string, q ratelimit.Quota) bool {
+	res := h.limiter.Allow(client, q)
+
+	header := w.Header()
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=60;burst=%d", q.PerMinute, res.Limit))
+	header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(int(res.Reset.Seconds())))
+
+	if !res.Allowed {
+		header.Set("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+		writeError(w, r, "Rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// WithScope lets API keys holding scope call a handler, within the key's
+// rate limit. Requests without a key are handled as before, except that on
+// the public catalogue they share a quota per client address.
+func (h *Handlers) WithScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := apiKeyFromRequest(r)
+		if secret == "" {
+			if scope == model.ScopeCatalogueRead && !h.rateLimit(w, r, "ip:"+middleware.ClientIP(r), anonymousQuota) {
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		key, user, err := h.store.GetAPIKeyByHash(auth.HashToken(secret))
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				writeError(w, r, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			h.log(r).Error("Error looking up API key", "err", err)
+			writeError(w, r, "Failed to read API key", http.StatusInternalServerError)
+			return
+		}
+		if !key.HasScope(scope) {
+			writeError(w, r, "API key lacks the "+scope+" scope", http.StatusForbidden)
+			return
+		}
+
+		allowed := h.rateLimit(w, r, fmt.Sprintf("key:%d", key.ID), ratelimit.Quota{PerMinute: key.RatePerMinute, Burst: key.Burst})
+		h.apiUsage.add(key.ID, !allowed)
+		if !allowed {
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyContextKey{}, &apiCaller{key: key, user: user})
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func (h *Handlers) apiKeyFromPath(w http.ResponseWriter, r *http.Request, user *model.User) (*model.APIKey, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid API key ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	key, err := h.store.GetAPIKey(user.ID, id)
+	if err != nil {
+		h.writeAPIKeyError(w, r, err)
+		return nil, false
+	}
+	return key, true
+}
+
+func (h *Handlers) writeAPIKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, r, "API key not found", http.StatusNotFound)
+		return
+	}
+	h.log(r).Error("Error reading API key", "err", err)
+	writeError(w, r, "Failed to read API key", http.StatusInternalServerError)
+}
+
+// List the logged-in user's API keys
+func (h *Handlers) HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.store.ListAPIKeys(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing API keys", "err", err)
+		writeError(w, r, "Failed to read API keys", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, keys, http.StatusOK)
+}
+
+// Issue an API key. The response is the only time the key itself is shown.
+func (h *Handlers) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req apiKeyRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	key := &model.APIKey{
+		UserID:        user.ID,
+		Name:          strings.TrimSpace(req.Name),
+		Scopes:        req.Scopes,
+		RatePerMinute: defaultKeyQuota.PerMinute,
+		Burst:         defaultKeyQuota.Burst,
+	}
+	if key.Name == "" {
+		writeError(w, r, "A name is required", http.StatusBadRequest)
+		return
+	}
+	if len(key.Scopes) == 0 {
+		writeError(w, r, "scopes must list at least one of "+strings.Join(model.Scopes, ", "), http.StatusBadRequest)
+		return
+	}
+	for _, scope := range key.Scopes {
+		if !validChoice(w, r, "scopes", scope, model.Scopes) {
+			return
+		}
+	}
+	if key.HasScope(model.ScopeAdmin) && !user.IsAdmin() {
+		writeError(w, r, "Only admins can issue admin keys", http.StatusForbidden)
+		return
+	}
+
+	existing, err := h.store.ListAPIKeys(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing API keys", "err", err)
+		writeError(w, r, "Failed to read API keys", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		writeError(w, r, "Too many API keys; delete one first", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.NewToken()
+	if err != nil {
+		h.log(r).Error("Error generating API key", "err", err)
+		writeError(w, r, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	key.Key = apiKeyPrefix + secret
+	key.Prefix = key.Key[:len(apiKeyPrefix)+8]
+
+	if err := h.store.CreateAPIKey(key, auth.HashToken(key.Key)); err != nil {
+		h.log(r).Error("Error creating API key", "err", err)
+		writeError(w, r, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, key, http.StatusCreated)
+}
+
+func (h *Handlers) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	key, ok := h.apiKeyFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteAPIKey(user.ID, key.ID); err != nil {
+		h.writeAPIKeyError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Daily request counts for one of the logged-in user's keys (?days=,
+// default 30)
+func (h *Handlers) HandleGetAPIKeyUsage(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	key, ok := h.apiKeyFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	days := defaultUsageDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUsageDays {
+			writeError(w, r, fmt.Sprintf("days must be between 1 and %d", maxUsageDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	// Include requests not yet written out
+	h.flushAPIUsage()
+
+	since := time.Now().UTC().AddDate(0, 0, 1-days).Format("2006-01-02")
+	usage, err := h.store.ListAPIKeyUsage(key.ID, since)
+	if err != nil {
+		h.log(r).Error("Error reading API key usage", "err", err)
+		writeError(w, r, "Failed to read API key usage", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, usage, http.StatusOK)
+}
+
+// List every user's API keys (admin only)
+func (h *Handlers) HandleGetAllAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentAdmin(w, r); !ok {
+		return
+	}
+
+	h.flushAPIUsage()
+
+	keys, err := h.store.ListAllAPIKeys()
+	if err != nil {
+		h.log(r).Error("Error listing API keys", "err", err)
+		writeError(w, r, "Failed to read API keys", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, keys, http.StatusOK)
+}
+
+// Change a key's rate limit (admin only)
+func (h *Handlers) HandleSetAPIKeyQuota(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentAdmin(w, r); !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	var req quotaRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+	if req.RatePerMinute < 0 || req.Burst < 1 {
+		writeError(w, r, "rate_per_minute must be 0 or more and burst at least 1", http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.store.SetAPIKeyQuota(id, req.RatePerMinute, req.Burst)
+	if err != nil {
+		h.writeAPIKeyError(w, r, err)
+		return
+	}
+
+	h.writeJSONResponse(w, r, key, http.StatusOK)
+}
@@ -0,0 +1,148 @@
+package routes_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/routes"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+type apiKeyFixture struct {
+	router http.Handler
+	store  *store.Store
+	user   *model.User
+}
+
+func newAPIKeyFixture(t *testing.T) *apiKeyFixture {
+	t.Helper()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "munro.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	user := &model.User{Email: "walker@example.com", DisplayName: "Walker"}
+	if err := s.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	h := routes.New(routes.Deps{Munros: testMunros, Store: s})
+	return &apiKeyFixture{router: handlers.NewRouter(h), store: s, user: user}
+}
+
+// Store a key for the fixture's user with the given scopes and burst, at a
+// rate too slow to refill during a test
+func (f *apiKeyFixture) key(t *testing.T, secret string, burst int, scopes ...string) {
+	t.Helper()
+	key := &model.APIKey{UserID: f.user.ID, Name: secret, Prefix: secret[:7], Scopes: scopes, RatePerMinute: 1, Burst: burst}
+	if err := f.store.CreateAPIKey(key, auth.HashToken(secret)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *apiKeyFixture) get(path string, header ...string) *http.Response {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, r)
+	return rec.Result()
+}
+
+func TestWithScope(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	f.key(t, "mm_reader", 10, model.ScopeAscentsRead)
+	f.key(t, "mm_catalogue", 10, model.ScopeCatalogueRead)
+
+	tests := []struct {
+		name   string
+		path   string
+		header []string
+		status int
+	}{
+		{"scoped key", "/api/ascents", []string{"X-API-Key", "mm_reader"}, http.StatusOK},
+		{"scoped key as bearer token", "/api/ascents", []string{"Authorization", "Bearer mm_reader"}, http.StatusOK},
+		{"key without the scope", "/api/ascents", []string{"X-API-Key", "mm_catalogue"}, http.StatusForbidden},
+		{"unknown key", "/api/ascents", []string{"X-API-Key", "mm_unknown"}, http.StatusUnauthorized},
+		// Without a key the handler asks for a session as before
+		{"no key", "/api/ascents", nil, http.StatusUnauthorized},
+		{"catalogue key", "/api/munros", []string{"X-API-Key", "mm_catalogue"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := f.get(tt.path, tt.header...); resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestWithScopeRateLimitsKeys(t *testing.T) {
+	f := newAPIKeyFixture(t)
+	f.key(t, "mm_reader", 2, model.ScopeAscentsRead)
+	f.key(t, "mm_second", 2, model.ScopeAscentsRead)
+
+	for i := 0; i < 2; i++ {
+		resp := f.get("/api/ascents", "X-API-Key", "mm_reader")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, resp.StatusCode)
+		}
+		if got := resp.Header.Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("RateLimit-Limit = %q, want 2", got)
+		}
+		if got := resp.Header.Get("RateLimit-Remaining"); got != strconv.Itoa(1-i) {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %d", i+1, got, 1-i)
+		}
+	}
+
+	resp := f.get("/api/ascents", "X-API-Key", "mm_reader")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("over the burst: status %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+
+	// Each key has its own bucket
+	if resp := f.get("/api/ascents", "X-API-Key", "mm_second"); resp.StatusCode != http.StatusOK {
+		t.Errorf("another key: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestWithScopeRateLimitsAnonymousCatalogue(t *testing.T) {
+	f := newAPIKeyFixture(t)
+
+	// Requests without a key share a bucket per address
+	var resp *http.Response
+	for i := 0; ; i++ {
+		resp = f.get("/api/munros")
+		if resp.StatusCode != http.StatusOK {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("anonymous requests never limited")
+		}
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("status %d, Retry-After %q, want %d with a retry time", resp.StatusCode, resp.Header.Get("Retry-After"), http.StatusTooManyRequests)
+	}
+
+	// A key has a quota of its own
+	f.key(t, "mm_catalogue", 10, model.ScopeCatalogueRead)
+	if resp := f.get("/api/munros", "X-API-Key", "mm_catalogue"); resp.StatusCode != http.StatusOK {
+		t.Errorf("with a key: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	// Only the public catalogue is limited by address
+	if resp := f.get("/api/ascents"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("ascents without a key: status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
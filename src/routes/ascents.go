@@ -0,0 +1,210 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+type ascentRequest struct {
+	MunroID    int       `json:"munro_id"`
+	ClimbedAt  time.Time `json:"climbed_at"`
+	Notes      string    `json:"notes"`
+	Source     string    `json:"source"`
+	Visibility string    `json:"visibility"`
+}
+
+type visibilityRequest struct {
+	Visibility string `json:"visibility"`
+}
+
+// Index the catalogue by DoBIH number
+func (h *Handlers) munrosByID() (map[int]model.Munro, error) {
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]model.Munro, len(munros))
+	for _, munro := range munros {
+		byID[munro.DoBIHNumber] = munro
+	}
+	return byID, nil
+}
+
+// List the logged-in user's ascents
+func (h *Handlers) HandleGetAscents(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	ascents, err := h.store.ListAscents(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing ascents", "err", err)
+		writeError(w, r, "Failed to read ascents", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, ascents, http.StatusOK)
+}
+
+// Log one or more ascents. The body is a JSON array so that the summits
+// detected in an uploaded track can be confirmed in one request.
+func (h *Handlers) HandleCreateAscents(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var reqs []ascentRequest
+	if !readJSONRequest(w, r, &reqs) {
+		return
+	}
+	if len(reqs) == 0 {
+		writeError(w, r, "No ascents provided", http.StatusBadRequest)
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	ascents := make([]model.Ascent, 0, len(reqs))
+	for _, req := range reqs {
+		if _, ok := catalogue[req.MunroID]; !ok {
+			writeError(w, r, "Unknown munro_id "+strconv.Itoa(req.MunroID), http.StatusBadRequest)
+			return
+		}
+		if req.ClimbedAt.IsZero() {
+			writeError(w, r, "climbed_at is required", http.StatusBadRequest)
+			return
+		}
+		if req.ClimbedAt.After(time.Now().Add(24 * time.Hour)) {
+			writeError(w, r, "climbed_at is in the future", http.StatusBadRequest)
+			return
+		}
+
+		if !validChoice(w, r, "visibility", req.Visibility, model.Visibilities) {
+			return
+		}
+
+		source := strings.ToLower(req.Source)
+		if source != model.AscentSourceTrack {
+			source = model.AscentSourceManual
+		}
+
+		ascents = append(ascents, model.Ascent{
+			UserID:     user.ID,
+			MunroID:    req.MunroID,
+			ClimbedAt:  req.ClimbedAt,
+			Notes:      strings.TrimSpace(req.Notes),
+			Source:     source,
+			Visibility: req.Visibility,
+		})
+	}
+
+	// Progress beforehand, to tell whether these ascents finish the list
+	before, err := h.progressFor(user.ID)
+	if err != nil {
+		h.log(r).Error("Error computing progress", "err", err)
+		writeError(w, r, "Failed to read ascents", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.CreateAscents(ascents); err != nil {
+		h.log(r).Error("Error creating ascents", "err", err)
+		writeError(w, r, "Failed to log ascents", http.StatusInternalServerError)
+		return
+	}
+
+	// Achievements are a side effect; a failure here shouldn't lose the ascents
+	if _, err := h.evaluateAchievements(user); err != nil {
+		h.log(r).Error("Error evaluating achievements", "err", err)
+	}
+	h.publishAscents(r, user, ascents, before)
+
+	h.writeJSONResponse(w, r, ascents, http.StatusCreated)
+}
+
+// Remove one of the logged-in user's ascents
+func (h *Handlers) HandleDeleteAscent(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid ascent ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.DeleteAscent(user.ID, id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Ascent not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error deleting ascent", "err", err)
+		writeError(w, r, "Failed to delete ascent", http.StatusInternalServerError)
+		return
+	}
+
+	// Awards may have been earned from the ascent
+	if _, err := h.evaluateAchievements(user); err != nil {
+		h.log(r).Error("Error evaluating achievements", "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Change who can see one of the logged-in user's ascents
+func (h *Handlers) HandleSetAscentVisibility(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid ascent ID", http.StatusBadRequest)
+		return
+	}
+
+	var req visibilityRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+	if req.Visibility == "" {
+		writeError(w, r, "visibility is required", http.StatusBadRequest)
+		return
+	}
+	if !validChoice(w, r, "visibility", req.Visibility, model.Visibilities) {
+		return
+	}
+
+	if err := h.store.SetAscentVisibility(user.ID, id, req.Visibility); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Ascent not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error setting ascent visibility", "err", err)
+		writeError(w, r, "Failed to update ascent", http.StatusInternalServerError)
+		return
+	}
+
+	// Awards may have been earned from the ascent
+	if _, err := h.evaluateAchievements(user); err != nil {
+		h.log(r).Error("Error evaluating achievements", "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,209 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/middleware"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+type credentialsRequest struct {
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	DisplayName string `json:"display_name"`
+}
+
+type sessionResponse struct {
+	Token     string      `json:"token"`
+	ExpiresAt time.Time   `json:"expires_at"`
+	User      *model.User `json:"user"`
+}
+
+// Read a JSON request body into v, writing a 400 on failure
+func readJSONRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			writeError(w, r, "Request body is too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		writeErrorDetails(w, r, "Invalid JSON body", http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// Look up the logged-in user, writing a 401 if there isn't one
+func (h *Handlers) currentUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	if caller := apiCallerFrom(r); caller != nil {
+		return caller.user, true
+	}
+	if apiKeyFromRequest(r) != "" {
+		writeError(w, r, "API keys can't be used for this endpoint", http.StatusForbidden)
+		return nil, false
+	}
+
+	if token := auth.TokenFromRequest(r); token != "" {
+		user, err := h.store.GetSessionUser(auth.HashToken(token))
+		if err == nil {
+			return user, true
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			h.log(r).Error("Error looking up session", "err", err)
+			writeError(w, r, "Failed to read session", http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+
+	writeError(w, r, "Authentication required", http.StatusUnauthorized)
+	return nil, false
+}
+
+// Create a session for user and set its cookie, writing a 500 on failure
+func (h *Handlers) createSession(w http.ResponseWriter, r *http.Request, user *model.User) (string, time.Time, bool) {
+	token, err := auth.NewToken()
+	if err != nil {
+		h.log(r).Error("Error generating session token", "err", err)
+		writeError(w, r, "Failed to create session", http.StatusInternalServerError)
+		return "", time.Time{}, false
+	}
+
+	expiresAt := time.Now().Add(auth.SessionTTL)
+	if err := h.store.CreateSession(auth.HashToken(token), user.ID, expiresAt); err != nil {
+		h.log(r).Error("Error creating session", "err", err)
+		writeError(w, r, "Failed to create session", http.StatusInternalServerError)
+		return "", time.Time{}, false
+	}
+
+	auth.SetSessionCookie(w, token, expiresAt, middleware.IsHTTPS(r))
+	return token, expiresAt, true
+}
+
+// Create a session for user and return it to the client
+func (h *Handlers) startSession(w http.ResponseWriter, r *http.Request, user *model.User, statusCode int) {
+	token, expiresAt, ok := h.createSession(w, r, user)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, sessionResponse{Token: token, ExpiresAt: expiresAt, User: user}, statusCode)
+}
+
+// Register a local account
+func (h *Handlers) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	var req credentialsRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		writeError(w, r, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < auth.MinPasswordLength {
+		writeError(w, r, "Password is too short", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		h.log(r).Error("Error hashing password", "err", err)
+		writeError(w, r, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	user := &model.User{
+		Email:        req.Email,
+		DisplayName:  strings.TrimSpace(req.DisplayName),
+		PasswordHash: hash,
+	}
+	if user.DisplayName == "" {
+		user.DisplayName, _, _ = strings.Cut(req.Email, "@")
+	}
+
+	if err := h.store.CreateUser(user); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			writeError(w, r, "Email is already registered", http.StatusConflict)
+			return
+		}
+		h.log(r).Error("Error creating user", "err", err)
+		writeError(w, r, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	h.sendInBackground(r, "verification email", func(ctx context.Context) error {
+		return h.notifier.SendVerification(ctx, user)
+	})
+
+	h.startSession(w, r, user, http.StatusCreated)
+}
+
+// Log in with email and password
+func (h *Handlers) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	var req credentialsRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	user, err := h.store.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		h.log(r).Error("Error looking up user", "err", err)
+		writeError(w, r, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || !auth.CheckPassword(user.PasswordHash, req.Password) {
+		writeError(w, r, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	h.startSession(w, r, user, http.StatusOK)
+}
+
+// End the current session
+func (h *Handlers) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if token := auth.TokenFromRequest(r); token != "" {
+		if err := h.store.DeleteSession(auth.HashToken(token)); err != nil {
+			h.log(r).Error("Error deleting session", "err", err)
+		}
+	}
+
+	auth.ClearSessionCookie(w, middleware.IsHTTPS(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get the logged-in user
+func (h *Handlers) HandleMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, user, http.StatusOK)
+}
+
+// Look up the logged-in user without requiring one
+func (h *Handlers) optionalUser(r *http.Request) *model.User {
+	if caller := apiCallerFrom(r); caller != nil {
+		return caller.user
+	}
+
+	token := auth.TokenFromRequest(r)
+	if token == "" {
+		return nil
+	}
+	user, err := h.store.GetSessionUser(auth.HashToken(token))
+	if err != nil {
+		return nil
+	}
+	return user
+}
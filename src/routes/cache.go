@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/dataset"
+	"github.com/AlexM141200/munros-api/src/middleware"
+)
+
+// WithCatalogueCache adds validators to a catalogue handler's responses.
+// They depend only on the catalogue and the request's path and query, so
+// the ETag is made from the file's checksum and those, Last-Modified is the
+// file's, and Cache-Control is as configured. Requests whose If-None-Match
+// or If-Modified-Since still match are answered with a 304 without running
+// next, rather than sent the catalogue again.
+func (h *Handlers) WithCatalogueCache(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next(w, r)
+			return
+		}
+		var file *dataset.File
+		if h.dataset != nil {
+			file = h.dataset.File()
+		}
+		if file == nil {
+			// Nothing to say which version of the catalogue this is
+			next(w, r)
+			return
+		}
+
+		etag := catalogueETag(file.Checksum, r)
+		// HTTP dates are to the second
+		modified := file.ModTime.Truncate(time.Second)
+
+		header := w.Header()
+		header.Set("ETag", etag)
+		header.Set("Last-Modified", modified.Format(http.TimeFormat))
+		if h.cacheControl != "" {
+			header.Set("Cache-Control", h.cacheControl)
+		}
+
+		if match, ok := notModified(r, etag, modified); ok {
+			// Echo the tag the client has, which may be the compressed one
+			header.Set("ETag", match)
+			header.Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// A strong tag for the catalogue version and what was asked of it. Query
+// parameters are sorted, so their order doesn't matter.
+func catalogueETag(checksum string, r *http.Request) string {
+	sum := sha256.Sum256([]byte(checksum + "\x00" + r.URL.Path + "\x00" + r.URL.Query().Encode()))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Whether the client's copy is current, and the tag it matched by. As RFC
+// 9110 says, If-Modified-Since is only considered without If-None-Match.
+func notModified(r *http.Request, etag string, modified time.Time) (string, bool) {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" {
+				return etag, true
+			}
+			// Weak comparison, as for GET, also allows a W/ prefix. The
+			// compression middleware's tag for the gzipped body matches too.
+			candidate := strings.TrimPrefix(tag, "W/")
+			if candidate == etag || candidate == strings.TrimSuffix(etag, `"`)+middleware.GzipETagSuffix+`"` {
+				return candidate, true
+			}
+		}
+		return "", false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		if err == nil && !modified.After(since) {
+			return etag, true
+		}
+	}
+	return "", false
+}
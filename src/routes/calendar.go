@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // sunrise/sunset are shown in UK time wherever the server runs
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/ical"
+	"github.com/AlexM141200/munros-api/src/middleware"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+	"github.com/AlexM141200/munros-api/src/sun"
+)
+
+var ukTime, _ = time.LoadLocation("Europe/London")
+
+type calendarTokenResponse struct {
+	URL string `json:"url"`
+}
+
+// Absolute URL of the site, as seen by the client
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if middleware.IsHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Absolute URL of the site for links that outlive the request, such as a
+// calendar feed's address: the configured one, so a forged Host header
+// can't point subscribers elsewhere
+func (h *Handlers) siteBaseURL(r *http.Request) string {
+	if h.siteURL != "" {
+		return h.siteURL
+	}
+	return baseURL(r)
+}
+
+// Create (or rotate) the logged-in user's calendar feed URL
+func (h *Handlers) HandleCreateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		h.log(r).Error("Error generating calendar token", "err", err)
+		writeError(w, r, "Failed to create calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.SetCalendarToken(user.ID, auth.HashToken(token)); err != nil {
+		h.log(r).Error("Error storing calendar token", "err", err)
+		writeError(w, r, "Failed to create calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, calendarTokenResponse{URL: h.siteBaseURL(r) + "/api/calendar/" + token + ".ics"}, http.StatusOK)
+}
+
+// Revoke the logged-in user's calendar feed
+func (h *Handlers) HandleDeleteCalendarToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteCalendarToken(user.ID); err != nil {
+		h.log(r).Error("Error deleting calendar token", "err", err)
+		writeError(w, r, "Failed to revoke calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Serve a user's dated plans as an iCalendar feed. The token in the URL is the
+// only credential, since calendar apps can't log in.
+func (h *Handlers) HandleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutSuffix(r.PathValue("file"), ".ics")
+	if !ok {
+		writeError(w, r, "Calendar not found", http.StatusNotFound)
+		return
+	}
+
+	userID, err := h.store.GetCalendarTokenUser(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Calendar not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error reading calendar token", "err", err)
+		writeError(w, r, "Failed to read calendar", http.StatusInternalServerError)
+		return
+	}
+
+	plans, err := h.store.ListPlans(userID)
+	if err != nil {
+		h.log(r).Error("Error listing plans", "err", err)
+		writeError(w, r, "Failed to read calendar", http.StatusInternalServerError)
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	cal := ical.Calendar{Name: "MunroMark trips"}
+	for i := range plans {
+		if event, ok := planEvent(&plans[i], catalogue, h.siteBaseURL(r)); ok {
+			cal.Events = append(cal.Events, event)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="munromark.ics"`)
+	if err := cal.Write(w); err != nil {
+		h.log(r).Error("Error writing calendar", "err", err)
+	}
+}
+
+// Build the calendar event for a plan. Plans without a date are skipped.
+func planEvent(plan *model.Plan, catalogue map[int]model.Munro, base string) (ical.Event, bool) {
+	start, err := time.Parse(time.DateOnly, plan.StartDate)
+	if err != nil {
+		return ical.Event{}, false
+	}
+	end := start
+	if plan.EndDate != "" {
+		if parsed, err := time.Parse(time.DateOnly, plan.EndDate); err == nil {
+			end = parsed
+		}
+	}
+
+	var description strings.Builder
+	var names []string
+	var ids []string
+	event := ical.Event{
+		UID:      fmt.Sprintf("plan-%d@munromark", plan.ID),
+		Summary:  plan.Name,
+		Start:    start,
+		End:      end,
+		Modified: plan.UpdatedAt,
+	}
+
+	for _, hill := range plan.Hills {
+		munro, ok := catalogue[hill.MunroID]
+		if !ok {
+			continue
+		}
+		if !event.HasGeo {
+			event.Lat, event.Lon, event.HasGeo = munro.Latitude, munro.Longitude, true
+		}
+		names = append(names, munro.Name)
+		ids = append(ids, strconv.Itoa(munro.DoBIHNumber))
+
+		fmt.Fprintf(&description, "%s (%.0fm), %s\n", munro.Name, munro.HeightM, munro.GridRef)
+		if sunrise, sunset, ok := sun.Times(start, munro.Latitude, munro.Longitude, munro.HeightM); ok {
+			fmt.Fprintf(&description, "  Summit sunrise %s, sunset %s\n",
+				sunrise.In(ukTime).Format("15:04"), sunset.In(ukTime).Format("15:04"))
+		}
+		if hill.Notes != "" {
+			fmt.Fprintf(&description, "  %s\n", hill.Notes)
+		}
+	}
+
+	if plan.Notes != "" {
+		fmt.Fprintf(&description, "\n%s\n", plan.Notes)
+	}
+
+	event.URL = base + "/map"
+	if len(ids) > 0 {
+		event.URL += "?hills=" + strings.Join(ids, ",")
+	}
+	fmt.Fprintf(&description, "\nView on the map: %s", event.URL)
+
+	event.Location = strings.Join(names, ", ")
+	event.Description = description.String()
+	return event, true
+}
@@ -0,0 +1,67 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/routes"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+func TestCalendarTokenURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		siteURL string
+		want    string
+	}{
+		{"configured site", "https://munromark.example/", "https://munromark.example/api/calendar/"},
+		// Only tests and tools leave it unset
+		{"no site", "", "http://attacker.example/api/calendar/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := store.Open(filepath.Join(t.TempDir(), "munro.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+
+			user := &model.User{Email: "walker@example.com", DisplayName: "Walker"}
+			if err := s.CreateUser(user); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.CreateSession(auth.HashToken("walker"), user.ID, time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			router := handlers.NewRouter(routes.New(routes.Deps{Munros: testMunros, Store: s, SiteURL: tt.siteURL}))
+
+			r := httptest.NewRequest(http.MethodPost, "/api/calendar/token", nil)
+			r.Host = "attacker.example"
+			r.Header.Set("Authorization", "Bearer walker")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d", rec.Code)
+			}
+
+			var body struct {
+				URL string `json:"url"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(body.URL, tt.want) || !strings.HasSuffix(body.URL, ".ics") {
+				t.Errorf("feed URL = %q, want it under %s", body.URL, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/conditions"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+const (
+	maxConditionNotes  = 2000
+	defaultConditions  = 50
+	maxConditionsLimit = 200
+)
+
+var (
+	snowCovers     = []string{model.SnowNone, model.SnowPatchy, model.SnowCovered}
+	pathStates     = []string{model.PathGood, model.PathWet, model.PathEroded, model.PathIcy}
+	riverCrossings = []string{model.RiverEasy, model.RiverHigh, model.RiverImpassable}
+)
+
+type ratingRequest struct {
+	Scenery    int `json:"scenery"`
+	Difficulty int `json:"difficulty"`
+	Navigation int `json:"navigation"`
+	Bogginess  int `json:"bogginess"`
+}
+
+type hillRatingsResponse struct {
+	*model.HillRatings
+	YourRating *model.Rating `json:"your_rating,omitempty"`
+}
+
+type conditionRequest struct {
+	ObservedOn     string `json:"observed_on"`
+	SnowCover      string `json:"snow_cover"`
+	Path           string `json:"path"`
+	RiverCrossings string `json:"river_crossings"`
+	Notes          string `json:"notes"`
+}
+
+type hillConditionsResponse struct {
+	Summary conditions.Summary      `json:"summary"`
+	Reports []model.ConditionReport `json:"reports"`
+}
+
+// Check an optional enumerated field, writing a 400 if it isn't one of the
+// allowed values
+func validChoice(w http.ResponseWriter, r *http.Request, field, value string, allowed []string) bool {
+	if value == "" {
+		return true
+	}
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	writeErrorDetails(w, r, field+" must be one of "+strings.Join(allowed, ", "), http.StatusBadRequest,
+		map[string]any{"field": field, "allowed": allowed})
+	return false
+}
+
+// Fill in how much each report still counts, dropping expired ones
+func weighConditions(reports []model.ConditionReport, now time.Time) []model.ConditionReport {
+	current := reports[:0]
+	for _, report := range reports {
+		if report.Weight = conditions.Weight(report.ObservedOn, now); report.Weight > 0 {
+			current = append(current, report)
+		}
+	}
+	return current
+}
+
+// Get the community ratings of a hill, with the logged-in user's own
+func (h *Handlers) HandleGetHillRatings(w http.ResponseWriter, r *http.Request) {
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	ratings, err := h.store.HillRatings(munro.DoBIHNumber)
+	if err != nil {
+		h.log(r).Error("Error reading ratings", "err", err)
+		writeError(w, r, "Failed to read ratings", http.StatusInternalServerError)
+		return
+	}
+
+	resp := hillRatingsResponse{HillRatings: ratings}
+	if user := h.optionalUser(r); user != nil {
+		resp.YourRating, _ = h.store.GetRating(user.ID, munro.DoBIHNumber)
+	}
+
+	h.writeJSONResponse(w, r, resp, http.StatusOK)
+}
+
+// Rate a hill, replacing any earlier rating by the logged-in user
+func (h *Handlers) HandleSetRating(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req ratingRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+	for _, score := range []int{req.Scenery, req.Difficulty, req.Navigation, req.Bogginess} {
+		if score < 1 || score > 5 {
+			writeError(w, r, "Scores must be from 1 to 5", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rating := &model.Rating{
+		UserID:     user.ID,
+		MunroID:    munro.DoBIHNumber,
+		Scenery:    req.Scenery,
+		Difficulty: req.Difficulty,
+		Navigation: req.Navigation,
+		Bogginess:  req.Bogginess,
+	}
+	if err := h.store.SetRating(rating); err != nil {
+		h.log(r).Error("Error saving rating", "err", err)
+		writeError(w, r, "Failed to save rating", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, rating, http.StatusOK)
+}
+
+func (h *Handlers) HandleDeleteRating(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteRating(user.ID, munro.DoBIHNumber); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Rating not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error deleting rating", "err", err)
+		writeError(w, r, "Failed to delete rating", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get a hill's current conditions: a summary weighted towards the newest
+// reports, and the reports that haven't expired
+func (h *Handlers) HandleGetHillConditions(w http.ResponseWriter, r *http.Request) {
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	reports, err := h.store.ListHillConditions(munro.DoBIHNumber, conditions.Cutoff(now))
+	if err != nil {
+		h.log(r).Error("Error listing conditions", "err", err)
+		writeError(w, r, "Failed to read conditions", http.StatusInternalServerError)
+		return
+	}
+
+	reports = weighConditions(reports, now)
+	h.writeJSONResponse(w, r, hillConditionsResponse{
+		Summary: conditions.Summarise(munro.DoBIHNumber, reports, now),
+		Reports: reports,
+	}, http.StatusOK)
+}
+
+// Report the conditions on a hill
+func (h *Handlers) HandleCreateCondition(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req conditionRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	report := &model.ConditionReport{
+		UserID:         user.ID,
+		AuthorName:     user.DisplayName,
+		MunroID:        munro.DoBIHNumber,
+		ObservedOn:     strings.TrimSpace(req.ObservedOn),
+		SnowCover:      strings.ToLower(strings.TrimSpace(req.SnowCover)),
+		Path:           strings.ToLower(strings.TrimSpace(req.Path)),
+		RiverCrossings: strings.ToLower(strings.TrimSpace(req.RiverCrossings)),
+		Notes:          strings.TrimSpace(req.Notes),
+	}
+
+	now := time.Now()
+	if report.ObservedOn == "" {
+		report.ObservedOn = now.In(ukTime).Format(time.DateOnly)
+	}
+	observed, err := time.Parse(time.DateOnly, report.ObservedOn)
+	if err != nil {
+		writeError(w, r, "observed_on must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+	if observed.After(now.Add(24 * time.Hour)) {
+		writeError(w, r, "observed_on is in the future", http.StatusBadRequest)
+		return
+	}
+
+	if !validChoice(w, r, "snow_cover", report.SnowCover, snowCovers) ||
+		!validChoice(w, r, "path", report.Path, pathStates) ||
+		!validChoice(w, r, "river_crossings", report.RiverCrossings, riverCrossings) {
+		return
+	}
+	if report.SnowCover == "" && report.Path == "" && report.RiverCrossings == "" {
+		writeError(w, r, "Report at least one of snow_cover, path or river_crossings", http.StatusBadRequest)
+		return
+	}
+	if len(report.Notes) > maxConditionNotes {
+		writeError(w, r, "Notes are too long", http.StatusBadRequest)
+		return
+	}
+
+	if report.Moderation, ok = h.moderationForPost(w, r, user); !ok {
+		return
+	}
+
+	if err := h.store.CreateCondition(report); err != nil {
+		h.log(r).Error("Error creating condition report", "err", err)
+		writeError(w, r, "Failed to save condition report", http.StatusInternalServerError)
+		return
+	}
+
+	report.Weight = conditions.Weight(report.ObservedOn, now)
+	h.writeJSONResponse(w, r, report, http.StatusCreated)
+}
+
+func (h *Handlers) HandleDeleteCondition(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid condition report ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.DeleteCondition(user.ID, id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Condition report not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error deleting condition report", "err", err)
+		writeError(w, r, "Failed to delete condition report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Feed of recent condition reports across all hills, newest first,
+// optionally for one SMC section (?section=4)
+func (h *Handlers) HandleGetRecentConditions(w http.ResponseWriter, r *http.Request) {
+	limit := defaultConditions
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, r, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxConditionsLimit)
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	reports, err := h.store.ListRecentConditions(conditions.Cutoff(now))
+	if err != nil {
+		h.log(r).Error("Error listing conditions", "err", err)
+		writeError(w, r, "Failed to read conditions", http.StatusInternalServerError)
+		return
+	}
+
+	section := r.URL.Query().Get("section")
+	feed := []model.ConditionReport{}
+	for _, report := range weighConditions(reports, now) {
+		if len(feed) == limit {
+			break
+		}
+		if section != "" && catalogue[report.MunroID].SMCSection != section {
+			continue
+		}
+		feed = append(feed, report)
+	}
+
+	h.writeJSONResponse(w, r, feed, http.StatusOK)
+}
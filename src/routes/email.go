@@ -0,0 +1,249 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/notify"
+	"github.com/AlexM141200/munros-api/src/store"
+	templates "github.com/AlexM141200/munros-api/src/views"
+)
+
+// How long an email sent outside a request may take
+const backgroundSendTimeout = 30 * time.Second
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Send an email without holding up the response to r, logging any failure
+func (h *Handlers) sendInBackground(r *http.Request, what string, send func(ctx context.Context) error) {
+	logger := h.log(r)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundSendTimeout)
+		defer cancel()
+		if err := send(ctx); err != nil && !errors.Is(err, notify.ErrTooSoon) {
+			logger.Error("Error sending email", "email", what, "err", err)
+		}
+	}()
+}
+
+// WaitForBackground waits for emails sent in the background to finish, or
+// for ctx to be done
+func (h *Handlers) WaitForBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send the logged-in user another verification link
+func (h *Handlers) HandleSendVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.EmailVerified {
+		writeError(w, r, "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	if err := h.notifier.SendVerification(r.Context(), user); err != nil {
+		if errors.Is(err, notify.ErrTooSoon) {
+			writeError(w, r, "A verification email was sent moments ago", http.StatusTooManyRequests)
+			return
+		}
+		h.log(r).Error("Error sending verification email", "err", err)
+		writeError(w, r, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Landing page for the link in a verification email
+func (h *Handlers) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token, err := h.store.TakeEmailToken(auth.HashToken(r.URL.Query().Get("token")), model.EmailTokenVerify)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		h.renderAccountMessage(w, r, http.StatusBadRequest, "Link expired",
+			"This confirmation link has expired or has already been used. You can ask for a new one from your account.")
+		return
+	case err != nil:
+		h.log(r).Error("Error reading email token", "err", err)
+		writeError(w, r, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.MarkEmailVerified(token.UserID, token.Email); err != nil {
+		h.log(r).Error("Error verifying email", "err", err)
+		writeError(w, r, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	h.renderAccountMessage(w, r, http.StatusOK, "Email confirmed", "Thanks, your email address is confirmed.")
+}
+
+// Ask for a password reset link. The response is the same whether or not
+// the address is registered, and the email is sent in the background so the
+// timing doesn't tell either.
+func (h *Handlers) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	user, err := h.store.GetUserByEmail(strings.TrimSpace(req.Email))
+	switch {
+	case err == nil:
+		h.sendInBackground(r, "password reset", func(ctx context.Context) error {
+			return h.notifier.SendPasswordReset(ctx, user)
+		})
+	case !errors.Is(err, store.ErrNotFound):
+		h.log(r).Error("Error looking up user", "err", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Set a new password with the token from a reset email
+func (h *Handlers) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	if status, problem := h.resetPassword(r, req.Token, req.Password); status != http.StatusOK {
+		writeError(w, r, problem, status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Page with the form for the link in a reset email
+func (h *Handlers) HandleResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	h.renderPage(w, r, http.StatusOK, templates.ResetPasswordPage(r.URL.Query().Get("token"), ""))
+}
+
+// Form target for the reset password page
+func (h *Handlers) HandleResetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	status, problem := h.resetPassword(r, token, r.FormValue("password"))
+	switch status {
+	case http.StatusOK:
+		h.renderAccountMessage(w, r, http.StatusOK, "Password changed", "Your password has been changed. You can now log in with it.")
+	case http.StatusBadRequest:
+		h.renderPage(w, r, status, templates.ResetPasswordPage(token, problem))
+	default:
+		writeError(w, r, problem, status)
+	}
+}
+
+// Check a reset token and new password and apply them, returning 200 or
+// the status and message to fail with
+func (h *Handlers) resetPassword(r *http.Request, token, password string) (int, string) {
+	// Checked first so a short password doesn't use up the link
+	if len(password) < auth.MinPasswordLength {
+		return http.StatusBadRequest, "Password is too short"
+	}
+
+	reset, err := h.store.TakeEmailToken(auth.HashToken(token), model.EmailTokenReset)
+	if errors.Is(err, store.ErrNotFound) {
+		return http.StatusBadRequest, "This reset link has expired or has already been used"
+	}
+	if err != nil {
+		h.log(r).Error("Error reading email token", "err", err)
+		return http.StatusInternalServerError, "Failed to reset password"
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		h.log(r).Error("Error hashing password", "err", err)
+		return http.StatusInternalServerError, "Failed to reset password"
+	}
+
+	err = h.store.ResetPassword(reset.UserID, reset.Email, hash)
+	if errors.Is(err, store.ErrNotFound) {
+		// The address changed or the account was deleted since the link was sent
+		return http.StatusBadRequest, "This reset link has expired or has already been used"
+	}
+	if err != nil {
+		h.log(r).Error("Error resetting password", "err", err)
+		return http.StatusInternalServerError, "Failed to reset password"
+	}
+
+	h.log(r).Info("Reset password", "user_id", reset.UserID)
+	return http.StatusOK, ""
+}
+
+// Get which optional emails the logged-in user receives
+func (h *Handlers) HandleGetEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := h.store.GetEmailPreferences(user.ID)
+	if err != nil {
+		h.log(r).Error("Error reading email preferences", "err", err)
+		writeError(w, r, "Failed to read email preferences", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, prefs, http.StatusOK)
+}
+
+// Choose which optional emails the logged-in user receives
+func (h *Handlers) HandleSetEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var prefs model.EmailPreferences
+	if !readJSONRequest(w, r, &prefs) {
+		return
+	}
+
+	if err := h.store.SetEmailPreferences(user.ID, &prefs); err != nil {
+		h.log(r).Error("Error saving email preferences", "err", err)
+		writeError(w, r, "Failed to save email preferences", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, prefs, http.StatusOK)
+}
+
+func (h *Handlers) renderAccountMessage(w http.ResponseWriter, r *http.Request, status int, title, message string) {
+	h.renderPage(w, r, status, templates.AccountMessagePage(title, message))
+}
+
+func (h *Handlers) renderPage(w http.ResponseWriter, r *http.Request, status int, page templ.Component) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := page.Render(r.Context(), w); err != nil {
+		h.log(r).Error("Error rendering template", "err", err)
+	}
+}
@@ -0,0 +1,170 @@
+package routes_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/mail"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/notify"
+	"github.com/AlexM141200/munros-api/src/routes"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+const siteURL = "http://munromark.test"
+
+type emailFixture struct {
+	handlers *routes.Handlers
+	router   http.Handler
+	store    *store.Store
+	mailer   *mail.Memory
+}
+
+func newEmailFixture(t *testing.T) *emailFixture {
+	t.Helper()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "munro.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	mailer := &mail.Memory{}
+	h := routes.New(routes.Deps{
+		Munros:   testMunros,
+		Store:    s,
+		Notifier: notify.New(s, mailer, testMunros, siteURL),
+	})
+	return &emailFixture{handlers: h, router: handlers.NewRouter(h), store: s, mailer: mailer}
+}
+
+func (f *emailFixture) do(t *testing.T, method, target, body string) *http.Response {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, r)
+	// Emails are sent in the background
+	if err := f.handlers.WaitForBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Result()
+}
+
+// The link to path in the one email to an address that has one, without
+// the site URL
+func (f *emailFixture) link(t *testing.T, to, path string) string {
+	t.Helper()
+
+	var found []string
+	pattern := regexp.MustCompile(regexp.QuoteMeta(siteURL+path) + `\?token=[A-Za-z0-9_-]+`)
+	for _, msg := range f.mailer.Messages() {
+		if msg.To != to {
+			continue
+		}
+		link := pattern.FindString(msg.Text)
+		if link == "" {
+			continue
+		}
+		if !strings.Contains(msg.HTML, link) {
+			t.Fatalf("email %q has the %s link only in its text", msg.Subject, path)
+		}
+		found = append(found, link)
+	}
+	if len(found) != 1 {
+		t.Fatalf("%d emails with a %s link sent to %s, want 1", len(found), path, to)
+	}
+	return strings.TrimPrefix(found[0], siteURL)
+}
+
+func TestVerificationEmail(t *testing.T) {
+	f := newEmailFixture(t)
+
+	resp := f.do(t, http.MethodPost, "/api/auth/register", `{"email": "walker@example.com", "password": "correct horse"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: status %d", resp.StatusCode)
+	}
+	link := f.link(t, "walker@example.com", "/auth/verify")
+
+	if resp := f.do(t, http.MethodGet, link, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify: status %d", resp.StatusCode)
+	}
+	user, err := f.store.GetUserByEmail("walker@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified {
+		t.Error("email not verified")
+	}
+
+	// Links work once
+	if resp := f.do(t, http.MethodGet, link, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("verify again: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestPasswordResetEmail(t *testing.T) {
+	f := newEmailFixture(t)
+
+	if resp := f.do(t, http.MethodPost, "/api/auth/register", `{"email": "walker@example.com", "password": "correct horse"}`); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: status %d", resp.StatusCode)
+	}
+
+	// Unknown addresses get the same answer, and no email
+	if resp := f.do(t, http.MethodPost, "/api/auth/password/forgot", `{"email": "stranger@example.com"}`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("forgot for an unknown address: status %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+	for _, msg := range f.mailer.Messages() {
+		if msg.To == "stranger@example.com" {
+			t.Error("email sent to an unregistered address")
+		}
+	}
+
+	// An API key made by whoever knew the old password
+	user, err := f.store.GetUserByEmail("walker@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &model.APIKey{UserID: user.ID, Name: "old", Prefix: "mm_old", Scopes: []string{model.ScopeAscentsRead}, RatePerMinute: 60, Burst: 10}
+	if err := f.store.CreateAPIKey(key, auth.HashToken("mm_old-key")); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := f.do(t, http.MethodPost, "/api/auth/password/forgot", `{"email": "walker@example.com"}`); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("forgot: status %d", resp.StatusCode)
+	}
+	link := f.link(t, "walker@example.com", "/auth/reset")
+	token := link[strings.Index(link, "=")+1:]
+
+	// A password that's too short doesn't use up the link
+	if resp := f.do(t, http.MethodPost, "/api/auth/password/reset", `{"token": "`+token+`", "password": "short"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reset with a short password: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if resp := f.do(t, http.MethodPost, "/api/auth/password/reset", `{"token": "`+token+`", "password": "battery staple"}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("reset: status %d", resp.StatusCode)
+	}
+	if resp := f.do(t, http.MethodPost, "/api/auth/password/reset", `{"token": "`+token+`", "password": "another one"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reset again: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	if resp := f.do(t, http.MethodPost, "/api/auth/login", `{"email": "walker@example.com", "password": "correct horse"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login with the old password: status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	if resp := f.do(t, http.MethodPost, "/api/auth/login", `{"email": "walker@example.com", "password": "battery staple"}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("login with the new password: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if _, _, err := f.store.GetAPIKeyByHash(auth.HashToken("mm_old-key")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("API key still valid after the reset (%v)", err)
+	}
+}
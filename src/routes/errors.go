@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/AlexM141200/munros-api/src/middleware"
+)
+
+// APIError is the body of every error response
+type APIError struct {
+	// Code is a stable machine-readable name for the kind of error
+	Code string `json:"code"`
+	// Message is for people and may change
+	Message string `json:"message"`
+	// Details says more where there's more to say, e.g. which field was wrong
+	Details any `json:"details,omitempty"`
+	// RequestID matches the X-Request-ID header and the server's logs
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Problem is the RFC 7807 form of an APIError, sent to clients that ask for
+// application/problem+json
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+const problemContentType = "application/problem+json"
+
+// Error codes by status. Handlers choose the status; the code follows it.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusNotImplemented:        "not_implemented",
+	http.StatusBadGateway:            "bad_gateway",
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "bad_request"
+}
+
+// Write an error response with message. Browsers asking for a page get it
+// as plain text; everyone else gets an APIError, or a Problem if they ask.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	writeErrorDetails(w, r, message, status, nil)
+}
+
+// Write an error response that says more in details
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, message string, status int, details any) {
+	header := w.Header()
+	// Whatever was set for a successful response no longer applies
+	header.Del("Content-Disposition")
+	header.Del("Content-Length")
+	header.Del("ETag")
+	header.Del("Last-Modified")
+	header.Del("Cache-Control")
+
+	body := any(APIError{
+		Code:      errorCode(status),
+		Message:   message,
+		Details:   details,
+		RequestID: middleware.RequestIDFrom(r.Context()),
+	})
+
+	switch errorFormat(r) {
+	case "text/html":
+		http.Error(w, message, status)
+		return
+	case problemContentType:
+		e := body.(APIError)
+		body = Problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    e.Message,
+			Instance:  r.URL.Path,
+			Code:      e.Code,
+			Details:   e.Details,
+			RequestID: e.RequestID,
+		}
+		header.Set("Content-Type", problemContentType)
+	default:
+		header.Set("Content-Type", "application/json")
+	}
+
+	header.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// The form of error the client would rather have: problem+json if it's
+// listed, a page if it asks for HTML rather than JSON, otherwise JSON
+func errorFormat(r *http.Request) string {
+	html := false
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case problemContentType:
+			return problemContentType
+		case "application/json":
+			return "application/json"
+		case "text/html":
+			html = true
+		}
+	}
+	if html {
+		return "text/html"
+	}
+	return "application/json"
+}
+
+// Answer API paths no route matches, rather than falling through to the site
+func (h *Handlers) HandleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, "No such endpoint", http.StatusNotFound)
+}
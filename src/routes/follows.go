@@ -0,0 +1,264 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+	templates "github.com/AlexM141200/munros-api/src/views"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+type feedResponse struct {
+	Items []model.FeedItem `json:"items"`
+	// NextCursor fetches the following page; it's empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Read the ID of the user named in the path, who mustn't be the logged-in user
+func followeeFromPath(w http.ResponseWriter, r *http.Request, user *model.User) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if id == user.ID {
+		writeError(w, r, "You can't follow yourself", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// Follow a user
+func (h *Handlers) HandleFollow(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := followeeFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Follow(user.ID, id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error following user", "err", err)
+		writeError(w, r, "Failed to follow user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stop following a user
+func (h *Handlers) HandleUnfollow(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := followeeFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Unfollow(user.ID, id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "You don't follow this user", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error unfollowing user", "err", err)
+		writeError(w, r, "Failed to unfollow user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stop a user following the logged-in user, so they no longer see the
+// ascents and achievements shown only to followers
+func (h *Handlers) HandleRemoveFollower(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.Unfollow(id, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "This user doesn't follow you", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error removing follower", "err", err)
+		writeError(w, r, "Failed to remove follower", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List the users the logged-in user follows
+func (h *Handlers) HandleGetFollowing(w http.ResponseWriter, r *http.Request) {
+	h.handleListFollows(w, r, h.store.ListFollowing)
+}
+
+// List the users following the logged-in user
+func (h *Handlers) HandleGetFollowers(w http.ResponseWriter, r *http.Request) {
+	h.handleListFollows(w, r, h.store.ListFollowers)
+}
+
+func (h *Handlers) handleListFollows(w http.ResponseWriter, r *http.Request, list func(int64) ([]model.Follow, error)) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	follows, err := list(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing follows", "err", err)
+		writeError(w, r, "Failed to read follows", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, follows, http.StatusOK)
+}
+
+// Cursors are opaque to clients: base64 of the last item's position
+func encodeFeedCursor(item *model.FeedItem) string {
+	data, _ := json.Marshal(model.FeedCursor{At: item.At, Type: item.Type, ID: item.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeFeedCursor(s string) (*model.FeedCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cursor model.FeedCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if _, ok := feedTypes[cursor.Type]; !ok {
+		return nil, errors.New("unknown item type")
+	}
+	return &cursor, nil
+}
+
+var feedTypes = map[string]struct{}{model.FeedAscent: {}, model.FeedAchievement: {}, model.FeedReport: {}}
+
+// Read a page of the logged-in user's feed as asked for by the cursor and
+// limit query parameters, writing an error on failure
+func (h *Handlers) feedPage(w http.ResponseWriter, r *http.Request, user *model.User) (*feedResponse, bool) {
+	query := r.URL.Query()
+
+	var after *model.FeedCursor
+	if c := query.Get("cursor"); c != "" {
+		var err error
+		if after, err = decodeFeedCursor(c); err != nil {
+			writeError(w, r, "Invalid cursor", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	limit := defaultFeedLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxFeedLimit {
+			writeError(w, r, "limit must be between 1 and "+strconv.Itoa(maxFeedLimit), http.StatusBadRequest)
+			return nil, false
+		}
+		limit = n
+	}
+
+	items, more, err := h.store.ListFeed(user.ID, after, limit)
+	if err != nil {
+		h.log(r).Error("Error reading feed", "err", err)
+		writeError(w, r, "Failed to read feed", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	page := &feedResponse{Items: items}
+	if page.Items == nil {
+		page.Items = []model.FeedItem{}
+	}
+	for i := range items {
+		switch items[i].Type {
+		case model.FeedAchievement:
+			awards := []model.Award{*items[i].Award}
+			h.describeAwards(awards)
+			items[i].Award = &awards[0]
+		case model.FeedReport:
+			// The feed links to reports rather than carrying them in full
+			items[i].Report.Body = ""
+		}
+	}
+	if more {
+		page.NextCursor = encodeFeedCursor(&items[len(items)-1])
+	}
+	return page, true
+}
+
+// Get the ascents, reports and achievements of the people the logged-in
+// user follows, newest first
+func (h *Handlers) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, ok := h.feedPage(w, r, user)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, page, http.StatusOK)
+}
+
+// Feed page on the site; later pages are loaded by HandleFeedItems
+func (h *Handlers) HandleFeedPage(w http.ResponseWriter, r *http.Request) {
+	h.renderFeed(w, r, false)
+}
+
+// The next page of feed items, as an HTMX partial
+func (h *Handlers) HandleFeedItems(w http.ResponseWriter, r *http.Request) {
+	h.renderFeed(w, r, true)
+}
+
+func (h *Handlers) renderFeed(w http.ResponseWriter, r *http.Request, partial bool) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, ok := h.feedPage(w, r, user)
+	if !ok {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	if partial {
+		h.renderPage(w, r, http.StatusOK, templates.FeedItems(page.Items, catalogue, page.NextCursor))
+		return
+	}
+	h.renderPage(w, r, http.StatusOK, templates.FeedPage(page.Items, catalogue, page.NextCursor))
+}
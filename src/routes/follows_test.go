@@ -0,0 +1,257 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/achievements"
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/routes"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+type feedFixture struct {
+	router http.Handler
+	store  *store.Store
+}
+
+type feedPage struct {
+	Items      []model.FeedItem `json:"items"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+func newFeedFixture(t *testing.T, rules []achievements.Rule) *feedFixture {
+	t.Helper()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "munro.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	h := routes.New(routes.Deps{Munros: testMunros, Store: s, Achievements: rules})
+	return &feedFixture{router: handlers.NewRouter(h), store: s}
+}
+
+// A user signed in with a session whose token is their name
+func (f *feedFixture) user(t *testing.T, name string) *model.User {
+	t.Helper()
+
+	user := &model.User{Email: name + "@example.com", DisplayName: name}
+	if err := f.store.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.CreateSession(auth.HashToken(name), user.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func (f *feedFixture) do(t *testing.T, as *model.User, method, target, body string) *http.Response {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+as.DisplayName)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, r)
+	return rec.Result()
+}
+
+func (f *feedFixture) follow(t *testing.T, follower, followee *model.User) {
+	t.Helper()
+	if resp := f.do(t, follower, http.MethodPost, fmt.Sprintf("/api/users/%d/follow", followee.ID), ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("follow: status %d", resp.StatusCode)
+	}
+}
+
+// Log an ascent of each hill, with the given visibility
+func (f *feedFixture) climb(t *testing.T, as *model.User, visibility string, munroIDs ...int) {
+	t.Helper()
+
+	var reqs []string
+	for _, id := range munroIDs {
+		reqs = append(reqs, fmt.Sprintf(`{"munro_id": %d, "climbed_at": "2024-06-21T12:00:00Z", "visibility": %q}`, id, visibility))
+	}
+	if resp := f.do(t, as, http.MethodPost, "/api/ascents", "["+strings.Join(reqs, ",")+"]"); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("log ascents: status %d", resp.StatusCode)
+	}
+}
+
+func (f *feedFixture) feed(t *testing.T, as *model.User, query string) feedPage {
+	t.Helper()
+
+	resp := f.do(t, as, http.MethodGet, "/api/feed"+query, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("feed%s: status %d", query, resp.StatusCode)
+	}
+	var page feedPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+// What each item is about: the hill climbed or the achievement earned
+func describeFeed(items []model.FeedItem) []string {
+	var described []string
+	for _, item := range items {
+		switch item.Type {
+		case model.FeedAscent:
+			described = append(described, fmt.Sprintf("%s climbed %d", item.DisplayName, item.Ascent.MunroID))
+		case model.FeedAchievement:
+			described = append(described, fmt.Sprintf("%s earned %s", item.DisplayName, item.Award.AchievementID))
+		}
+	}
+	slices.Sort(described)
+	return described
+}
+
+func TestFeedVisibility(t *testing.T) {
+	// Awarded for 1, 2 and 3 hills
+	var rules []achievements.Rule
+	for n := 1; n <= 3; n++ {
+		rules = append(rules, achievements.Rule{ID: fmt.Sprintf("hills-%d", n), Name: fmt.Sprintf("%d hills", n), Type: achievements.TypeCount, Count: n})
+	}
+	f := newFeedFixture(t, rules)
+
+	walker := f.user(t, "walker")
+	climber := f.user(t, "climber")
+	stranger := f.user(t, "stranger")
+	f.follow(t, walker, climber)
+
+	f.climb(t, climber, model.VisibilityPublic, 1)
+	f.climb(t, climber, model.VisibilityFollowers, 21)
+	f.climb(t, climber, model.VisibilityPrivate, 1010)
+	f.climb(t, stranger, model.VisibilityPublic, 22)
+
+	// The third achievement needs the private ascent, so stays private
+	want := []string{"climber climbed 1", "climber climbed 21", "climber earned hills-1", "climber earned hills-2"}
+	if got := describeFeed(f.feed(t, walker, "").Items); !slices.Equal(got, want) {
+		t.Errorf("follower's feed = %q, want %q", got, want)
+	}
+	// Nobody's feed has their own activity or that of people they don't follow
+	if got := f.feed(t, climber, "").Items; len(got) != 0 {
+		t.Errorf("climber's feed = %q, want it empty", describeFeed(got))
+	}
+
+	// Making the private ascent public shows it and the achievement
+	ascents, err := f.store.ListAscents(climber.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range ascents {
+		if a.MunroID == 1010 {
+			if resp := f.do(t, climber, http.MethodPut, fmt.Sprintf("/api/ascents/%d/visibility", a.ID), `{"visibility": "public"}`); resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("set visibility: status %d", resp.StatusCode)
+			}
+		}
+	}
+	want = []string{"climber climbed 1", "climber climbed 1010", "climber climbed 21", "climber earned hills-1", "climber earned hills-2", "climber earned hills-3"}
+	if got := describeFeed(f.feed(t, walker, "").Items); !slices.Equal(got, want) {
+		t.Errorf("follower's feed after publishing = %q, want %q", got, want)
+	}
+}
+
+func TestRemoveFollower(t *testing.T) {
+	f := newFeedFixture(t, nil)
+
+	walker := f.user(t, "walker")
+	climber := f.user(t, "climber")
+	f.follow(t, walker, climber)
+	f.climb(t, climber, model.VisibilityFollowers, 1)
+
+	if got := f.feed(t, walker, "").Items; len(got) != 1 {
+		t.Fatalf("follower's feed = %q, want the followers-only ascent", describeFeed(got))
+	}
+
+	target := fmt.Sprintf("/api/me/followers/%d", walker.ID)
+	if resp := f.do(t, climber, http.MethodDelete, target, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("remove follower: status %d", resp.StatusCode)
+	}
+	if got := f.feed(t, walker, "").Items; len(got) != 0 {
+		t.Errorf("removed follower's feed = %q, want it empty", describeFeed(got))
+	}
+	following, err := f.store.ListFollowing(walker.ID)
+	if err != nil || len(following) != 0 {
+		t.Errorf("removed follower still follows %+v (%v)", following, err)
+	}
+
+	if resp := f.do(t, climber, http.MethodDelete, target, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("remove again: status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if resp := f.do(t, climber, http.MethodDelete, "/api/me/followers/walker", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("remove with a bad ID: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestFeedPagination(t *testing.T) {
+	f := newFeedFixture(t, nil)
+
+	walker := f.user(t, "walker")
+	climber := f.user(t, "climber")
+	hillwalker := f.user(t, "hillwalker")
+	f.follow(t, walker, climber)
+	f.follow(t, walker, hillwalker)
+
+	// Ascents logged together share a time, so only their IDs order them
+	f.climb(t, climber, model.VisibilityPublic, 1, 21, 22, 1010)
+	f.climb(t, hillwalker, model.VisibilityPublic, 1030, 1, 21)
+	f.climb(t, climber, model.VisibilityFollowers, 22)
+
+	all := f.feed(t, walker, "?limit=100")
+	if len(all.Items) != 8 || all.NextCursor != "" {
+		t.Fatalf("whole feed has %d items and cursor %q, want 8 and none", len(all.Items), all.NextCursor)
+	}
+	for i := 1; i < len(all.Items); i++ {
+		a, b := all.Items[i-1], all.Items[i]
+		if a.At.Before(b.At) || (a.At.Equal(b.At) && a.ID < b.ID) {
+			t.Errorf("item %d (%v, %d) is newer than item %d (%v, %d)", i, b.At, b.ID, i-1, a.At, a.ID)
+		}
+	}
+
+	var paged []model.FeedItem
+	var sizes []int
+	query := "?limit=3"
+	for {
+		page := f.feed(t, walker, query)
+		paged = append(paged, page.Items...)
+		sizes = append(sizes, len(page.Items))
+		if page.NextCursor == "" {
+			break
+		}
+		if len(sizes) > 5 {
+			t.Fatal("pagination doesn't end")
+		}
+		query = "?limit=3&cursor=" + url.QueryEscape(page.NextCursor)
+	}
+	if !slices.Equal(sizes, []int{3, 3, 2}) {
+		t.Errorf("page sizes %v, want [3 3 2]", sizes)
+	}
+	if len(paged) != len(all.Items) {
+		t.Fatalf("pages hold %d items, want %d", len(paged), len(all.Items))
+	}
+	for i := range paged {
+		if paged[i].Type != all.Items[i].Type || paged[i].ID != all.Items[i].ID {
+			t.Errorf("paged item %d is %s %d, want %s %d", i, paged[i].Type, paged[i].ID, all.Items[i].Type, all.Items[i].ID)
+		}
+	}
+
+	for _, query := range []string{"?cursor=not-a-cursor", "?limit=0", "?limit=101", "?limit=many"} {
+		if resp := f.do(t, walker, http.MethodGet, "/api/feed"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("feed%s: status %d, want %d", query, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/progress"
+	"github.com/AlexM141200/munros-api/src/store"
+	templates "github.com/AlexM141200/munros-api/src/views"
+)
+
+type groupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type joinGroupRequest struct {
+	JoinCode string `json:"join_code"`
+}
+
+// Load the group named by the {id} path value, writing an error on failure.
+// The join code is hidden from anyone who isn't a member.
+func (h *Handlers) groupFromPath(w http.ResponseWriter, r *http.Request) (*model.Group, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid group ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	group, err := h.store.GetGroup(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Group not found", http.StatusNotFound)
+			return nil, false
+		}
+		h.log(r).Error("Error reading group", "err", err)
+		writeError(w, r, "Failed to read group", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	member := false
+	if user := h.optionalUser(r); user != nil {
+		member, _ = h.store.IsGroupMember(group.ID, user.ID)
+	}
+	if !member {
+		group.JoinCode = ""
+	}
+
+	return group, true
+}
+
+// Load a group's members and their ascents, writing an error on failure
+func (h *Handlers) groupActivity(w http.ResponseWriter, r *http.Request, group *model.Group) ([]model.Munro, []model.GroupMember, []model.Ascent, bool) {
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+
+	members, err := h.store.ListGroupMembers(group.ID)
+	if err != nil {
+		h.log(r).Error("Error listing group members", "err", err)
+		writeError(w, r, "Failed to read group", http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+
+	ascents, err := h.store.ListGroupAscents(group.ID)
+	if err != nil {
+		h.log(r).Error("Error listing group ascents", "err", err)
+		writeError(w, r, "Failed to read group", http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+
+	return munros, members, ascents, true
+}
+
+// Create a group owned by the logged-in user
+func (h *Handlers) HandleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req groupRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	group := &model.Group{
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		OwnerID:     user.ID,
+	}
+	if group.Name == "" {
+		writeError(w, r, "Group name is required", http.StatusBadRequest)
+		return
+	}
+
+	code, err := auth.NewToken()
+	if err != nil {
+		h.log(r).Error("Error generating join code", "err", err)
+		writeError(w, r, "Failed to create group", http.StatusInternalServerError)
+		return
+	}
+	group.JoinCode = code[:12]
+
+	if err := h.store.CreateGroup(group); err != nil {
+		h.log(r).Error("Error creating group", "err", err)
+		writeError(w, r, "Failed to create group", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, group, http.StatusCreated)
+}
+
+// List the logged-in user's groups
+func (h *Handlers) HandleGetGroups(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	groups, err := h.store.ListUserGroups(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing groups", "err", err)
+		writeError(w, r, "Failed to read groups", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, groups, http.StatusOK)
+}
+
+// Get a group
+func (h *Handlers) HandleGetGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.groupFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, group, http.StatusOK)
+}
+
+// Join a group using its join code
+func (h *Handlers) HandleJoinGroup(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req joinGroupRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	group, err := h.store.GetGroupByJoinCode(strings.TrimSpace(req.JoinCode))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Invalid join code", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error reading group", "err", err)
+		writeError(w, r, "Failed to join group", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.AddGroupMember(group.ID, user.ID); err != nil {
+		h.log(r).Error("Error joining group", "err", err)
+		writeError(w, r, "Failed to join group", http.StatusInternalServerError)
+		return
+	}
+
+	group, err = h.store.GetGroup(group.ID)
+	if err != nil {
+		h.log(r).Error("Error reading group", "err", err)
+		writeError(w, r, "Failed to read group", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, group, http.StatusOK)
+}
+
+// Leave a group. Owners can't leave the group they run.
+func (h *Handlers) HandleLeaveGroup(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	group, ok := h.groupFromPath(w, r)
+	if !ok {
+		return
+	}
+	if group.OwnerID == user.ID {
+		writeError(w, r, "Owners can't leave their own group", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.RemoveGroupMember(group.ID, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Not a member of this group", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error leaving group", "err", err)
+		writeError(w, r, "Failed to leave group", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Get a group's combined progress and leaderboards. ?year= picks the year for
+// the "this year" board and defaults to the current one.
+func (h *Handlers) HandleGroupLeaderboard(w http.ResponseWriter, r *http.Request) {
+	year := time.Now().Year()
+	if value := r.URL.Query().Get("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, r, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		year = parsed
+	}
+
+	group, ok := h.groupFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	munros, members, ascents, ok := h.groupActivity(w, r, group)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, progress.Group(munros, members, ascents, year), http.StatusOK)
+}
+
+// Get the first member to bag each hill
+func (h *Handlers) HandleGroupRecords(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.groupFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	munros, members, ascents, ok := h.groupActivity(w, r, group)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, progress.FirstToBagRecords(munros, members, ascents), http.StatusOK)
+}
+
+func (h *Handlers) HandleGroupPage(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.groupFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	munros, members, ascents, ok := h.groupActivity(w, r, group)
+	if !ok {
+		return
+	}
+
+	// Set content type
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// Render the group page template
+	err := templates.GroupPage(
+		group,
+		progress.Group(munros, members, ascents, time.Now().Year()),
+		progress.FirstToBagRecords(munros, members, ascents),
+	).Render(r.Context(), w)
+	if err != nil {
+		h.log(r).Error("Error rendering template", "err", err)
+		writeError(w, r, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+}
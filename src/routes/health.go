@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/buildinfo"
+	"github.com/AlexM141200/munros-api/src/dataset"
+)
+
+// How long the database has to answer a readiness check
+const readyTimeout = 2 * time.Second
+
+type healthResponse struct {
+	Status string `json:"status"`
+	// The outcome of each check: "ok" or what's wrong
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type versionResponse struct {
+	buildinfo.Info
+	Dataset *datasetVersion `json:"dataset"`
+}
+
+type datasetVersion struct {
+	dataset.File
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// Liveness: the process is up and serving requests
+func (h *Handlers) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	h.writeJSONResponse(w, r, healthResponse{Status: "ok"}, http.StatusOK)
+}
+
+// Readiness: the catalogue has loaded and the database answers, so the
+// server can be sent traffic. Otherwise it's a 503 saying which check
+// failed.
+func (h *Handlers) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"dataset": "ok"}
+	ready := true
+
+	if h.dataset != nil {
+		if !h.dataset.Stats().Loaded {
+			checks["dataset"] = "not loaded"
+			ready = false
+		}
+	} else if h.munros == nil {
+		checks["dataset"] = "not configured"
+		ready = false
+	}
+
+	if h.store != nil {
+		checks["database"] = "ok"
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := h.store.DB().PingContext(ctx); err != nil {
+			h.log(r).Warn("Database not reachable", "err", err)
+			checks["database"] = "unreachable"
+			ready = false
+		}
+	}
+
+	if !ready {
+		h.writeJSONResponse(w, r, healthResponse{Status: "unavailable", Checks: checks}, http.StatusServiceUnavailable)
+		return
+	}
+	h.writeJSONResponse(w, r, healthResponse{Status: "ok", Checks: checks}, http.StatusOK)
+}
+
+// The running build and the catalogue file it has loaded
+func (h *Handlers) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	response := versionResponse{Info: buildinfo.Get()}
+	if h.dataset != nil {
+		if file := h.dataset.File(); file != nil {
+			response.Dataset = &datasetVersion{File: *file, LoadedAt: h.dataset.LoadedAt()}
+		}
+	}
+	h.writeJSONResponse(w, r, response, http.StatusOK)
+}
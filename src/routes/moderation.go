@@ -0,0 +1,339 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+	templates "github.com/AlexM141200/munros-api/src/views"
+)
+
+const (
+	// Accounts younger than this have their posts held for review and are
+	// limited in how much they can post
+	newAccountAge = 7 * 24 * time.Hour
+	// Posts a new account can make in a day, across reports, photos and
+	// condition reports
+	newAccountDailyPosts = 5
+	maxFlagReason        = 500
+	auditLogLength       = 100
+)
+
+type flagRequest struct {
+	ContentType string `json:"content_type"`
+	ContentID   int64  `json:"content_id"`
+	Reason      string `json:"reason"`
+}
+
+type moderateRequest struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+func isNewAccount(user *model.User) bool {
+	return time.Since(user.CreatedAt) < newAccountAge
+}
+
+// Decide the moderation status of something a user is about to post. New
+// accounts are held for review and rate limited; a 429 is written if they've
+// posted too much today.
+func (h *Handlers) moderationForPost(w http.ResponseWriter, r *http.Request, user *model.User) (string, bool) {
+	if user.IsAdmin() || !isNewAccount(user) {
+		return model.ModerationApproved, true
+	}
+
+	posts, err := h.store.CountUserPostsSince(user.ID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		h.log(r).Error("Error counting posts", "err", err)
+		writeError(w, r, "Failed to check posting limit", http.StatusInternalServerError)
+		return "", false
+	}
+	if posts >= newAccountDailyPosts {
+		w.Header().Set("Retry-After", "3600")
+		writeError(w, r, fmt.Sprintf("New accounts can post %d times a day", newAccountDailyPosts), http.StatusTooManyRequests)
+		return "", false
+	}
+
+	return model.ModerationPending, true
+}
+
+// Moderation status after an author edits their content: new accounts go
+// back into the queue, everyone else keeps the status they had
+func moderationForEdit(user *model.User, current string) string {
+	if current == model.ModerationApproved && isNewAccount(user) && !user.IsAdmin() {
+		return model.ModerationPending
+	}
+	return current
+}
+
+// Whether content is visible to the user viewing it: approved content is
+// public, anything else only to its author and admins
+func canView(user *model.User, authorID int64, moderation string) bool {
+	if moderation == model.ModerationApproved {
+		return true
+	}
+	return user != nil && (user.ID == authorID || user.IsAdmin())
+}
+
+// Look up the logged-in user, writing a 403 unless they're an admin
+func (h *Handlers) currentAdmin(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !user.IsAdmin() {
+		writeError(w, r, "Admin access required", http.StatusForbidden)
+		return nil, false
+	}
+	return user, true
+}
+
+// Where a moderator can see a piece of content
+func contentURL(item *model.QueueItem) string {
+	switch item.ContentType {
+	case model.ContentReport:
+		return fmt.Sprintf("/reports/%d", item.ContentID)
+	case model.ContentPhoto:
+		return fmt.Sprintf("/api/photos/%d/original", item.ContentID)
+	default:
+		return fmt.Sprintf("/munros/%d", item.MunroID)
+	}
+}
+
+func (h *Handlers) moderationQueue() ([]model.QueueItem, error) {
+	queue, err := h.store.ModerationQueue()
+	if err != nil {
+		return nil, err
+	}
+	for i := range queue {
+		queue[i].URL = contentURL(&queue[i])
+	}
+	return queue, nil
+}
+
+// Apply a moderator's action, writing an error on failure
+func (h *Handlers) moderate(w http.ResponseWriter, r *http.Request, admin *model.User, contentType, id, action, note string) bool {
+	contentID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid content ID", http.StatusBadRequest)
+		return false
+	}
+
+	switch action {
+	case model.ActionApprove, model.ActionReject, model.ActionHide:
+	default:
+		writeError(w, r, "action must be approve, reject or hide", http.StatusBadRequest)
+		return false
+	}
+
+	// Approving a published report is when it first goes public
+	var before *model.Report
+	if contentType == model.ContentReport && action == model.ActionApprove {
+		before, _ = h.store.GetReport(contentID)
+	}
+
+	if err := h.store.Moderate(admin.ID, contentType, contentID, action, strings.TrimSpace(note)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Content not found", http.StatusNotFound)
+			return false
+		}
+		h.log(r).Error("Error moderating content", "err", err)
+		writeError(w, r, "Failed to moderate content", http.StatusInternalServerError)
+		return false
+	}
+
+	if before != nil {
+		after := *before
+		after.Moderation = model.ModerationApproved
+		h.renderReport(r, &after)
+		h.publishReport(r, before, &after)
+	}
+
+	return true
+}
+
+// Report someone else's content to the moderators
+func (h *Handlers) HandleCreateFlag(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req flagRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	flag := &model.Flag{
+		ReporterID:  user.ID,
+		ContentType: req.ContentType,
+		ContentID:   req.ContentID,
+		Reason:      strings.TrimSpace(req.Reason),
+	}
+	if flag.Reason == "" {
+		writeError(w, r, "A reason is required", http.StatusBadRequest)
+		return
+	}
+	if len(flag.Reason) > maxFlagReason {
+		writeError(w, r, "Reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.store.ContentAuthor(flag.ContentType, flag.ContentID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Content not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error reading content", "err", err)
+		writeError(w, r, "Failed to report content", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.CreateFlag(flag); err != nil {
+		h.log(r).Error("Error creating flag", "err", err)
+		writeError(w, r, "Failed to report content", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// List content awaiting moderation
+func (h *Handlers) HandleGetModerationQueue(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentAdmin(w, r); !ok {
+		return
+	}
+
+	queue, err := h.moderationQueue()
+	if err != nil {
+		h.log(r).Error("Error reading moderation queue", "err", err)
+		writeError(w, r, "Failed to read moderation queue", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, queue, http.StatusOK)
+}
+
+// Approve, reject or hide a piece of content
+func (h *Handlers) HandleModerateContent(w http.ResponseWriter, r *http.Request) {
+	admin, ok := h.currentAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req moderateRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	if h.moderate(w, r, admin, r.PathValue("type"), r.PathValue("id"), req.Action, req.Note) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// List recent moderator actions
+func (h *Handlers) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentAdmin(w, r); !ok {
+		return
+	}
+
+	actions, err := h.store.ListModerationActions(auditLogLength)
+	if err != nil {
+		h.log(r).Error("Error reading audit log", "err", err)
+		writeError(w, r, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, actions, http.StatusOK)
+}
+
+// Make a user an admin or take it away
+func (h *Handlers) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	admin, ok := h.currentAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req roleRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+	if req.Role != model.RoleUser && req.Role != model.RoleAdmin {
+		writeError(w, r, "role must be user or admin", http.StatusBadRequest)
+		return
+	}
+	if id == admin.ID && req.Role != model.RoleAdmin {
+		writeError(w, r, "You can't remove your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.SetUserRoleAudited(admin.ID, id, req.Role); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error setting role", "err", err)
+		writeError(w, r, "Failed to set role", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Admin page with the moderation queue and audit log
+func (h *Handlers) HandleAdminPage(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentAdmin(w, r); !ok {
+		return
+	}
+
+	queue, err := h.moderationQueue()
+	if err != nil {
+		h.log(r).Error("Error reading moderation queue", "err", err)
+		writeError(w, r, "Failed to read moderation queue", http.StatusInternalServerError)
+		return
+	}
+
+	actions, err := h.store.ListModerationActions(auditLogLength)
+	if err != nil {
+		h.log(r).Error("Error reading audit log", "err", err)
+		writeError(w, r, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+
+	// Set content type
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// Render the admin page template
+	if err := templates.AdminPage(queue, actions).Render(r.Context(), w); err != nil {
+		h.log(r).Error("Error rendering template", "err", err)
+		writeError(w, r, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Form target for the buttons on the admin page
+func (h *Handlers) HandleAdminModerateForm(w http.ResponseWriter, r *http.Request) {
+	admin, ok := h.currentAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	if h.moderate(w, r, admin, r.PathValue("type"), r.PathValue("id"), r.PathValue("action"), r.FormValue("note")) {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,169 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/routes"
+)
+
+// A catalogue that never changes
+type fixedMunros []model.Munro
+
+func (m fixedMunros) ReadMunros() ([]model.Munro, error) { return m, nil }
+
+type brokenMunros struct{}
+
+func (brokenMunros) ReadMunros() ([]model.Munro, error) {
+	return nil, errors.New("catalogue file missing")
+}
+
+var testMunros = fixedMunros{
+	{RunningNo: 1, DoBIHNumber: 1, Name: "Ben Nevis", SMCSection: "04A: Fort William to Loch Ericht", HeightM: 1345, Classification: "Munro"},
+	{RunningNo: 2, DoBIHNumber: 21, Name: "Carn Mor Dearg", SMCSection: "04A: Fort William to Loch Ericht", HeightM: 1220, Classification: "Munro"},
+	{RunningNo: 3, DoBIHNumber: 22, Name: "Carn Dearg (NW)", SMCSection: "04A: Fort William to Loch Ericht", HeightM: 1221, Classification: "Top"},
+	{RunningNo: 4, DoBIHNumber: 1010, Name: "Ben Macdui", SMCSection: "08A: Cairngorms", HeightM: 1309, Classification: "Munro"},
+	{RunningNo: 5, DoBIHNumber: 1030, Name: "Sgor an Lochain Uaine", SMCSection: "08A: Cairngorms", HeightM: 1258, Classification: "Munro"},
+}
+
+func newCatalogueServer(t *testing.T, munros routes.DataService) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handlers.NewRouter(routes.New(routes.Deps{Munros: munros})))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func getJSON(t *testing.T, url string, v any) *http.Response {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s: Content-Type %q", url, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("%s: %v", url, err)
+	}
+	return resp
+}
+
+func names(munros []model.Munro) []string {
+	var names []string
+	for _, m := range munros {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func TestGetMunros(t *testing.T) {
+	server := newCatalogueServer(t, testMunros)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Ben Nevis", "Carn Mor Dearg", "Carn Dearg (NW)", "Ben Macdui", "Sgor an Lochain Uaine"}},
+		{"?classification=munro", []string{"Ben Nevis", "Carn Mor Dearg", "Ben Macdui", "Sgor an Lochain Uaine"}},
+		{"?classification=Top", []string{"Carn Dearg (NW)"}},
+		{"?min_height=1300", []string{"Ben Nevis", "Ben Macdui"}},
+		{"?min_height=1221", []string{"Ben Nevis", "Carn Dearg (NW)", "Ben Macdui", "Sgor an Lochain Uaine"}},
+		// A height that isn't a number is ignored
+		{"?min_height=high", []string{"Ben Nevis", "Carn Mor Dearg", "Carn Dearg (NW)", "Ben Macdui", "Sgor an Lochain Uaine"}},
+		{"?section=cairngorms", []string{"Ben Macdui", "Sgor an Lochain Uaine"}},
+		{"?section=04A", []string{"Ben Nevis", "Carn Mor Dearg", "Carn Dearg (NW)"}},
+		{"?search=BEN", []string{"Ben Nevis", "Ben Macdui"}},
+		{"?search=dearg&classification=munro", []string{"Carn Mor Dearg"}},
+		{"?section=08A&min_height=1300&search=mac", []string{"Ben Macdui"}},
+		{"?search=schiehallion", nil},
+	}
+
+	for _, path := range []string{"/api/munros", "/api/munros/all"} {
+		for _, tt := range tests {
+			t.Run(path+tt.query, func(t *testing.T) {
+				var got []model.Munro
+				resp := getJSON(t, server.URL+path+tt.query, &got)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("status %d", resp.StatusCode)
+				}
+				if g := names(got); !equal(g, tt.want) {
+					t.Errorf("got %q, want %q", g, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetMunroByID(t *testing.T) {
+	server := newCatalogueServer(t, testMunros)
+
+	tests := []struct {
+		id     string
+		status int
+		want   string
+	}{
+		{"1", http.StatusOK, "Ben Nevis"},
+		// Running number
+		{"4", http.StatusOK, "Ben Macdui"},
+		// DoBIH number
+		{"1030", http.StatusOK, "Sgor an Lochain Uaine"},
+		{"999", http.StatusNotFound, ""},
+		{"ben-nevis", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if tt.status != http.StatusOK {
+				var body struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				}
+				resp := getJSON(t, server.URL+"/api/munros/"+tt.id, &body)
+				if resp.StatusCode != tt.status || body.Code != "not_found" {
+					t.Errorf("status %d, code %q, want %d not_found", resp.StatusCode, body.Code, tt.status)
+				}
+				return
+			}
+
+			var got model.Munro
+			resp := getJSON(t, server.URL+"/api/munros/"+tt.id, &got)
+			if resp.StatusCode != tt.status || got.Name != tt.want {
+				t.Errorf("status %d, %q, want %d %q", resp.StatusCode, got.Name, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMunrosCatalogueUnavailable(t *testing.T) {
+	server := newCatalogueServer(t, brokenMunros{})
+
+	for _, path := range []string{"/api/munros", "/api/munros/1"} {
+		var body struct {
+			Code string `json:"code"`
+		}
+		resp := getJSON(t, server.URL+path, &body)
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("%s: status %d, want %d", path, resp.StatusCode, http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/middleware"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/oidc"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+const (
+	// How long a user has to finish signing in with a provider
+	oidcLoginTTL = 10 * time.Minute
+	// Binds a sign-in to the browser that started it
+	oidcStateCookie = "munromark_oidc_state"
+)
+
+type providerResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+func (h *Handlers) findProvider(name string) *oidc.Provider {
+	for _, p := range h.providers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Where the provider sends the user back to
+func oidcRedirectURL(r *http.Request, p *oidc.Provider) string {
+	if p.RedirectURL != "" {
+		return p.RedirectURL
+	}
+	return baseURL(r) + "/auth/oidc/" + p.Name + "/callback"
+}
+
+// Only return to paths on this site after signing in
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// List the configured sign-in providers
+func (h *Handlers) HandleGetAuthProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]providerResponse, 0, len(h.providers))
+	for _, p := range h.providers {
+		providers = append(providers, providerResponse{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			LoginURL:    "/auth/oidc/" + p.Name,
+		})
+	}
+
+	h.writeJSONResponse(w, r, providers, http.StatusOK)
+}
+
+// Start signing in with a provider. The browser is redirected there, and
+// comes back to HandleOIDCCallback. ?next= is where to go afterwards.
+func (h *Handlers) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider := h.findProvider(r.PathValue("provider"))
+	if provider == nil {
+		writeError(w, r, "Unknown sign-in provider", http.StatusNotFound)
+		return
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		token, err := auth.NewToken()
+		if err != nil {
+			h.log(r).Error("Error generating sign-in state", "err", err)
+			writeError(w, r, "Failed to start sign-in", http.StatusInternalServerError)
+			return
+		}
+		secrets[i] = token
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	login := &model.PendingLogin{
+		StateHash: auth.HashToken(state),
+		Provider:  provider.Name,
+		Nonce:     nonce,
+		Verifier:  verifier,
+		Next:      localPath(r.URL.Query().Get("next")),
+		ExpiresAt: time.Now().Add(oidcLoginTTL),
+	}
+
+	target, err := provider.AuthCodeURL(r.Context(), oidcRedirectURL(r, provider), state, nonce, verifier)
+	if err != nil {
+		h.log(r).Error("Error contacting sign-in provider", "provider", provider.Name, "err", err)
+		writeError(w, r, "Sign-in provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	if err := h.store.CreatePendingLogin(login); err != nil {
+		h.log(r).Error("Error saving sign-in", "err", err)
+		writeError(w, r, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   middleware.IsHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// Finish signing in: check the provider's response, find or create the
+// user, start a session and return to where the sign-in began
+func (h *Handlers) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider := h.findProvider(r.PathValue("provider"))
+	if provider == nil {
+		writeError(w, r, "Unknown sign-in provider", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		h.log(r).Warn("Sign-in failed", "provider", provider.Name, "error", e, "description", query.Get("error_description"))
+		writeError(w, r, "Sign-in was not completed", http.StatusUnauthorized)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		writeError(w, r, "Sign-in was started in another browser or has expired", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc/", MaxAge: -1, Secure: middleware.IsHTTPS(r)})
+
+	login, err := h.store.TakePendingLogin(auth.HashToken(state))
+	if err != nil || login.Provider != provider.Name {
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			h.log(r).Error("Error reading sign-in", "err", err)
+		}
+		writeError(w, r, "Sign-in has expired; please try again", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), oidcRedirectURL(r, provider), query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		h.log(r).Error("Error completing sign-in", "provider", provider.Name, "err", err)
+		writeError(w, r, "Sign-in failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, ok := h.identityUser(w, r, provider, claims)
+	if !ok {
+		return
+	}
+
+	if _, _, ok := h.createSession(w, r, user); !ok {
+		return
+	}
+	http.Redirect(w, r, login.Next, http.StatusSeeOther)
+}
+
+// Find the user a provider account belongs to. Accounts not seen before are
+// linked to the user with the same verified email address, or a new user is
+// created.
+func (h *Handlers) identityUser(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, claims *oidc.Claims) (*model.User, bool) {
+	user, err := h.store.GetIdentityUser(provider.Name, claims.Subject)
+	if err == nil {
+		return user, true
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		h.log(r).Error("Error looking up identity", "err", err)
+		writeError(w, r, "Failed to sign in", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		writeError(w, r, "Your "+provider.DisplayName+" account has no verified email address", http.StatusForbidden)
+		return nil, false
+	}
+
+	user, err = h.store.GetUserByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// Anyone could have registered an unverified address with a password
+		// before its owner signed in, so only the provider is trusted from
+		// now on. A verified account has already proved who owns it.
+		if !user.EmailVerified {
+			if err := h.store.RevokeCredentials(user.ID); err != nil {
+				h.log(r).Error("Error revoking credentials", "err", err)
+				writeError(w, r, "Failed to sign in", http.StatusInternalServerError)
+				return nil, false
+			}
+			user.PasswordHash = ""
+			if err := h.store.MarkEmailVerified(user.ID, user.Email); err != nil {
+				h.log(r).Error("Error verifying email", "err", err)
+				writeError(w, r, "Failed to sign in", http.StatusInternalServerError)
+				return nil, false
+			}
+			user.EmailVerified = true
+		}
+	case errors.Is(err, store.ErrNotFound):
+		user = &model.User{Email: claims.Email, DisplayName: strings.TrimSpace(claims.Name), EmailVerified: true}
+		if user.DisplayName == "" {
+			user.DisplayName, _, _ = strings.Cut(claims.Email, "@")
+		}
+		if err := h.store.CreateUser(user); err != nil {
+			h.log(r).Error("Error creating user", "err", err)
+			writeError(w, r, "Failed to create account", http.StatusInternalServerError)
+			return nil, false
+		}
+	default:
+		h.log(r).Error("Error looking up user", "err", err)
+		writeError(w, r, "Failed to sign in", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	identity := &model.Identity{UserID: user.ID, Provider: provider.Name, Subject: claims.Subject, Email: claims.Email}
+	if err := h.store.LinkIdentity(identity); err != nil {
+		h.log(r).Error("Error linking identity", "err", err)
+		writeError(w, r, "Failed to sign in", http.StatusInternalServerError)
+		return nil, false
+	}
+	h.log(r).Info("Linked account", "provider", provider.Name, "user_id", user.ID)
+
+	return user, true
+}
+
+// List the sign-in providers linked to the logged-in user
+func (h *Handlers) HandleGetIdentities(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := h.store.ListIdentities(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing identities", "err", err)
+		writeError(w, r, "Failed to read linked accounts", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, identities, http.StatusOK)
+}
@@ -0,0 +1,504 @@
+package routes_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/middleware"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/oidc"
+	"github.com/AlexM141200/munros-api/src/routes"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+const (
+	testClientID     = "munromark"
+	testClientSecret = "client-secret"
+	testKeyID        = "key-1"
+)
+
+// A stand-in OpenID provider serving discovery, keys and a token endpoint.
+// The token endpoint returns whatever ID token the test builds for the
+// nonce of the sign-in in progress.
+type fakeProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// Builds the ID token returned for a sign-in with this nonce
+	idToken func(nonce string) string
+
+	nonce     string
+	challenge string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Metadata{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("client_id") != testClientID || r.PostFormValue("client_secret") != testClientSecret ||
+			oidc.CodeChallenge(r.PostFormValue("code_verifier")) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken(p.nonce)})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// The claims of a valid ID token for a new user
+func (p *fakeProvider) claims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":            p.server.URL,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "walker@example.com",
+		"email_verified": true,
+		"name":           "Hill Walker",
+	}
+}
+
+// A token signed with key under the given algorithm. key is ignored for
+// "none", and is the HMAC secret for HS256.
+func signToken(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+
+	segment := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(map[string]string{"alg": alg, "kid": testKeyID, "typ": "JWT"}) + "." + segment(claims)
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(key.(string)))
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+type oidcFixture struct {
+	provider *fakeProvider
+	store    *store.Store
+	handler  http.Handler
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "munro.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	p := newFakeProvider(t)
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		DisplayName:  "Test",
+		DiscoveryURL: p.server.URL + "/.well-known/openid-configuration",
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+	}, p.server.Client())
+
+	h := routes.New(routes.Deps{Store: s, Providers: []*oidc.Provider{provider}})
+	return &oidcFixture{provider: p, store: s, handler: handlers.NewRouter(h)}
+}
+
+func (f *oidcFixture) do(r *http.Request) *http.Response {
+	rec := httptest.NewRecorder()
+	f.handler.ServeHTTP(rec, r)
+	return rec.Result()
+}
+
+func findCookie(resp *http.Response, name string) *http.Cookie {
+	for _, c := range resp.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Sign in with the stand-in provider, which answers with the token built
+// by idToken, and return the callback's response
+func (f *oidcFixture) signIn(t *testing.T, idToken func(nonce string) string) *http.Response {
+	t.Helper()
+
+	resp := f.do(httptest.NewRequest(http.MethodGet, "/auth/oidc/test?next=/progress", nil))
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login: status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	target, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := target.Scheme+"://"+target.Host+target.Path, f.provider.server.URL+"/authorize"; got != want {
+		t.Fatalf("login redirected to %s, want %s", got, want)
+	}
+	query := target.Query()
+	if got := query.Get("redirect_uri"); got != "http://example.com/auth/oidc/test/callback" {
+		t.Errorf("redirect_uri = %q", got)
+	}
+	state := findCookie(resp, "munromark_oidc_state")
+	if state == nil || state.Value != query.Get("state") {
+		t.Fatalf("state cookie %v doesn't match state %q", state, query.Get("state"))
+	}
+
+	f.provider.nonce = query.Get("nonce")
+	f.provider.challenge = query.Get("code_challenge")
+	f.provider.idToken = idToken
+
+	callback := httptest.NewRequest(http.MethodGet, "/auth/oidc/test/callback?code=code-1&state="+url.QueryEscape(state.Value), nil)
+	callback.AddCookie(state)
+	return f.do(callback)
+}
+
+func TestOIDCSignInCreatesUser(t *testing.T) {
+	f := newOIDCFixture(t)
+	p := f.provider
+
+	resp := f.signIn(t, func(nonce string) string {
+		return signToken(t, "RS256", p.key, p.claims(nonce))
+	})
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/progress" {
+		t.Fatalf("callback: status %d to %q, want %d to /progress", resp.StatusCode, resp.Header.Get("Location"), http.StatusSeeOther)
+	}
+
+	session := findCookie(resp, auth.SessionCookie)
+	if session == nil {
+		t.Fatal("no session cookie")
+	}
+	user, err := f.store.GetSessionUser(auth.HashToken(session.Value))
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	if user.Email != "walker@example.com" || user.DisplayName != "Hill Walker" || !user.EmailVerified {
+		t.Errorf("user = %+v", user)
+	}
+	linked, err := f.store.GetIdentityUser("test", "subject-1")
+	if err != nil || linked.ID != user.ID {
+		t.Errorf("identity linked to %v (%v), want user %d", linked, err, user.ID)
+	}
+}
+
+func TestOIDCSignInRejectsBadTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		idToken func(p *fakeProvider, nonce string) string
+		status  int
+	}{
+		{
+			name: "bad signature",
+			idToken: func(p *fakeProvider, nonce string) string {
+				return signToken(t, "RS256", otherKey, p.claims(nonce))
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "alg none",
+			idToken: func(p *fakeProvider, nonce string) string {
+				return signToken(t, "none", nil, p.claims(nonce))
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "alg HS256 with the client secret",
+			idToken: func(p *fakeProvider, nonce string) string {
+				return signToken(t, "HS256", testClientSecret, p.claims(nonce))
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong audience",
+			idToken: func(p *fakeProvider, nonce string) string {
+				claims := p.claims(nonce)
+				claims["aud"] = "someone-else"
+				return signToken(t, "RS256", p.key, claims)
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong issuer",
+			idToken: func(p *fakeProvider, nonce string) string {
+				claims := p.claims(nonce)
+				claims["iss"] = "https://issuer.example.com"
+				return signToken(t, "RS256", p.key, claims)
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "expired",
+			idToken: func(p *fakeProvider, nonce string) string {
+				claims := p.claims(nonce)
+				claims["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				return signToken(t, "RS256", p.key, claims)
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "nonce mismatch",
+			idToken: func(p *fakeProvider, nonce string) string {
+				return signToken(t, "RS256", p.key, p.claims("another-sign-in"))
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "email not verified",
+			idToken: func(p *fakeProvider, nonce string) string {
+				claims := p.claims(nonce)
+				claims["email_verified"] = false
+				return signToken(t, "RS256", p.key, claims)
+			},
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+
+			resp := f.signIn(t, func(nonce string) string { return tt.idToken(f.provider, nonce) })
+			if resp.StatusCode != tt.status {
+				t.Fatalf("callback: status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if findCookie(resp, auth.SessionCookie) != nil {
+				t.Error("session cookie set")
+			}
+			if _, err := f.store.GetUserByEmail("walker@example.com"); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("user created (%v)", err)
+			}
+		})
+	}
+}
+
+func TestOIDCSignInLinksUnverifiedAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+	p := f.provider
+
+	// Someone registered the address with a password, without proving
+	// they own it, and is signed in
+	existing := &model.User{Email: "walker@example.com", DisplayName: "Squatter", PasswordHash: "hash"}
+	if err := f.store.CreateUser(existing); err != nil {
+		t.Fatal(err)
+	}
+	oldSession := auth.HashToken("old-session")
+	if err := f.store.CreateSession(oldSession, existing.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// and has set up ways to keep reading the account's data
+	const apiKey = "mm_squatters-key"
+	key := &model.APIKey{UserID: existing.ID, Name: "squatter", Prefix: "mm_squa", Scopes: []string{model.ScopeAscentsRead}, RatePerMinute: 60, Burst: 10}
+	if err := f.store.CreateAPIKey(key, auth.HashToken(apiKey)); err != nil {
+		t.Fatal(err)
+	}
+	hook := &model.Webhook{UserID: existing.ID, URL: "https://squatter.example/hook", Events: []string{"ascent.logged"}, Secret: "secret"}
+	if err := f.store.CreateWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.SetCalendarToken(existing.ID, auth.HashToken("squatters-feed")); err != nil {
+		t.Fatal(err)
+	}
+	withKey := func() *http.Response {
+		r := httptest.NewRequest(http.MethodGet, "/api/ascents", nil)
+		r.Header.Set("X-API-Key", apiKey)
+		return f.do(r)
+	}
+	if resp := withKey(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("API key before linking: status %d", resp.StatusCode)
+	}
+
+	resp := f.signIn(t, func(nonce string) string {
+		return signToken(t, "RS256", p.key, p.claims(nonce))
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("callback: status %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+
+	user, err := f.store.GetUserByEmail("walker@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("signed in as user %d, want the existing user %d", user.ID, existing.ID)
+	}
+	if user.PasswordHash != "" {
+		t.Error("password still set")
+	}
+	if !user.EmailVerified {
+		t.Error("email not marked verified")
+	}
+	if _, err := f.store.GetSessionUser(oldSession); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("old session still valid (%v)", err)
+	}
+	if resp := withKey(); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("API key after linking: status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	if hooks, err := f.store.ListWebhooks(existing.ID); err != nil || len(hooks) != 0 {
+		t.Errorf("webhooks after linking: %+v (%v), want none", hooks, err)
+	}
+	if _, err := f.store.GetCalendarTokenUser(auth.HashToken("squatters-feed")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("calendar token still valid (%v)", err)
+	}
+}
+
+func TestOIDCSignInKeepsVerifiedAccount(t *testing.T) {
+	f := newOIDCFixture(t)
+	p := f.provider
+
+	existing := &model.User{Email: "walker@example.com", DisplayName: "Walker", PasswordHash: "hash", EmailVerified: true}
+	if err := f.store.CreateUser(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := f.signIn(t, func(nonce string) string {
+		return signToken(t, "RS256", p.key, p.claims(nonce))
+	})
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("callback: status %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+
+	user, err := f.store.GetUserByEmail("walker@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID || user.PasswordHash != "hash" {
+		t.Errorf("user = %+v, want the existing user with their password", user)
+	}
+}
+
+func TestOIDCStateCookieSecure(t *testing.T) {
+	proxy := netip.MustParsePrefix("10.0.0.1/32")
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		secure  bool
+	}{
+		{
+			name: "plain HTTP",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/auth/oidc/test", nil)
+			},
+		},
+		{
+			name: "TLS",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/auth/oidc/test", nil)
+				r.TLS = &tls.ConnectionState{}
+				return r
+			},
+			secure: true,
+		},
+		{
+			name: "HTTPS to a trusted proxy",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/auth/oidc/test", nil)
+				r.RemoteAddr = "10.0.0.1:4000"
+				r.Header.Set("X-Forwarded-Proto", "https")
+				return r
+			},
+			secure: true,
+		},
+		{
+			name: "forwarded header from an untrusted client",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/auth/oidc/test", nil)
+				r.RemoteAddr = "192.0.2.1:4000"
+				r.Header.Set("X-Forwarded-Proto", "https")
+				return r
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture(t)
+			handler := middleware.Proxies([]netip.Prefix{proxy})(f.handler)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request())
+			resp := rec.Result()
+
+			state := findCookie(resp, "munromark_oidc_state")
+			if state == nil {
+				t.Fatalf("no state cookie (status %d)", resp.StatusCode)
+			}
+			if state.Secure != tt.secure {
+				t.Errorf("Secure = %v, want %v", state.Secure, tt.secure)
+			}
+			// The callback URL follows the same rule
+			redirect, _ := url.Parse(resp.Header.Get("Location"))
+			wantScheme := "http"
+			if tt.secure {
+				wantScheme = "https"
+			}
+			if got, _ := url.Parse(redirect.Query().Get("redirect_uri")); got == nil || got.Scheme != wantScheme {
+				t.Errorf("redirect_uri = %q, want %s", redirect.Query().Get("redirect_uri"), wantScheme)
+			}
+		})
+	}
+}
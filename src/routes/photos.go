@@ -0,0 +1,369 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/blob"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/photo"
+	"github.com/AlexM141200/munros-api/src/store"
+	"github.com/AlexM141200/munros-api/src/track"
+)
+
+const (
+	// Largest photo accepted for upload
+	maxPhotoUploadBytes = 20 << 20
+	maxPhotoCaption     = 500
+	// How far from a summit a photo can be taken and still be suggested
+	photoSuggestRadius = 1000.0
+)
+
+type photoRequest struct {
+	MunroID int    `json:"munro_id"`
+	Caption string `json:"caption"`
+}
+
+type photoUploadResponse struct {
+	Photo *model.Photo `json:"photo"`
+	// Hills near where the photo was taken, closest first
+	Suggestions []track.Summit `json:"suggestions"`
+}
+
+func originalKey(photo *model.Photo) string  { return "originals/" + photo.BlobKey }
+func thumbnailKey(photo *model.Photo) string { return "thumbnails/" + photo.BlobKey }
+
+// Fill in the URLs a photo is served from
+func photoURLs(photo *model.Photo) {
+	photo.URL = fmt.Sprintf("/api/photos/%d/original", photo.ID)
+	photo.ThumbnailURL = fmt.Sprintf("/api/photos/%d/thumbnail", photo.ID)
+}
+
+func photosURLs(photos []model.Photo) {
+	for i := range photos {
+		photoURLs(&photos[i])
+	}
+}
+
+// Load the photo named by the {id} path value, writing an error on failure.
+// Unapproved photos are only visible to their owner and admins.
+func (h *Handlers) photoFromPath(w http.ResponseWriter, r *http.Request) (*model.Photo, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid photo ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	photo, err := h.store.GetPhoto(id)
+	if err == nil && !canView(h.optionalUser(r), photo.UserID, photo.Moderation) {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		h.writePhotoError(w, r, err)
+		return nil, false
+	}
+	return photo, true
+}
+
+// Write the error from a photo lookup
+func (h *Handlers) writePhotoError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, r, "Photo not found", http.StatusNotFound)
+		return
+	}
+	h.log(r).Error("Error reading photo", "err", err)
+	writeError(w, r, "Failed to read photo", http.StatusInternalServerError)
+}
+
+// Upload a photo as multipart field "photo", with optional "munro_id" and
+// "caption" fields. Without a munro_id the photo is attached to the closest
+// hill to where it was taken.
+func (h *Handlers) HandleUploadPhoto(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoUploadBytes)
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		writeError(w, r, "Missing photo file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, r, "Failed to read photo", http.StatusBadRequest)
+		return
+	}
+
+	processed, err := photo.Process(data)
+	if err != nil {
+		if errors.Is(err, photo.ErrUnsupported) {
+			writeError(w, r, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	suggestions := []track.Summit{}
+	if processed.Meta.HasLocation {
+		suggestions = h.summitIndex(munros).Near(processed.Meta.Latitude, processed.Meta.Longitude, photoSuggestRadius)
+	}
+
+	p := &model.Photo{
+		UserID:      user.ID,
+		AuthorName:  user.DisplayName,
+		Caption:     strings.TrimSpace(r.FormValue("caption")),
+		ContentType: processed.ContentType,
+		Width:       processed.Width,
+		Height:      processed.Height,
+	}
+	if len(p.Caption) > maxPhotoCaption {
+		writeError(w, r, "Caption is too long", http.StatusBadRequest)
+		return
+	}
+	if processed.Meta.HasLocation {
+		p.Latitude, p.Longitude = &processed.Meta.Latitude, &processed.Meta.Longitude
+	}
+	if !processed.Meta.TakenAt.IsZero() {
+		p.TakenAt = &processed.Meta.TakenAt
+	}
+
+	if value := r.FormValue("munro_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || !knownMunro(munros, id) {
+			writeError(w, r, "Unknown munro_id "+value, http.StatusBadRequest)
+			return
+		}
+		p.MunroID = id
+	} else if len(suggestions) > 0 {
+		p.MunroID = suggestions[0].Munro.DoBIHNumber
+	} else {
+		writeError(w, r, "munro_id is required: the photo has no location near a hill", http.StatusBadRequest)
+		return
+	}
+
+	if p.Moderation, ok = h.moderationForPost(w, r, user); !ok {
+		return
+	}
+
+	if p.BlobKey, err = auth.NewToken(); err != nil {
+		h.log(r).Error("Error generating photo key", "err", err)
+		writeError(w, r, "Failed to store photo", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.photos.Put(originalKey(p), bytes.NewReader(processed.Original)); err != nil {
+		h.log(r).Error("Error storing photo", "err", err)
+		writeError(w, r, "Failed to store photo", http.StatusInternalServerError)
+		return
+	}
+	if err := h.photos.Put(thumbnailKey(p), bytes.NewReader(processed.Thumbnail)); err != nil {
+		h.log(r).Error("Error storing thumbnail", "err", err)
+		h.deletePhotoBlobs(r, p)
+		writeError(w, r, "Failed to store photo", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.CreatePhoto(p); err != nil {
+		h.log(r).Error("Error creating photo", "err", err)
+		h.deletePhotoBlobs(r, p)
+		writeError(w, r, "Failed to store photo", http.StatusInternalServerError)
+		return
+	}
+
+	photoURLs(p)
+	h.writeJSONResponse(w, r, photoUploadResponse{Photo: p, Suggestions: suggestions}, http.StatusCreated)
+}
+
+func knownMunro(munros []model.Munro, id int) bool {
+	for _, munro := range munros {
+		if munro.DoBIHNumber == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handlers) deletePhotoBlobs(r *http.Request, p *model.Photo) {
+	for _, key := range []string{originalKey(p), thumbnailKey(p)} {
+		if err := h.photos.Delete(key); err != nil {
+			h.log(r).Error("Error deleting photo file", "key", key, "err", err)
+		}
+	}
+}
+
+// List the logged-in user's photos
+func (h *Handlers) HandleGetMyPhotos(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	photos, err := h.store.ListUserPhotos(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing photos", "err", err)
+		writeError(w, r, "Failed to read photos", http.StatusInternalServerError)
+		return
+	}
+
+	photosURLs(photos)
+	h.writeJSONResponse(w, r, photos, http.StatusOK)
+}
+
+// List the photos of a hill
+func (h *Handlers) HandleGetHillPhotos(w http.ResponseWriter, r *http.Request) {
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	photos, err := h.store.ListHillPhotos(munro.DoBIHNumber)
+	if err != nil {
+		h.log(r).Error("Error listing photos", "err", err)
+		writeError(w, r, "Failed to read photos", http.StatusInternalServerError)
+		return
+	}
+
+	photosURLs(photos)
+	h.writeJSONResponse(w, r, photos, http.StatusOK)
+}
+
+func (h *Handlers) HandleGetPhoto(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.photoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	photoURLs(p)
+	h.writeJSONResponse(w, r, p, http.StatusOK)
+}
+
+// Move one of the logged-in user's photos to another hill or recaption it
+func (h *Handlers) HandleUpdatePhoto(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := h.photoFromPath(w, r)
+	if !ok {
+		return
+	}
+	if p.UserID != user.ID {
+		h.writePhotoError(w, r, store.ErrNotFound)
+		return
+	}
+
+	var req photoRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := catalogue[req.MunroID]; !ok {
+		writeError(w, r, "Unknown munro_id "+strconv.Itoa(req.MunroID), http.StatusBadRequest)
+		return
+	}
+
+	p.MunroID = req.MunroID
+	p.Caption = strings.TrimSpace(req.Caption)
+	p.Moderation = moderationForEdit(user, p.Moderation)
+	if len(p.Caption) > maxPhotoCaption {
+		writeError(w, r, "Caption is too long", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.UpdatePhoto(p); err != nil {
+		h.writePhotoError(w, r, err)
+		return
+	}
+
+	photoURLs(p)
+	h.writeJSONResponse(w, r, p, http.StatusOK)
+}
+
+func (h *Handlers) HandleDeletePhoto(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := h.photoFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeletePhoto(user.ID, p.ID); err != nil {
+		h.writePhotoError(w, r, err)
+		return
+	}
+	h.deletePhotoBlobs(r, p)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Serve a photo's stripped original
+func (h *Handlers) HandlePhotoOriginal(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.photoFromPath(w, r)
+	if !ok {
+		return
+	}
+	h.servePhotoBlob(w, r, p, originalKey(p), p.ContentType)
+}
+
+// Serve a photo's JPEG thumbnail
+func (h *Handlers) HandlePhotoThumbnail(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.photoFromPath(w, r)
+	if !ok {
+		return
+	}
+	h.servePhotoBlob(w, r, p, thumbnailKey(p), "image/jpeg")
+}
+
+func (h *Handlers) servePhotoBlob(w http.ResponseWriter, r *http.Request, p *model.Photo, key, contentType string) {
+	f, err := h.photos.Open(key)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			writeError(w, r, "Photo not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error opening photo file", "key", key, "err", err)
+		writeError(w, r, "Failed to read photo", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// Files never change once uploaded, but only approved photos may be
+	// kept by shared caches: the rest are for the author and moderators
+	w.Header().Set("Content-Type", contentType)
+	if p.Moderation == model.ModerationApproved {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		h.log(r).Error("Error writing photo file", "key", key, "err", err)
+	}
+}
@@ -0,0 +1,85 @@
+package routes_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/blob"
+	"github.com/AlexM141200/munros-api/src/handlers"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/routes"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+func TestPhotoCacheControl(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "munro.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	photos, err := blob.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := handlers.NewRouter(routes.New(routes.Deps{Munros: testMunros, Store: s, Photos: photos}))
+
+	author := &model.User{Email: "walker@example.com", DisplayName: "Walker"}
+	if err := s.CreateUser(author); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(auth.HashToken("walker"), author.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		moderation string
+		anonymous  int
+		want       string
+	}{
+		{model.ModerationApproved, http.StatusOK, "public, max-age=86400"},
+		{model.ModerationPending, http.StatusNotFound, "private, no-store"},
+		{model.ModerationRejected, http.StatusNotFound, "private, no-store"},
+		{model.ModerationHidden, http.StatusNotFound, "private, no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.moderation, func(t *testing.T) {
+			p := &model.Photo{UserID: author.ID, MunroID: 1, Moderation: tt.moderation, BlobKey: tt.moderation + ".jpg", ContentType: "image/jpeg"}
+			if err := s.CreatePhoto(p); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"originals/", "thumbnails/"} {
+				if err := photos.Put(key+p.BlobKey, strings.NewReader("jpeg")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, file := range []string{"original", "thumbnail"} {
+				target := fmt.Sprintf("/api/photos/%d/%s", p.ID, file)
+
+				r := httptest.NewRequest(http.MethodGet, target, nil)
+				r.Header.Set("Authorization", "Bearer walker")
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, r)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("%s as the author: status %d", file, rec.Code)
+				}
+				if got := rec.Header().Get("Cache-Control"); got != tt.want {
+					t.Errorf("%s: Cache-Control = %q, want %q", file, got, tt.want)
+				}
+
+				rec = httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+				if rec.Code != tt.anonymous {
+					t.Errorf("%s signed out: status %d, want %d", file, rec.Code, tt.anonymous)
+				}
+			}
+		})
+	}
+}
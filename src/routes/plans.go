@@ -0,0 +1,420 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+	"github.com/AlexM141200/munros-api/src/track"
+)
+
+// Most hills allowed in a single plan
+const maxPlanHills = 100
+
+type planRequest struct {
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Notes     string `json:"notes"`
+	Hills     []struct {
+		MunroID int    `json:"munro_id"`
+		Notes   string `json:"notes"`
+	} `json:"hills"`
+}
+
+type planShareResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// Validate a plan request and convert it to a plan, writing a 400 on failure
+func planFromRequest(w http.ResponseWriter, r *http.Request, req planRequest, catalogue map[int]model.Munro) (*model.Plan, bool) {
+	plan := &model.Plan{
+		Name:      strings.TrimSpace(req.Name),
+		StartDate: strings.TrimSpace(req.StartDate),
+		EndDate:   strings.TrimSpace(req.EndDate),
+		Notes:     strings.TrimSpace(req.Notes),
+		Hills:     []model.PlanHill{},
+	}
+
+	if plan.Name == "" {
+		writeError(w, r, "Plan name is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	for _, date := range []string{plan.StartDate, plan.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			writeError(w, r, "Dates must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	if plan.EndDate != "" && plan.StartDate == "" {
+		plan.StartDate = plan.EndDate
+	}
+	if plan.EndDate != "" && plan.EndDate < plan.StartDate {
+		writeError(w, r, "end_date is before start_date", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if len(req.Hills) > maxPlanHills {
+		writeError(w, r, fmt.Sprintf("A plan can contain at most %d hills", maxPlanHills), http.StatusBadRequest)
+		return nil, false
+	}
+	for _, hill := range req.Hills {
+		if _, ok := catalogue[hill.MunroID]; !ok {
+			writeError(w, r, "Unknown munro_id "+strconv.Itoa(hill.MunroID), http.StatusBadRequest)
+			return nil, false
+		}
+		plan.Hills = append(plan.Hills, model.PlanHill{MunroID: hill.MunroID, Notes: strings.TrimSpace(hill.Notes)})
+	}
+
+	return plan, true
+}
+
+// Fill in catalogue details for each hill in the plan
+func attachPlanMunros(plan *model.Plan, catalogue map[int]model.Munro) {
+	for i := range plan.Hills {
+		if munro, ok := catalogue[plan.Hills[i].MunroID]; ok {
+			plan.Hills[i].Munro = &munro
+		}
+	}
+}
+
+// Parse the {id} path value, writing a 400 on failure
+func planIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid plan ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// Write the error from a plan lookup
+func (h *Handlers) writePlanError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, r, "Plan not found", http.StatusNotFound)
+		return
+	}
+	h.log(r).Error("Error reading plan", "err", err)
+	writeError(w, r, "Failed to read plan", http.StatusInternalServerError)
+}
+
+// List the logged-in user's plans
+func (h *Handlers) HandleGetPlans(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	plans, err := h.store.ListPlans(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing plans", "err", err)
+		writeError(w, r, "Failed to read plans", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range plans {
+		attachPlanMunros(&plans[i], catalogue)
+	}
+	h.writeJSONResponse(w, r, plans, http.StatusOK)
+}
+
+// Create a plan
+func (h *Handlers) HandleCreatePlan(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req planRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	plan, ok := planFromRequest(w, r, req, catalogue)
+	if !ok {
+		return
+	}
+	plan.UserID = user.ID
+
+	if err := h.store.CreatePlan(plan); err != nil {
+		h.log(r).Error("Error creating plan", "err", err)
+		writeError(w, r, "Failed to create plan", http.StatusInternalServerError)
+		return
+	}
+
+	attachPlanMunros(plan, catalogue)
+	h.writeJSONResponse(w, r, plan, http.StatusCreated)
+}
+
+// Get one of the logged-in user's plans
+func (h *Handlers) HandleGetPlan(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := planIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	plan, err := h.store.GetPlan(user.ID, id)
+	if err != nil {
+		h.writePlanError(w, r, err)
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	attachPlanMunros(plan, catalogue)
+	h.writeJSONResponse(w, r, plan, http.StatusOK)
+}
+
+// Replace a plan's details and hills
+func (h *Handlers) HandleUpdatePlan(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := planIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req planRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	plan, ok := planFromRequest(w, r, req, catalogue)
+	if !ok {
+		return
+	}
+	plan.ID = id
+	plan.UserID = user.ID
+
+	if err := h.store.UpdatePlan(plan); err != nil {
+		h.writePlanError(w, r, err)
+		return
+	}
+
+	updated, err := h.store.GetPlan(user.ID, id)
+	if err != nil {
+		h.writePlanError(w, r, err)
+		return
+	}
+
+	attachPlanMunros(updated, catalogue)
+	h.writeJSONResponse(w, r, updated, http.StatusOK)
+}
+
+// Delete a plan
+func (h *Handlers) HandleDeletePlan(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := planIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeletePlan(user.ID, id); err != nil {
+		h.writePlanError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create (or replace) a read-only share link for a plan
+func (h *Handlers) HandleSharePlan(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := planIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		h.log(r).Error("Error generating share token", "err", err)
+		writeError(w, r, "Failed to share plan", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store.SetPlanShareToken(user.ID, id, auth.HashToken(token)); err != nil {
+		h.writePlanError(w, r, err)
+		return
+	}
+
+	h.writeJSONResponse(w, r, planShareResponse{Token: token, URL: "/api/shared/plans/" + token}, http.StatusOK)
+}
+
+// Revoke a plan's share link
+func (h *Handlers) HandleUnsharePlan(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := planIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.SetPlanShareToken(user.ID, id, ""); err != nil {
+		h.writePlanError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Look up the plan behind a share link. The owner is stripped so the
+// response can't be used to discover anything beyond the plan itself.
+func (h *Handlers) sharedPlan(w http.ResponseWriter, r *http.Request) (*model.Plan, bool) {
+	plan, err := h.store.GetSharedPlan(auth.HashToken(r.PathValue("token")))
+	if err != nil {
+		h.writePlanError(w, r, err)
+		return nil, false
+	}
+
+	plan.UserID = 0
+	return plan, true
+}
+
+// Get a plan via its share link
+func (h *Handlers) HandleGetSharedPlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := h.sharedPlan(w, r)
+	if !ok {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	attachPlanMunros(plan, catalogue)
+	h.writeJSONResponse(w, r, plan, http.StatusOK)
+}
+
+// Export one of the logged-in user's plans as GPX
+func (h *Handlers) HandlePlanGPX(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := planIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	plan, err := h.store.GetPlan(user.ID, id)
+	if err != nil {
+		h.writePlanError(w, r, err)
+		return
+	}
+
+	h.writePlanGPX(w, r, plan)
+}
+
+// Export a shared plan as GPX
+func (h *Handlers) HandleSharedPlanGPX(w http.ResponseWriter, r *http.Request) {
+	plan, ok := h.sharedPlan(w, r)
+	if !ok {
+		return
+	}
+
+	h.writePlanGPX(w, r, plan)
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+func (h *Handlers) writePlanGPX(w http.ResponseWriter, r *http.Request, plan *model.Plan) {
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gpx+xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+planFilename(plan)+`.gpx"`)
+	if err := track.WriteGPX(w, plan.Name, planWaypoints(plan, catalogue)); err != nil {
+		h.log(r).Error("Error writing GPX", "err", err)
+	}
+}
+
+// A plan's hills as GPX waypoints, in order
+func planWaypoints(plan *model.Plan, catalogue map[int]model.Munro) []track.Waypoint {
+	waypoints := make([]track.Waypoint, 0, len(plan.Hills))
+	for _, hill := range plan.Hills {
+		munro, ok := catalogue[hill.MunroID]
+		if !ok {
+			continue
+		}
+		desc := fmt.Sprintf("%s, %.0fm, %s", munro.Classification, munro.HeightM, munro.GridRef)
+		if hill.Notes != "" {
+			desc += " - " + hill.Notes
+		}
+		waypoints = append(waypoints, track.Waypoint{
+			Name: munro.Name,
+			Desc: desc,
+			Lat:  munro.Latitude,
+			Lon:  munro.Longitude,
+			Ele:  munro.HeightM,
+		})
+	}
+	return waypoints
+}
+
+// A plan's name made safe for use as a file name
+func planFilename(plan *model.Plan) string {
+	filename := strings.Trim(unsafeFilenameChars.ReplaceAllString(strings.ToLower(plan.Name), "-"), "-")
+	if filename == "" {
+		filename = "plan"
+	}
+	return filename
+}
@@ -0,0 +1,318 @@
+package routes
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/blob"
+	"github.com/AlexM141200/munros-api/src/middleware"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/track"
+)
+
+// Everything held about a user, gathered before the archive is written so
+// that a failed read can still be reported as an error
+type accountData struct {
+	User       *model.User
+	Identities []model.Identity
+	Ascents    []model.Ascent
+	Plans      []model.Plan
+	Awards     []model.Award
+	Groups     []model.Group
+	Reports    []model.Report
+	Photos     []exportedPhoto
+	Ratings    []model.Rating
+	Conditions []model.ConditionReport
+	Flags      []model.Flag
+	Webhooks   []model.Webhook
+	APIKeys    []model.APIKey
+	Following  []model.Follow
+	Followers  []model.Follow
+}
+
+// A photo as exported, including the location that the API keeps private
+type exportedPhoto struct {
+	model.Photo
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	File      string   `json:"file"`
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+	// Accounts that only sign in through a provider confirm with their
+	// email address instead
+	ConfirmEmail string `json:"confirm_email"`
+}
+
+func (h *Handlers) loadAccountData(user *model.User) (*accountData, error) {
+	data := &accountData{User: user}
+	var err error
+
+	if data.Identities, err = h.store.ListIdentities(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Ascents, err = h.store.ListAscents(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Plans, err = h.store.ListPlans(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Awards, err = h.store.ListAwards(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Groups, err = h.store.ListUserGroups(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Reports, err = h.store.ListUserReports(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Ratings, err = h.store.ListUserRatings(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Conditions, err = h.store.ListUserConditions(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Flags, err = h.store.ListUserFlags(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Webhooks, err = h.store.ListWebhooks(user.ID); err != nil {
+		return nil, err
+	}
+	if data.APIKeys, err = h.store.ListAPIKeys(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Following, err = h.store.ListFollowing(user.ID); err != nil {
+		return nil, err
+	}
+	if data.Followers, err = h.store.ListFollowers(user.ID); err != nil {
+		return nil, err
+	}
+	for i := range data.Webhooks {
+		data.Webhooks[i].Secret = ""
+	}
+
+	photos, err := h.store.ListUserPhotos(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	photosURLs(photos)
+	for _, p := range photos {
+		data.Photos = append(data.Photos, exportedPhoto{
+			Photo:     p,
+			Latitude:  p.Latitude,
+			Longitude: p.Longitude,
+			File:      photoExportName(&p),
+		})
+	}
+
+	return data, nil
+}
+
+// Where a photo's original goes in the archive
+func photoExportName(p *model.Photo) string {
+	ext := ".jpg"
+	if p.ContentType == "image/png" {
+		ext = ".png"
+	}
+	return fmt.Sprintf("photos/%d%s", p.ID, ext)
+}
+
+// The user's ascents as GPX waypoints, in the order they were climbed
+func ascentWaypoints(ascents []model.Ascent, catalogue map[int]model.Munro) []track.Waypoint {
+	waypoints := make([]track.Waypoint, 0, len(ascents))
+	for _, ascent := range ascents {
+		munro, ok := catalogue[ascent.MunroID]
+		if !ok {
+			continue
+		}
+		desc := "Climbed " + ascent.ClimbedAt.Format("2 Jan 2006")
+		if ascent.Notes != "" {
+			desc += " - " + ascent.Notes
+		}
+		waypoints = append(waypoints, track.Waypoint{
+			Name: munro.Name,
+			Desc: desc,
+			Lat:  munro.Latitude,
+			Lon:  munro.Longitude,
+			Ele:  munro.HeightM,
+		})
+	}
+	return waypoints
+}
+
+// exportArchive writes files into the zip sent to the user
+type exportArchive struct {
+	zw       *zip.Writer
+	modified time.Time
+	photos   blob.Store
+	logger   *slog.Logger
+}
+
+func (a *exportArchive) create(name string) (io.Writer, error) {
+	return a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.modified})
+}
+
+func (a *exportArchive) writeJSON(name string, v any) error {
+	f, err := a.create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (a *exportArchive) writeGPX(name, title string, waypoints []track.Waypoint) error {
+	f, err := a.create(name)
+	if err != nil {
+		return err
+	}
+	return track.WriteGPX(f, title, waypoints)
+}
+
+func (a *exportArchive) writeBlob(name, key string) error {
+	r, err := a.photos.Open(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := a.create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (a *exportArchive) write(data *accountData, catalogue map[int]model.Munro) error {
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"account.json", data.User},
+		{"linked_accounts.json", data.Identities},
+		{"ascents.json", data.Ascents},
+		{"plans.json", data.Plans},
+		{"achievements.json", data.Awards},
+		{"groups.json", data.Groups},
+		{"reports.json", data.Reports},
+		{"photos.json", data.Photos},
+		{"ratings.json", data.Ratings},
+		{"conditions.json", data.Conditions},
+		{"flags.json", data.Flags},
+		{"webhooks.json", data.Webhooks},
+		{"api_keys.json", data.APIKeys},
+		{"following.json", data.Following},
+		{"followers.json", data.Followers},
+	}
+	for _, file := range files {
+		if err := a.writeJSON(file.name, file.v); err != nil {
+			return err
+		}
+	}
+
+	if err := a.writeGPX("ascents.gpx", data.User.DisplayName+"'s ascents", ascentWaypoints(data.Ascents, catalogue)); err != nil {
+		return err
+	}
+	for i := range data.Plans {
+		plan := &data.Plans[i]
+		name := fmt.Sprintf("plans/%d-%s.gpx", plan.ID, planFilename(plan))
+		if err := a.writeGPX(name, plan.Name, planWaypoints(plan, catalogue)); err != nil {
+			return err
+		}
+	}
+
+	for i := range data.Photos {
+		p := &data.Photos[i]
+		if err := a.writeBlob(p.File, originalKey(&p.Photo)); err != nil {
+			// One missing file shouldn't stop the rest of the export
+			a.logger.Error("Error exporting photo", "photo_id", p.ID, "err", err)
+		}
+	}
+
+	return a.zw.Close()
+}
+
+// Download everything held about the logged-in user as a zip of JSON, GPX
+// and their original photos
+func (h *Handlers) HandleExportAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := h.loadAccountData(user)
+	if err != nil {
+		h.log(r).Error("Error reading account data", "err", err)
+		writeError(w, r, "Failed to export account", http.StatusInternalServerError)
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	// Photos can make the archive take longer than the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		h.log(r).Error("Error lifting write deadline", "err", err)
+	}
+
+	now := time.Now().UTC()
+	filename := fmt.Sprintf("munromark-export-%s.zip", now.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	archive := &exportArchive{zw: zip.NewWriter(w), modified: now, photos: h.photos, logger: h.log(r)}
+	if err := archive.write(data, catalogue); err != nil {
+		// Too late for an error status; the client sees a truncated zip
+		h.log(r).Error("Error writing account export", "err", err)
+	}
+}
+
+// Permanently delete the logged-in user's account. The password is asked
+// for again so a stolen session can't easily be used to do this.
+func (h *Handlers) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req deleteAccountRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+	switch {
+	case user.PasswordHash != "" && !auth.CheckPassword(user.PasswordHash, req.Password):
+		writeError(w, r, "Incorrect password", http.StatusForbidden)
+		return
+	case user.PasswordHash == "" && !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), user.Email):
+		writeError(w, r, "confirm_email must match your email address", http.StatusForbidden)
+		return
+	}
+
+	photos, err := h.store.DeleteUser(user.ID)
+	if err != nil {
+		h.log(r).Error("Error deleting user", "user_id", user.ID, "err", err)
+		writeError(w, r, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	for i := range photos {
+		h.deletePhotoBlobs(r, &photos[i])
+	}
+
+	h.log(r).Info("Deleted user", "user_id", user.ID)
+	auth.ClearSessionCookie(w, middleware.IsHTTPS(r))
+	w.WriteHeader(http.StatusNoContent)
+}
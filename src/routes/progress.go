@@ -0,0 +1,182 @@
+package routes
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/progress"
+	"github.com/AlexM141200/munros-api/src/render"
+)
+
+// A4 landscape in PDF points
+const (
+	a4LongPt  = 841.89
+	a4ShortPt = 595.28
+)
+
+type certificateResponse struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	CompletedAt time.Time `json:"completed_at"`
+	FinalMunro  string    `json:"final_munro"`
+	PNGURL      string    `json:"png_url"`
+	PDFURL      string    `json:"pdf_url"`
+}
+
+// Load the catalogue and the logged-in user's progress through it
+func (h *Handlers) userProgress(w http.ResponseWriter, r *http.Request) (*model.User, []model.Munro, progress.Progress, bool) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return nil, nil, progress.Progress{}, false
+	}
+
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return nil, nil, progress.Progress{}, false
+	}
+
+	ascents, err := h.store.ListAscents(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing ascents", "err", err)
+		writeError(w, r, "Failed to read ascents", http.StatusInternalServerError)
+		return nil, nil, progress.Progress{}, false
+	}
+
+	return user, munros, progress.Compute(munros, ascents), true
+}
+
+// Compute a user's progress outside a request
+func (h *Handlers) progressFor(userID int64) (progress.Progress, error) {
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		return progress.Progress{}, err
+	}
+
+	ascents, err := h.store.ListAscents(userID)
+	if err != nil {
+		return progress.Progress{}, err
+	}
+
+	return progress.Compute(munros, ascents), nil
+}
+
+// Certificates the user has earned: one for all the Munros and one per
+// completed SMC section
+func earnedCertificates(p progress.Progress, munros []model.Munro) []certificateResponse {
+	names := make(map[int]string, len(munros))
+	for _, munro := range munros {
+		names[munro.DoBIHNumber] = munro.Name
+	}
+
+	certificate := func(id, title string, c *progress.Completion) certificateResponse {
+		return certificateResponse{
+			ID:          id,
+			Title:       title,
+			CompletedAt: c.At,
+			FinalMunro:  names[c.FinalMunroID],
+			PNGURL:      "/api/certificates/" + id + ".png",
+			PDFURL:      "/api/certificates/" + id + ".pdf",
+		}
+	}
+
+	certificates := []certificateResponse{}
+	if p.Complete {
+		certificates = append(certificates, certificate("munros", fmt.Sprintf("all %d Munros", p.Total), p.Final))
+	}
+	for _, section := range p.Sections {
+		if section.Complete {
+			certificates = append(certificates, certificate("section-"+section.Section,
+				fmt.Sprintf("all %d Munros in SMC Section %s", section.Total, section.Section), section.Final))
+		}
+	}
+
+	return certificates
+}
+
+// Get the logged-in user's progress through the Munros
+func (h *Handlers) HandleGetProgress(w http.ResponseWriter, r *http.Request) {
+	_, _, p, ok := h.userProgress(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, p, http.StatusOK)
+}
+
+// Render the logged-in user's progress poster
+func (h *Handlers) HandleProgressPoster(w http.ResponseWriter, r *http.Request) {
+	user, munros, p, ok := h.userProgress(w, r)
+	if !ok {
+		return
+	}
+
+	h.writePNG(w, r, render.Poster(user.DisplayName, munros, p))
+}
+
+// List the certificates the logged-in user has earned
+func (h *Handlers) HandleGetCertificates(w http.ResponseWriter, r *http.Request) {
+	_, munros, p, ok := h.userProgress(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeJSONResponse(w, r, earnedCertificates(p, munros), http.StatusOK)
+}
+
+// Download a certificate as PNG or PDF, e.g. /api/certificates/section-4.pdf
+func (h *Handlers) HandleCertificate(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	ext := path.Ext(file)
+	id := strings.TrimSuffix(file, ext)
+	if ext != ".png" && ext != ".pdf" {
+		writeError(w, r, "Certificate not found", http.StatusNotFound)
+		return
+	}
+
+	user, munros, p, ok := h.userProgress(w, r)
+	if !ok {
+		return
+	}
+
+	for _, c := range earnedCertificates(p, munros) {
+		if c.ID != id {
+			continue
+		}
+
+		img := render.Certificate(render.CertificateDetails{
+			Name:        user.DisplayName,
+			Achievement: c.Title,
+			FinalHill:   c.FinalMunro,
+			CompletedAt: c.CompletedAt,
+		})
+
+		if ext == ".png" {
+			h.writePNG(w, r, img)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="munromark-`+id+`.pdf"`)
+		if err := render.WritePDF(w, img, a4LongPt, a4ShortPt); err != nil {
+			h.log(r).Error("Error writing PDF", "err", err)
+		}
+		return
+	}
+
+	writeError(w, r, "Certificate not earned", http.StatusNotFound)
+}
+
+func (h *Handlers) writePNG(w http.ResponseWriter, r *http.Request, img image.Image) {
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, img); err != nil {
+		h.log(r).Error("Error encoding PNG", "err", err)
+	}
+}
@@ -0,0 +1,411 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/markdown"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+	templates "github.com/AlexM141200/munros-api/src/views"
+)
+
+const (
+	maxReportTitle  = 200
+	maxReportBody   = 100000
+	maxReportHills  = 50
+	defaultReports  = 20
+	maxReportsLimit = 100
+)
+
+type reportRequest struct {
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	Status    string `json:"status"`
+	ClimbedOn string `json:"climbed_on"`
+	MunroIDs  []int  `json:"munro_ids"`
+}
+
+// Validate a report request and convert it to a report, writing a 400 on
+// failure. Reports are drafts unless published explicitly.
+func reportFromRequest(w http.ResponseWriter, r *http.Request, req reportRequest, catalogue map[int]model.Munro) (*model.Report, bool) {
+	report := &model.Report{
+		Title:     strings.TrimSpace(req.Title),
+		Body:      strings.TrimSpace(req.Body),
+		Status:    strings.ToLower(strings.TrimSpace(req.Status)),
+		ClimbedOn: strings.TrimSpace(req.ClimbedOn),
+		MunroIDs:  []int{},
+	}
+
+	if report.Title == "" {
+		writeError(w, r, "Report title is required", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(report.Title) > maxReportTitle || len(report.Body) > maxReportBody {
+		writeError(w, r, "Report is too long", http.StatusBadRequest)
+		return nil, false
+	}
+
+	switch report.Status {
+	case "":
+		report.Status = model.ReportStatusDraft
+	case model.ReportStatusDraft, model.ReportStatusPublished:
+	default:
+		writeError(w, r, "status must be draft or published", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if report.ClimbedOn != "" {
+		if _, err := time.Parse(time.DateOnly, report.ClimbedOn); err != nil {
+			writeError(w, r, "climbed_on must be in YYYY-MM-DD format", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	if len(req.MunroIDs) == 0 {
+		writeError(w, r, "A report must be about at least one hill", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.MunroIDs) > maxReportHills {
+		writeError(w, r, fmt.Sprintf("A report can cover at most %d hills", maxReportHills), http.StatusBadRequest)
+		return nil, false
+	}
+	for _, id := range req.MunroIDs {
+		if _, ok := catalogue[id]; !ok {
+			writeError(w, r, "Unknown munro_id "+strconv.Itoa(id), http.StatusBadRequest)
+			return nil, false
+		}
+		report.MunroIDs = append(report.MunroIDs, id)
+	}
+
+	return report, true
+}
+
+// Fill in a report's rendered HTML
+func (h *Handlers) renderReport(r *http.Request, report *model.Report) {
+	html, err := markdown.Render(report.Body)
+	if err != nil {
+		h.log(r).Error("Error rendering report", "report_id", report.ID, "err", err)
+		return
+	}
+	report.HTML = html
+}
+
+func (h *Handlers) renderReports(r *http.Request, reports []model.Report) {
+	for i := range reports {
+		h.renderReport(r, &reports[i])
+	}
+}
+
+// Load the report named by the {id} path value, writing an error on failure.
+// Drafts are only visible to their author, and unapproved reports to their
+// author and admins.
+func (h *Handlers) reportFromPath(w http.ResponseWriter, r *http.Request) (*model.Report, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid report ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	report, err := h.store.GetReport(id)
+	if err == nil {
+		user := h.optionalUser(r)
+		author := user != nil && user.ID == report.UserID
+		if (report.Status != model.ReportStatusPublished && !author) || !canView(user, report.UserID, report.Moderation) {
+			err = store.ErrNotFound
+		}
+	}
+	if err != nil {
+		h.writeReportError(w, r, err)
+		return nil, false
+	}
+
+	return report, true
+}
+
+// Write the error from a report lookup
+func (h *Handlers) writeReportError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, r, "Report not found", http.StatusNotFound)
+		return
+	}
+	h.log(r).Error("Error reading report", "err", err)
+	writeError(w, r, "Failed to read report", http.StatusInternalServerError)
+}
+
+// Find a hill by running number or DoBIH number, as HandleMunroByID does
+func (h *Handlers) findMunro(id string) (*model.Munro, error) {
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := strconv.Atoi(id)
+	for _, munro := range munros {
+		if munro.RunningNo == n || munro.DoBIHNumber == n {
+			return &munro, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+// Load the hill named by the {id} path value, writing an error on failure
+func (h *Handlers) munroFromPath(w http.ResponseWriter, r *http.Request) (*model.Munro, bool) {
+	munro, err := h.findMunro(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Munro not found", http.StatusNotFound)
+			return nil, false
+		}
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return nil, false
+	}
+	return munro, true
+}
+
+// List recently published reports
+func (h *Handlers) HandleGetReports(w http.ResponseWriter, r *http.Request) {
+	limit := defaultReports
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, r, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxReportsLimit)
+	}
+
+	reports, err := h.store.ListPublishedReports(limit)
+	if err != nil {
+		h.log(r).Error("Error listing reports", "err", err)
+		writeError(w, r, "Failed to read reports", http.StatusInternalServerError)
+		return
+	}
+
+	h.renderReports(r, reports)
+	h.writeJSONResponse(w, r, reports, http.StatusOK)
+}
+
+// List the published reports about a hill
+func (h *Handlers) HandleGetHillReports(w http.ResponseWriter, r *http.Request) {
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	reports, err := h.store.ListHillReports(munro.DoBIHNumber)
+	if err != nil {
+		h.log(r).Error("Error listing reports", "err", err)
+		writeError(w, r, "Failed to read reports", http.StatusInternalServerError)
+		return
+	}
+
+	h.renderReports(r, reports)
+	h.writeJSONResponse(w, r, reports, http.StatusOK)
+}
+
+// List the logged-in user's reports, drafts included
+func (h *Handlers) HandleGetMyReports(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	reports, err := h.store.ListUserReports(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing reports", "err", err)
+		writeError(w, r, "Failed to read reports", http.StatusInternalServerError)
+		return
+	}
+
+	h.renderReports(r, reports)
+	h.writeJSONResponse(w, r, reports, http.StatusOK)
+}
+
+func (h *Handlers) HandleCreateReport(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req reportRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	report, ok := reportFromRequest(w, r, req, catalogue)
+	if !ok {
+		return
+	}
+	report.UserID = user.ID
+	report.AuthorName = user.DisplayName
+	if report.Moderation, ok = h.moderationForPost(w, r, user); !ok {
+		return
+	}
+
+	if err := h.store.CreateReport(report); err != nil {
+		h.log(r).Error("Error creating report", "err", err)
+		writeError(w, r, "Failed to create report", http.StatusInternalServerError)
+		return
+	}
+
+	h.renderReport(r, report)
+	h.publishReport(r, nil, report)
+	h.writeJSONResponse(w, r, report, http.StatusCreated)
+}
+
+func (h *Handlers) HandleGetReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.reportFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	h.renderReport(r, report)
+	h.writeJSONResponse(w, r, report, http.StatusOK)
+}
+
+// Replace one of the logged-in user's reports; set status to publish it
+func (h *Handlers) HandleUpdateReport(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.store.GetReport(id)
+	if err == nil && existing.UserID != user.ID {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		h.writeReportError(w, r, err)
+		return
+	}
+
+	var req reportRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	report, ok := reportFromRequest(w, r, req, catalogue)
+	if !ok {
+		return
+	}
+	report.ID = existing.ID
+	report.UserID = user.ID
+	report.AuthorName = user.DisplayName
+	report.CreatedAt = existing.CreatedAt
+	report.PublishedAt = existing.PublishedAt
+	report.Moderation = moderationForEdit(user, existing.Moderation)
+
+	if err := h.store.UpdateReport(report); err != nil {
+		h.writeReportError(w, r, err)
+		return
+	}
+
+	h.renderReport(r, report)
+	h.publishReport(r, existing, report)
+	h.writeJSONResponse(w, r, report, http.StatusOK)
+}
+
+func (h *Handlers) HandleDeleteReport(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.DeleteReport(user.ID, id); err != nil {
+		h.writeReportError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Hill detail page, listing the published trip reports about the hill
+func (h *Handlers) HandleHillPage(w http.ResponseWriter, r *http.Request) {
+	munro, ok := h.munroFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	reports, err := h.store.ListHillReports(munro.DoBIHNumber)
+	if err != nil {
+		h.log(r).Error("Error listing reports", "err", err)
+		writeError(w, r, "Failed to read reports", http.StatusInternalServerError)
+		return
+	}
+
+	// Set content type
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// Render the hill page template
+	if err := templates.HillPage(munro, reports).Render(r.Context(), w); err != nil {
+		h.log(r).Error("Error rendering template", "err", err)
+		writeError(w, r, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Trip report page. Drafts are shown to their author as a preview.
+func (h *Handlers) HandleReportPage(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.reportFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	catalogue, err := h.munrosByID()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	var hills []model.Munro
+	for _, id := range report.MunroIDs {
+		if munro, ok := catalogue[id]; ok {
+			hills = append(hills, munro)
+		}
+	}
+
+	h.renderReport(r, report)
+
+	// Set content type
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// Render the report page template
+	if err := templates.ReportPage(report, hills).Render(r.Context(), w); err != nil {
+		h.log(r).Error("Error rendering template", "err", err)
+		writeError(w, r, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+}
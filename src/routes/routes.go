@@ -2,14 +2,23 @@ package routes
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 
-	"github.com/AlexM141200/munros-api/src/csv"
+	"github.com/AlexM141200/munros-api/src/achievements"
+	"github.com/AlexM141200/munros-api/src/blob"
+	"github.com/AlexM141200/munros-api/src/dataset"
+	"github.com/AlexM141200/munros-api/src/logging"
 	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/notify"
+	"github.com/AlexM141200/munros-api/src/oidc"
+	"github.com/AlexM141200/munros-api/src/ratelimit"
+	"github.com/AlexM141200/munros-api/src/store"
 	templates "github.com/AlexM141200/munros-api/src/views"
+	"github.com/AlexM141200/munros-api/src/webhooks"
 )
 
 // DataService interface for flexible data source (CSV now, database later)
@@ -17,48 +26,114 @@ type DataService interface {
 	ReadMunros() ([]model.Munro, error)
 }
 
-// Global data service - can be switched between CSV and database
-var dataService DataService
-
-func init() {
-	// Initialize with CSV service - this can be changed to database later
-	dataService = csv.NewCSVService("./data/munrotab_v8.0.1.csv")
+// Deps is what the handlers are built from
+type Deps struct {
+	// Munros is the hill catalogue. It defaults to Dataset, so only one of
+	// them needs setting; a test can pass a fixed list of hills.
+	Munros DataService
+	// Dataset is the catalogue when it can be reloaded by admins
+	Dataset *dataset.Dataset
+	// Store holds accounts and everything users add
+	Store *store.Store
+	// Photos holds uploaded photo files
+	Photos blob.Store
+	// Webhooks receives events; without one none are published
+	Webhooks *webhooks.Dispatcher
+	// Notifier sends account emails
+	Notifier *notify.Notifier
+	// Achievements are the rules evaluated when ascents are logged
+	Achievements []achievements.Rule
+	// Providers are the external sign-in providers
+	Providers []*oidc.Provider
+	// CacheControl is sent with catalogue responses, unless it's empty
+	CacheControl string
+	// SiteURL is the public address of the site, for links in calendar
+	// feeds. Without it they're made from the request's host.
+	SiteURL string
+	// Logger is for work outside requests, and requests that don't carry
+	// their own. It defaults to slog's default logger.
+	Logger *slog.Logger
 }
 
-// CORS middleware
-func enableCORS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// Handlers serves the API and site pages. Everything they use is passed to
+// New, so separate instances, e.g. one per test server, share nothing.
+type Handlers struct {
+	munros       DataService
+	dataset      *dataset.Dataset
+	store        *store.Store
+	photos       blob.Store
+	webhooks     *webhooks.Dispatcher
+	notifier     *notify.Notifier
+	achievements []achievements.Rule
+	providers    []*oidc.Provider
+	cacheControl string
+	siteURL      string
+	logger       *slog.Logger
+
+	limiter  *ratelimit.Limiter
+	apiUsage *usageCounter
+	summits  summitCache
+	// Emails being sent after their request has finished
+	background sync.WaitGroup
+}
 
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+// New returns handlers using deps
+func New(deps Deps) *Handlers {
+	h := &Handlers{
+		munros:       deps.Munros,
+		dataset:      deps.Dataset,
+		store:        deps.Store,
+		photos:       deps.Photos,
+		webhooks:     deps.Webhooks,
+		notifier:     deps.Notifier,
+		achievements: deps.Achievements,
+		providers:    deps.Providers,
+		cacheControl: deps.CacheControl,
+		siteURL:      strings.TrimSuffix(deps.SiteURL, "/"),
+		logger:       deps.Logger,
+		limiter:      ratelimit.New(),
+		apiUsage:     &usageCounter{counts: make(map[usageKey]*store.UsageCount)},
+	}
+	if h.munros == nil && h.dataset != nil {
+		h.munros = h.dataset
+	}
+	if h.logger == nil {
+		h.logger = slog.Default()
 	}
+	return h
 }
 
-// Handle JSON response with error handling
-func writeJSONResponse(w http.ResponseWriter, data interface{}, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+// The logger for r: the one the middleware gave it, with its request ID,
+// or the handlers' own, along with the route it matched
+func (h *Handlers) log(r *http.Request) *slog.Logger {
+	logger, ok := logging.Lookup(r.Context())
+	if !ok {
+		logger = h.logger
 	}
+	return logger.With("route", r.Pattern)
 }
 
-// Get all munros with optional filtering
-func HandleGetMunros(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w, r)
-	if r.Method == "OPTIONS" {
+// Handle JSON response with error handling. The body is encoded before
+// anything is written, so a failure can still be reported as an error.
+func (h *Handlers) writeJSONResponse(w http.ResponseWriter, r *http.Request, data interface{}, statusCode int) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		h.log(r).Error("Error encoding JSON response", "err", err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	munros, err := dataService.ReadMunros()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(append(body, '\n'))
+}
+
+// Get all munros with optional filtering
+func (h *Handlers) HandleGetMunros(w http.ResponseWriter, r *http.Request) {
+	munros, err := h.munros.ReadMunros()
 	if err != nil {
-		log.Printf("Error reading munros: %v", err)
-		http.Error(w, "Failed to read munros data", http.StatusInternalServerError)
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
 		return
 	}
 
@@ -66,26 +141,21 @@ func HandleGetMunros(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	filteredMunros := filterMunros(munros, query)
 
-	writeJSONResponse(w, filteredMunros, http.StatusOK)
+	h.writeJSONResponse(w, r, filteredMunros, http.StatusOK)
 }
 
 // Get specific munro by ID
-func HandleMunroByID(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w, r)
-	if r.Method == "OPTIONS" {
-		return
-	}
-
+func (h *Handlers) HandleMunroByID(w http.ResponseWriter, r *http.Request) {
 	munroID := r.PathValue("id")
 	if munroID == "" {
-		http.Error(w, "Missing munro ID", http.StatusBadRequest)
+		writeError(w, r, "Missing munro ID", http.StatusBadRequest)
 		return
 	}
 
-	munros, err := dataService.ReadMunros()
+	munros, err := h.munros.ReadMunros()
 	if err != nil {
-		log.Printf("Error reading munros: %v", err)
-		http.Error(w, "Failed to read munros data", http.StatusInternalServerError)
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
 		return
 	}
 
@@ -93,27 +163,23 @@ func HandleMunroByID(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(munroID)
 	for _, munro := range munros {
 		if munro.RunningNo == id || munro.DoBIHNumber == id {
-			writeJSONResponse(w, munro, http.StatusOK)
+			h.writeJSONResponse(w, r, munro, http.StatusOK)
 			return
 		}
 	}
 
-	http.Error(w, "Munro not found", http.StatusNotFound)
+	writeError(w, r, "Munro not found", http.StatusNotFound)
 }
 
 // Legacy endpoint for CSV data
-func HandleMunrosCSV(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w, r)
-	if r.Method == "OPTIONS" {
-		return
-	}
+func (h *Handlers) HandleMunrosCSV(w http.ResponseWriter, r *http.Request) {
 	// Just redirect to JSON endpoint
-	HandleGetMunros(w, r)
+	h.HandleGetMunros(w, r)
 }
 
 // Alias for handleGetMunros
-func HandleGetAllMunros(w http.ResponseWriter, r *http.Request) {
-	HandleGetMunros(w, r)
+func (h *Handlers) HandleGetAllMunros(w http.ResponseWriter, r *http.Request) {
+	h.HandleGetMunros(w, r)
 }
 
 // Helper function to filter munros based on query parameters
@@ -167,28 +233,28 @@ func filterMunros(munros []model.Munro, query map[string][]string) []model.Munro
 //
 //
 
-func HandleIndex(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) HandleIndex(w http.ResponseWriter, r *http.Request) {
 	// Set content type
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	// Render the landing page template
 	err := templates.Landing().Render(r.Context(), w)
 	if err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		h.log(r).Error("Error rendering template", "err", err)
+		writeError(w, r, "Failed to render page", http.StatusInternalServerError)
 		return
 	}
 }
 
-func HandleMap(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) HandleMap(w http.ResponseWriter, r *http.Request) {
 	// Set content type
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	// Render the map page template
 	err := templates.MapPage().Render(r.Context(), w)
 	if err != nil {
-		log.Printf("Error rendering template: %v", err)
-		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		h.log(r).Error("Error rendering template", "err", err)
+		writeError(w, r, "Failed to render page", http.StatusInternalServerError)
 		return
 	}
 }
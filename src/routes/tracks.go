@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/track"
+)
+
+// Largest track file accepted for upload
+const maxTrackUploadBytes = 20 << 20
+
+type trackSummitsResponse struct {
+	Format  string         `json:"format"`
+	Points  int            `json:"points"`
+	Radius  float64        `json:"radius_m"`
+	Summits []track.Summit `json:"summits"`
+}
+
+// summitCache keeps the summit index for the catalogue it was built from,
+// so it's only rebuilt when the catalogue is reloaded
+type summitCache struct {
+	mu     sync.Mutex
+	munros []model.Munro
+	index  *track.SummitIndex
+}
+
+// The summit index over munros, as just read from the catalogue
+func (h *Handlers) summitIndex(munros []model.Munro) *track.SummitIndex {
+	c := &h.summits
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A reload replaces the slice, so the same slice means the same hills
+	same := c.index != nil && len(c.munros) == len(munros) && (len(munros) == 0 || &c.munros[0] == &munros[0])
+	if !same {
+		c.munros, c.index = munros, track.NewSummitIndex(munros)
+	}
+	return c.index
+}
+
+// Detect the hills reached by an uploaded GPX/TCX/FIT track. Nothing is
+// logged; the client confirms the summits it wants via POST /api/ascents.
+func (h *Handlers) HandleTrackSummits(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentUser(w, r); !ok {
+		return
+	}
+
+	radius := track.DefaultSummitRadius
+	if value := r.URL.Query().Get("radius"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > track.MaxSummitRadius {
+			writeError(w, r, "Invalid radius", http.StatusBadRequest)
+			return
+		}
+		radius = parsed
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxTrackUploadBytes)
+	file, header, err := r.FormFile("track")
+	if err != nil {
+		writeError(w, r, "Missing track file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	trk, err := track.Parse(file, header.Filename)
+	if err != nil {
+		if errors.Is(err, track.ErrUnknownFormat) {
+			writeError(w, r, "Track must be GPX, TCX or FIT", http.StatusUnsupportedMediaType)
+			return
+		}
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		writeError(w, r, "Failed to read munros data", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, trackSummitsResponse{
+		Format:  trk.Format,
+		Points:  len(trk.Points),
+		Radius:  radius,
+		Summits: h.summitIndex(munros).DetectSummits(trk.Points, radius),
+	}, http.StatusOK)
+}
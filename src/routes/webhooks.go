@@ -0,0 +1,333 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AlexM141200/munros-api/src/auth"
+	"github.com/AlexM141200/munros-api/src/dataset"
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/progress"
+	"github.com/AlexM141200/munros-api/src/store"
+	"github.com/AlexM141200/munros-api/src/webhooks"
+)
+
+const (
+	maxWebhooksPerUser = 10
+	defaultDeliveries  = 50
+)
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// Queue an event for the webhooks that want it. Events are a side effect,
+// so failures are logged, to logger, rather than returned.
+func (h *Handlers) publishEvent(logger *slog.Logger, event string, userID int64, data any) {
+	h.publishVisibleEvent(logger, event, userID, data, data)
+}
+
+// Queue an event whose data only userID may see in full, sending public to
+// other subscribers (admins), or nothing if it's nil
+func (h *Handlers) publishVisibleEvent(logger *slog.Logger, event string, userID int64, data, public any) {
+	if h.webhooks == nil {
+		return
+	}
+	if err := h.webhooks.PublishVisible(event, userID, data, public); err != nil {
+		logger.Error("Error publishing event", "event", event, "err", err)
+	}
+}
+
+// Publish a dataset diff, if anything changed
+func (h *Handlers) PublishDatasetDiff(diff dataset.Diff) {
+	if diff.Empty() {
+		return
+	}
+	h.publishEvent(h.logger, webhooks.EventDatasetReloaded, 0, diff)
+}
+
+func publicAscents(ascents []model.Ascent) []model.Ascent {
+	var public []model.Ascent
+	for _, a := range ascents {
+		if a.Visibility == model.VisibilityPublic {
+			public = append(public, a)
+		}
+	}
+	return public
+}
+
+// Publish the ascents a user has just logged, and their compleation if
+// these ascents finished the list. Other people's webhooks only hear of
+// public ascents, and of a compleation the public ascents alone make.
+func (h *Handlers) publishAscents(r *http.Request, user *model.User, ascents []model.Ascent, before progress.Progress) {
+	var public any
+	if p := publicAscents(ascents); len(p) > 0 {
+		public = map[string]any{"user_id": user.ID, "ascents": p}
+	}
+	h.publishVisibleEvent(h.log(r), webhooks.EventAscentLogged, user.ID, map[string]any{
+		"user_id": user.ID,
+		"ascents": ascents,
+	}, public)
+
+	if before.Complete {
+		return
+	}
+	munros, err := h.munros.ReadMunros()
+	if err != nil {
+		h.log(r).Error("Error reading munros", "err", err)
+		return
+	}
+	all, err := h.store.ListAscents(user.ID)
+	if err != nil {
+		h.log(r).Error("Error computing progress", "err", err)
+		return
+	}
+	after := progress.Compute(munros, all)
+	if !after.Complete {
+		return
+	}
+
+	data := map[string]any{
+		"user_id":      user.ID,
+		"display_name": user.DisplayName,
+		"completion":   after.Final,
+	}
+	public = nil
+	if progress.Compute(munros, publicAscents(all)).Complete {
+		public = data
+	}
+	h.publishVisibleEvent(h.log(r), webhooks.EventCompleation, user.ID, data, public)
+}
+
+// Publish a report when it first becomes visible to everyone
+func (h *Handlers) publishReport(r *http.Request, before, after *model.Report) {
+	visible := func(r *model.Report) bool {
+		return r != nil && r.Status == model.ReportStatusPublished && r.Moderation == model.ModerationApproved
+	}
+	if visible(before) || !visible(after) {
+		return
+	}
+	h.publishEvent(h.log(r), webhooks.EventReportPublished, after.UserID, after)
+}
+
+func (h *Handlers) webhookFromPath(w http.ResponseWriter, r *http.Request, user *model.User) (*model.Webhook, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid webhook ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	hook, err := h.store.GetWebhook(user.ID, id)
+	if err != nil {
+		h.writeWebhookError(w, r, err)
+		return nil, false
+	}
+	return hook, true
+}
+
+func (h *Handlers) writeWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, r, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	h.log(r).Error("Error reading webhook", "err", err)
+	writeError(w, r, "Failed to read webhook", http.StatusInternalServerError)
+}
+
+// List the logged-in user's webhooks
+func (h *Handlers) HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	hooks, err := h.store.ListWebhooks(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing webhooks", "err", err)
+		writeError(w, r, "Failed to read webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, hooks, http.StatusOK)
+}
+
+// Register a webhook. The response is the only time the signing secret is
+// shown.
+func (h *Handlers) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if !readJSONRequest(w, r, &req) {
+		return
+	}
+
+	target, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeError(w, r, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	if err := webhooks.CheckURL(r.Context(), target); err != nil {
+		if errors.Is(err, webhooks.ErrForbiddenAddress) {
+			writeError(w, r, "url must not point at a local or private address", http.StatusBadRequest)
+			return
+		}
+		writeError(w, r, "url's host could not be found", http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		writeError(w, r, "events must list at least one of "+strings.Join(webhooks.Events, ", "), http.StatusBadRequest)
+		return
+	}
+	for _, event := range req.Events {
+		if !validChoice(w, r, "events", event, webhooks.Events) {
+			return
+		}
+	}
+
+	existing, err := h.store.ListWebhooks(user.ID)
+	if err != nil {
+		h.log(r).Error("Error listing webhooks", "err", err)
+		writeError(w, r, "Failed to read webhooks", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxWebhooksPerUser {
+		writeError(w, r, "Too many webhooks; delete one first", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.NewToken()
+	if err != nil {
+		h.log(r).Error("Error generating webhook secret", "err", err)
+		writeError(w, r, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	hook := &model.Webhook{
+		UserID: user.ID,
+		URL:    target.String(),
+		Events: req.Events,
+		Secret: secret,
+	}
+	if err := h.store.CreateWebhook(hook); err != nil {
+		h.log(r).Error("Error creating webhook", "err", err)
+		writeError(w, r, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, hook, http.StatusCreated)
+}
+
+func (h *Handlers) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	hook, ok := h.webhookFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteWebhook(user.ID, hook.ID); err != nil {
+		h.writeWebhookError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List a webhook's most recent deliveries, newest first
+func (h *Handlers) HandleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	hook, ok := h.webhookFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.store.ListDeliveries(hook.ID, defaultDeliveries)
+	if err != nil {
+		h.log(r).Error("Error listing deliveries", "err", err)
+		writeError(w, r, "Failed to read deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, deliveries, http.StatusOK)
+}
+
+// Send an earlier delivery again, as a new delivery with its own log entry
+func (h *Handlers) HandleReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	if h.webhooks == nil {
+		writeError(w, r, "Webhooks are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	hook, ok := h.webhookFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if err != nil {
+		writeError(w, r, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	original, err := h.store.GetDelivery(user.ID, hook.ID, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Delivery not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("Error reading delivery", "err", err)
+		writeError(w, r, "Failed to read delivery", http.StatusInternalServerError)
+		return
+	}
+
+	replay, err := h.webhooks.Replay(original)
+	if err != nil {
+		h.log(r).Error("Error replaying delivery", "err", err)
+		writeError(w, r, "Failed to replay delivery", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSONResponse(w, r, replay, http.StatusAccepted)
+}
+
+// Re-read the hill catalogue now rather than waiting for the file watcher,
+// returning what changed
+func (h *Handlers) HandleReloadDataset(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.currentAdmin(w, r); !ok {
+		return
+	}
+	if h.dataset == nil {
+		writeError(w, r, "Dataset is not reloadable", http.StatusNotImplemented)
+		return
+	}
+
+	diff, err := h.dataset.Reload()
+	if err != nil {
+		h.log(r).Error("Error reloading dataset", "err", err)
+		writeError(w, r, "Failed to reload dataset", http.StatusInternalServerError)
+		return
+	}
+	h.PublishDatasetDiff(diff)
+
+	h.writeJSONResponse(w, r, diff, http.StatusOK)
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+const apiKeyColumns = `k.id, k.user_id, k.name, k.prefix, k.scopes, k.rate_per_minute, k.burst, k.created_at, k.last_used_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*model.APIKey, error) {
+	var k model.APIKey
+	var scopes string
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &scopes, &k.RatePerMinute, &k.Burst, &k.CreatedAt, &k.LastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	k.Scopes = strings.Split(scopes, ",")
+	return &k, nil
+}
+
+func (s *Store) queryAPIKeys(query string, args ...any) ([]model.APIKey, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// CreateAPIKey stores a key under the hash of its secret
+func (s *Store) CreateAPIKey(key *model.APIKey, keyHash string) error {
+	key.CreatedAt = time.Now().UTC()
+	res, err := s.db.Exec(
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, rate_per_minute, burst, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.UserID, key.Name, key.Prefix, keyHash, strings.Join(key.Scopes, ","), key.RatePerMinute, key.Burst, key.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	key.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetAPIKeyByHash returns a key and the user it belongs to
+func (s *Store) GetAPIKeyByHash(keyHash string) (*model.APIKey, *model.User, error) {
+	key, err := scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys k WHERE k.key_hash = ?`, keyHash))
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.GetUser(key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, user, nil
+}
+
+func (s *Store) GetAPIKey(userID, id int64) (*model.APIKey, error) {
+	return scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys k WHERE k.id = ? AND k.user_id = ?`, id, userID))
+}
+
+func (s *Store) ListAPIKeys(userID int64) ([]model.APIKey, error) {
+	return s.queryAPIKeys(`SELECT `+apiKeyColumns+` FROM api_keys k WHERE k.user_id = ? ORDER BY k.id`, userID)
+}
+
+// ListAllAPIKeys returns every user's keys, most recently used first
+func (s *Store) ListAllAPIKeys() ([]model.APIKey, error) {
+	return s.queryAPIKeys(`SELECT ` + apiKeyColumns + ` FROM api_keys k ORDER BY k.last_used_at IS NULL, k.last_used_at DESC, k.id`)
+}
+
+func (s *Store) DeleteAPIKey(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM api_keys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetAPIKeyQuota changes a key's rate limit
+func (s *Store) SetAPIKeyQuota(id int64, perMinute, burst int) (*model.APIKey, error) {
+	res, err := s.db.Exec(`UPDATE api_keys SET rate_per_minute = ?, burst = ? WHERE id = ?`, perMinute, burst, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys k WHERE k.id = ?`, id))
+}
+
+// UsageCount is a batch of requests by one key on one day
+type UsageCount struct {
+	KeyID    int64
+	Day      string
+	Requests int
+	Limited  int
+	LastUsed time.Time
+}
+
+// AddAPIKeyUsage adds counted requests to the daily totals. Keys deleted
+// since the requests were counted are skipped.
+func (s *Store) AddAPIKeyUsage(counts []UsageCount) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range counts {
+		res, err := tx.Exec(`UPDATE api_keys SET last_used_at = MAX(COALESCE(last_used_at, ?), ?) WHERE id = ?`,
+			c.LastUsed.UTC(), c.LastUsed.UTC(), c.KeyID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+
+		if _, err := tx.Exec(
+			`INSERT INTO api_key_usage (key_id, day, requests, limited) VALUES (?, ?, ?, ?)
+			 ON CONFLICT (key_id, day) DO UPDATE SET
+			   requests = requests + excluded.requests, limited = limited + excluded.limited`,
+			c.KeyID, c.Day, c.Requests, c.Limited,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListAPIKeyUsage returns a key's daily totals since a day (YYYY-MM-DD),
+// newest first
+func (s *Store) ListAPIKeyUsage(keyID int64, since string) ([]model.APIKeyUsage, error) {
+	rows, err := s.db.Query(
+		`SELECT day, requests, limited FROM api_key_usage WHERE key_id = ? AND day >= ? ORDER BY day DESC`,
+		keyID, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []model.APIKeyUsage{}
+	for rows.Next() {
+		var u model.APIKeyUsage
+		if err := rows.Scan(&u.Day, &u.Requests, &u.Limited); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// CreateAscents logs a batch of ascents in a single transaction
+func (s *Store) CreateAscents(ascents []model.Ascent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for i := range ascents {
+		a := &ascents[i]
+		a.CreatedAt = now
+		if a.Visibility == "" {
+			a.Visibility = model.VisibilityPublic
+		}
+
+		res, err := tx.Exec(
+			`INSERT INTO ascents (user_id, munro_id, climbed_at, notes, source, visibility, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			a.UserID, a.MunroID, a.ClimbedAt.UTC(), a.Notes, a.Source, a.Visibility, a.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if a.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const ascentColumns = `a.id, a.user_id, a.munro_id, a.climbed_at, a.notes, a.source, a.visibility, a.created_at`
+
+// Scan ascentColumns into a, followed by any extra columns
+func scanAscent(row interface{ Scan(...any) error }, a *model.Ascent, extra ...any) error {
+	dest := []any{&a.ID, &a.UserID, &a.MunroID, &a.ClimbedAt, &a.Notes, &a.Source, &a.Visibility, &a.CreatedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func scanAscents(rows *sql.Rows) ([]model.Ascent, error) {
+	defer rows.Close()
+
+	ascents := []model.Ascent{}
+	for rows.Next() {
+		var a model.Ascent
+		if err := scanAscent(rows, &a); err != nil {
+			return nil, err
+		}
+		ascents = append(ascents, a)
+	}
+
+	return ascents, rows.Err()
+}
+
+// ListAscents returns a user's ascents, most recent first
+func (s *Store) ListAscents(userID int64) ([]model.Ascent, error) {
+	rows, err := s.db.Query(
+		`SELECT `+ascentColumns+` FROM ascents a
+		 WHERE a.user_id = ? ORDER BY a.climbed_at DESC, a.id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAscents(rows)
+}
+
+// SetAscentVisibility changes who can see one of a user's ascents
+func (s *Store) SetAscentVisibility(userID, id int64, visibility string) error {
+	res, err := s.db.Exec(`UPDATE ascents SET visibility = ? WHERE id = ? AND user_id = ?`, visibility, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAscent removes one of a user's ascents
+func (s *Store) DeleteAscent(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM ascents WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
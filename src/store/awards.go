@@ -0,0 +1,83 @@
+package store
+
+import (
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// AddAwards stores any awards the user doesn't already hold and returns the
+// ones that were new
+func (s *Store) AddAwards(awards []model.Award) ([]model.Award, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	added := []model.Award{}
+	for _, a := range awards {
+		res, err := tx.Exec(
+			`INSERT OR IGNORE INTO awards (user_id, achievement_id, grp, awarded_at, visibility, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			a.UserID, a.AchievementID, a.Group, a.AwardedAt.UTC(), a.Visibility, now,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added = append(added, a)
+		}
+	}
+
+	return added, tx.Commit()
+}
+
+// SetAwardVisibilities updates the visibility of a user's awards to that of
+// the given ones. Awards that aren't given are no longer earned by any
+// ascent the user has, so become private.
+func (s *Store) SetAwardVisibilities(userID int64, awards []model.Award) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE awards SET visibility = ? WHERE user_id = ?`, model.VisibilityPrivate, userID); err != nil {
+		return err
+	}
+	for _, a := range awards {
+		if _, err := tx.Exec(
+			`UPDATE awards SET visibility = ? WHERE user_id = ? AND achievement_id = ? AND grp = ?`,
+			a.Visibility, userID, a.AchievementID, a.Group,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListAwards returns a user's awards, most recent first. Name and
+// description are filled in by the caller from the rule definitions.
+func (s *Store) ListAwards(userID int64) ([]model.Award, error) {
+	rows, err := s.db.Query(
+		`SELECT user_id, achievement_id, grp, awarded_at, visibility FROM awards
+		 WHERE user_id = ? ORDER BY awarded_at DESC, achievement_id, grp`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awards := []model.Award{}
+	for rows.Next() {
+		var a model.Award
+		if err := rows.Scan(&a.UserID, &a.AchievementID, &a.Group, &a.AwardedAt, &a.Visibility); err != nil {
+			return nil, err
+		}
+		awards = append(awards, a)
+	}
+	return awards, rows.Err()
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SetCalendarToken stores the (hashed) token for a user's calendar feed,
+// replacing any previous one
+func (s *Store) SetCalendarToken(userID int64, tokenHash string) error {
+	_, err := s.db.Exec(
+		`INSERT INTO calendar_tokens (user_id, token_hash, created_at) VALUES (?, ?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = excluded.created_at`,
+		userID, tokenHash, time.Now().UTC(),
+	)
+	return err
+}
+
+func (s *Store) DeleteCalendarToken(userID int64) error {
+	_, err := s.db.Exec(`DELETE FROM calendar_tokens WHERE user_id = ?`, userID)
+	return err
+}
+
+// GetCalendarTokenUser returns the ID of the user owning a calendar token
+func (s *Store) GetCalendarTokenUser(tokenHash string) (int64, error) {
+	var userID int64
+	err := s.db.QueryRow(`SELECT user_id FROM calendar_tokens WHERE token_hash = ?`, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// SetRating creates or replaces a user's rating of a hill
+func (s *Store) SetRating(rating *model.Rating) error {
+	rating.UpdatedAt = time.Now().UTC()
+	_, err := s.db.Exec(
+		`INSERT INTO ratings (user_id, munro_id, scenery, difficulty, navigation, bogginess, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (user_id, munro_id) DO UPDATE SET
+		   scenery = excluded.scenery, difficulty = excluded.difficulty, navigation = excluded.navigation,
+		   bogginess = excluded.bogginess, updated_at = excluded.updated_at`,
+		rating.UserID, rating.MunroID, rating.Scenery, rating.Difficulty, rating.Navigation, rating.Bogginess, rating.UpdatedAt,
+	)
+	return err
+}
+
+func (s *Store) GetRating(userID int64, munroID int) (*model.Rating, error) {
+	var r model.Rating
+	err := s.db.QueryRow(
+		`SELECT user_id, munro_id, scenery, difficulty, navigation, bogginess, updated_at
+		 FROM ratings WHERE user_id = ? AND munro_id = ?`,
+		userID, munroID,
+	).Scan(&r.UserID, &r.MunroID, &r.Scenery, &r.Difficulty, &r.Navigation, &r.Bogginess, &r.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) DeleteRating(userID int64, munroID int) error {
+	res, err := s.db.Exec(`DELETE FROM ratings WHERE user_id = ? AND munro_id = ?`, userID, munroID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListUserRatings returns every rating a user has given
+func (s *Store) ListUserRatings(userID int64) ([]model.Rating, error) {
+	rows, err := s.db.Query(
+		`SELECT user_id, munro_id, scenery, difficulty, navigation, bogginess, updated_at
+		 FROM ratings WHERE user_id = ? ORDER BY munro_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []model.Rating{}
+	for rows.Next() {
+		var r model.Rating
+		if err := rows.Scan(&r.UserID, &r.MunroID, &r.Scenery, &r.Difficulty, &r.Navigation, &r.Bogginess, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, r)
+	}
+	return ratings, rows.Err()
+}
+
+// HillRatings averages everyone's ratings of a hill
+func (s *Store) HillRatings(munroID int) (*model.HillRatings, error) {
+	agg := model.HillRatings{MunroID: munroID}
+	err := s.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(AVG(scenery), 0), COALESCE(AVG(difficulty), 0),
+		        COALESCE(AVG(navigation), 0), COALESCE(AVG(bogginess), 0)
+		 FROM ratings WHERE munro_id = ?`,
+		munroID,
+	).Scan(&agg.Count, &agg.Scenery, &agg.Difficulty, &agg.Navigation, &agg.Bogginess)
+	if err != nil {
+		return nil, err
+	}
+	return &agg, nil
+}
+
+const conditionColumns = `c.id, c.user_id, u.display_name, c.munro_id, c.observed_on, c.snow_cover, c.path,
+	c.river_crossings, c.notes, c.moderation, c.created_at`
+
+const conditionFrom = ` FROM conditions c JOIN users u ON u.id = c.user_id`
+
+func (s *Store) CreateCondition(report *model.ConditionReport) error {
+	report.CreatedAt = time.Now().UTC()
+	res, err := s.db.Exec(
+		`INSERT INTO conditions (user_id, munro_id, observed_on, snow_cover, path, river_crossings, notes, moderation, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		report.UserID, report.MunroID, report.ObservedOn, report.SnowCover, report.Path, report.RiverCrossings,
+		report.Notes, report.Moderation, report.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	report.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Store) queryConditions(query string, args ...any) ([]model.ConditionReport, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []model.ConditionReport{}
+	for rows.Next() {
+		var c model.ConditionReport
+		if err := rows.Scan(&c.ID, &c.UserID, &c.AuthorName, &c.MunroID, &c.ObservedOn, &c.SnowCover, &c.Path,
+			&c.RiverCrossings, &c.Notes, &c.Moderation, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		reports = append(reports, c)
+	}
+	return reports, rows.Err()
+}
+
+// ListHillConditions returns a hill's approved reports observed on or after
+// since (YYYY-MM-DD), newest first
+func (s *Store) ListHillConditions(munroID int, since string) ([]model.ConditionReport, error) {
+	return s.queryConditions(
+		`SELECT `+conditionColumns+conditionFrom+` WHERE c.munro_id = ? AND c.observed_on >= ? AND c.moderation = ?
+		 ORDER BY c.observed_on DESC, c.id DESC`,
+		munroID, since, model.ModerationApproved,
+	)
+}
+
+// ListRecentConditions returns every approved report observed on or after
+// since (YYYY-MM-DD), newest first
+func (s *Store) ListRecentConditions(since string) ([]model.ConditionReport, error) {
+	return s.queryConditions(
+		`SELECT `+conditionColumns+conditionFrom+` WHERE c.observed_on >= ? AND c.moderation = ?
+		 ORDER BY c.observed_on DESC, c.id DESC`,
+		since, model.ModerationApproved,
+	)
+}
+
+// ListUserConditions returns all of a user's condition reports, whatever
+// their moderation status, newest first
+func (s *Store) ListUserConditions(userID int64) ([]model.ConditionReport, error) {
+	return s.queryConditions(
+		`SELECT `+conditionColumns+conditionFrom+` WHERE c.user_id = ? ORDER BY c.observed_on DESC, c.id DESC`,
+		userID,
+	)
+}
+
+func (s *Store) DeleteCondition(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM conditions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
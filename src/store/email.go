@@ -0,0 +1,252 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// CreateEmailToken stores a link sent to a user's address, for the given
+// (already hashed) token
+func (s *Store) CreateEmailToken(tokenHash string, token *model.EmailToken) error {
+	token.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec(
+		`INSERT INTO email_tokens (token_hash, user_id, purpose, email, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		tokenHash, token.UserID, token.Purpose, token.Email, token.CreatedAt, token.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// TakeEmailToken returns and removes an unexpired token, so that each link
+// works only once
+func (s *Store) TakeEmailToken(tokenHash, purpose string) (*model.EmailToken, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var token model.EmailToken
+	err = tx.QueryRow(
+		`SELECT user_id, purpose, email, created_at, expires_at FROM email_tokens
+		 WHERE token_hash = ? AND purpose = ? AND expires_at > ?`,
+		tokenHash, purpose, time.Now().UTC(),
+	).Scan(&token.UserID, &token.Purpose, &token.Email, &token.CreatedAt, &token.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM email_tokens WHERE token_hash = ?`, tokenHash); err != nil {
+		return nil, err
+	}
+	return &token, tx.Commit()
+}
+
+// LastEmailTokenAt returns when a token for purpose was last sent to the
+// user, or the zero time if none is outstanding
+func (s *Store) LastEmailTokenAt(userID int64, purpose string) (time.Time, error) {
+	var last sql.NullTime
+	err := s.db.QueryRow(
+		`SELECT MAX(created_at) FROM email_tokens WHERE user_id = ? AND purpose = ?`,
+		userID, purpose,
+	).Scan(&last)
+	return last.Time, err
+}
+
+// MarkEmailVerified records that the user owns their current address. It
+// does nothing if the address has changed since the link was sent.
+func (s *Store) MarkEmailVerified(userID int64, email string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ? AND email = ?`,
+		time.Now().UTC(), userID, email,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`DELETE FROM email_tokens WHERE user_id = ? AND purpose = ?`, userID, model.EmailTokenVerify,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword sets a new password hash, signs the user out everywhere and
+// revokes their API keys, which whoever knew the old password could have
+// made. Following the reset link also proves they own the address.
+func (s *Store) ResetPassword(userID int64, email, passwordHash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE users SET password_hash = ?, email_verified_at = COALESCE(email_verified_at, ?)
+		 WHERE id = ? AND email = ? AND deleted_at IS NULL`,
+		passwordHash, time.Now().UTC(), userID, email,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	for _, table := range []string{"sessions", "api_keys", "email_tokens"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) GetEmailPreferences(userID int64) (*model.EmailPreferences, error) {
+	var prefs model.EmailPreferences
+	err := s.db.QueryRow(
+		`SELECT weekly_digest, trip_alerts FROM users WHERE id = ?`, userID,
+	).Scan(&prefs.WeeklyDigest, &prefs.TripAlerts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+func (s *Store) SetEmailPreferences(userID int64, prefs *model.EmailPreferences) error {
+	res, err := s.db.Exec(
+		`UPDATE users SET weekly_digest = ?, trip_alerts = ? WHERE id = ?`,
+		prefs.WeeklyDigest, prefs.TripAlerts, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimEmail records that an email of a kind is being sent to the user for
+// ref (a week, a trip), returning false if it already has been
+func (s *Store) ClaimEmail(userID int64, kind, ref string) (bool, error) {
+	res, err := s.db.Exec(
+		`INSERT OR IGNORE INTO email_log (user_id, kind, ref, sent_at) VALUES (?, ?, ?, ?)`,
+		userID, kind, ref, time.Now().UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseEmail forgets a claim whose email failed to send, so it's retried
+func (s *Store) ReleaseEmail(userID int64, kind, ref string) error {
+	_, err := s.db.Exec(`DELETE FROM email_log WHERE user_id = ? AND kind = ? AND ref = ?`, userID, kind, ref)
+	return err
+}
+
+// ListDigestRecipients returns the verified users who want the weekly digest
+func (s *Store) ListDigestRecipients() ([]model.User, error) {
+	rows, err := s.db.Query(
+		`SELECT ` + userColumns + ` FROM users u
+		 WHERE u.weekly_digest = 1 AND u.email_verified_at IS NOT NULL AND u.deleted_at IS NULL
+		 ORDER BY u.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// ListFriendAscents returns ascents logged since a time by the people the
+// user follows or shares a group with, newest first, leaving out any the
+// user isn't allowed to see
+func (s *Store) ListFriendAscents(userID int64, since time.Time) ([]model.FriendAscent, error) {
+	rows, err := s.db.Query(
+		`SELECT `+ascentColumns+`, u.display_name FROM ascents a
+		 JOIN users u ON u.id = a.user_id
+		 WHERE a.created_at >= ? AND a.user_id != ? AND u.deleted_at IS NULL
+		   AND (a.user_id IN (SELECT followee_id FROM follows WHERE follower_id = ?)
+		     OR a.user_id IN (
+		       SELECT other.user_id FROM group_members mine
+		       JOIN group_members other ON other.group_id = mine.group_id
+		       WHERE mine.user_id = ?))
+		   AND `+ascentVisibleTo+`
+		 ORDER BY a.climbed_at DESC, a.id DESC`,
+		since.UTC(), userID, userID, userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ascents []model.FriendAscent
+	for rows.Next() {
+		var a model.FriendAscent
+		if err := scanAscent(rows, &a.Ascent, &a.DisplayName); err != nil {
+			return nil, err
+		}
+		ascents = append(ascents, a)
+	}
+	return ascents, rows.Err()
+}
+
+// ListTripsStarting returns the plans starting between two dates
+// (YYYY-MM-DD, inclusive) whose owners want trip alerts, with their hills
+func (s *Store) ListTripsStarting(from, to string) ([]model.Plan, error) {
+	rows, err := s.db.Query(
+		`SELECT `+planColumns+` FROM plans
+		 WHERE start_date BETWEEN ? AND ? AND user_id IN (
+		   SELECT id FROM users
+		   WHERE trip_alerts = 1 AND email_verified_at IS NOT NULL AND deleted_at IS NULL)
+		 ORDER BY start_date, id`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []model.Plan
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		plans = append(plans, *plan)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range plans {
+		if err := s.loadPlanHills(&plans[i]); err != nil {
+			return nil, err
+		}
+	}
+	return plans, nil
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Condition on an ascent aliased as a: the viewer given as the parameter may
+// see it. Callers handle the climber seeing their own.
+const ascentVisibleTo = `(a.visibility = '` + model.VisibilityPublic + `'
+	OR (a.visibility = '` + model.VisibilityFollowers + `'
+	    AND a.user_id IN (SELECT followee_id FROM follows WHERE follower_id = ?)))`
+
+// Follow makes follower follow followee; following someone twice is not an
+// error. Deleted users can't be followed.
+func (s *Store) Follow(followerID, followeeID int64) error {
+	var exists bool
+	if err := s.db.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL)`, followeeID,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	_, err := s.db.Exec(
+		`INSERT OR IGNORE INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?)`,
+		followerID, followeeID, time.Now().UTC(),
+	)
+	return err
+}
+
+func (s *Store) Unfollow(followerID, followeeID int64) error {
+	res, err := s.db.Exec(`DELETE FROM follows WHERE follower_id = ? AND followee_id = ?`, followerID, followeeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListFollowing returns the users someone follows, most recent first
+func (s *Store) ListFollowing(userID int64) ([]model.Follow, error) {
+	return s.queryFollows(
+		`SELECT f.followee_id, u.display_name, f.created_at FROM follows f
+		 JOIN users u ON u.id = f.followee_id
+		 WHERE f.follower_id = ? ORDER BY f.created_at DESC`,
+		userID,
+	)
+}
+
+// ListFollowers returns the users following someone, most recent first
+func (s *Store) ListFollowers(userID int64) ([]model.Follow, error) {
+	return s.queryFollows(
+		`SELECT f.follower_id, u.display_name, f.created_at FROM follows f
+		 JOIN users u ON u.id = f.follower_id
+		 WHERE f.followee_id = ? ORDER BY f.created_at DESC`,
+		userID,
+	)
+}
+
+func (s *Store) queryFollows(query string, args ...any) ([]model.Follow, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []model.Follow{}
+	for rows.Next() {
+		var f model.Follow
+		if err := rows.Scan(&f.UserID, &f.DisplayName, &f.Since); err != nil {
+			return nil, err
+		}
+		follows = append(follows, f)
+	}
+	return follows, rows.Err()
+}
+
+// Feed item types in the order they're sorted when their times are equal
+var feedTypeRank = map[string]int{model.FeedAscent: 0, model.FeedAchievement: 1, model.FeedReport: 2}
+
+// feedBefore reports whether item a comes before (is newer than) b in the feed
+func feedBefore(a, b model.FeedCursor) bool {
+	if !a.At.Equal(b.At) {
+		return a.At.After(b.At)
+	}
+	if feedTypeRank[a.Type] != feedTypeRank[b.Type] {
+		return feedTypeRank[a.Type] > feedTypeRank[b.Type]
+	}
+	return a.ID > b.ID
+}
+
+// For a source of feed items of one type, the time and ID its items must
+// come strictly before to be after the cursor: items at the cursor's time
+// only qualify if their type sorts after the cursor's, or it's the same
+// type with a lower ID.
+func feedBound(after *model.FeedCursor, itemType string) (time.Time, int64) {
+	if after == nil {
+		return time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), 0
+	}
+	switch rank, cursorRank := feedTypeRank[itemType], feedTypeRank[after.Type]; {
+	case rank < cursorRank:
+		return after.At, math.MaxInt64
+	case rank == cursorRank:
+		return after.At, after.ID
+	default:
+		return after.At, 0
+	}
+}
+
+// ListFeed returns up to limit items from the people a user follows, newest
+// first, starting after the given cursor (nil for the first page). It also
+// reports whether there are more.
+//
+// Each kind of item is read separately, newest first and limited, and the
+// results merged, so a page costs three indexed queries however long the
+// feed.
+func (s *Store) ListFeed(userID int64, after *model.FeedCursor, limit int) ([]model.FeedItem, bool, error) {
+	var items []model.FeedItem
+
+	at, id := feedBound(after, model.FeedAscent)
+	rows, err := s.db.Query(
+		`SELECT `+ascentColumns+`, u.display_name FROM ascents a
+		 JOIN follows f ON f.followee_id = a.user_id AND f.follower_id = ?
+		 JOIN users u ON u.id = a.user_id
+		 WHERE a.visibility != ? AND (a.created_at < ? OR (a.created_at = ? AND a.id < ?))
+		 ORDER BY a.created_at DESC, a.id DESC LIMIT ?`,
+		userID, model.VisibilityPrivate, at, at, id, limit+1,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := scanFeed(rows, model.FeedAscent, &items); err != nil {
+		return nil, false, err
+	}
+
+	at, id = feedBound(after, model.FeedAchievement)
+	rows, err = s.db.Query(
+		`SELECT w.rowid, w.user_id, w.achievement_id, w.grp, w.awarded_at, w.created_at, u.display_name FROM awards w
+		 JOIN follows f ON f.followee_id = w.user_id AND f.follower_id = ?
+		 JOIN users u ON u.id = w.user_id
+		 WHERE w.visibility != ? AND (w.created_at < ? OR (w.created_at = ? AND w.rowid < ?))
+		 ORDER BY w.created_at DESC, w.rowid DESC LIMIT ?`,
+		userID, model.VisibilityPrivate, at, at, id, limit+1,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := scanFeed(rows, model.FeedAchievement, &items); err != nil {
+		return nil, false, err
+	}
+
+	at, id = feedBound(after, model.FeedReport)
+	reports, err := s.queryReports(
+		`SELECT `+reportColumns+reportFrom+`
+		 JOIN follows f ON f.followee_id = r.user_id AND f.follower_id = ?
+		 WHERE r.status = ? AND r.moderation = ?
+		   AND (r.published_at < ? OR (r.published_at = ? AND r.id < ?))
+		 ORDER BY r.published_at DESC, r.id DESC LIMIT ?`,
+		userID, model.ReportStatusPublished, model.ModerationApproved, at, at, id, limit+1,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range reports {
+		r := &reports[i]
+		items = append(items, model.FeedItem{
+			Type:        model.FeedReport,
+			ID:          r.ID,
+			UserID:      r.UserID,
+			DisplayName: r.AuthorName,
+			At:          *r.PublishedAt,
+			Report:      r,
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return feedBefore(
+			model.FeedCursor{At: items[i].At, Type: items[i].Type, ID: items[i].ID},
+			model.FeedCursor{At: items[j].At, Type: items[j].Type, ID: items[j].ID},
+		)
+	})
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	return items, more, nil
+}
+
+// Scan ascent or award rows into feed items
+func scanFeed(rows *sql.Rows, itemType string, items *[]model.FeedItem) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		item := model.FeedItem{Type: itemType}
+		switch itemType {
+		case model.FeedAscent:
+			a := &model.Ascent{}
+			if err := scanAscent(rows, a, &item.DisplayName); err != nil {
+				return err
+			}
+			item.ID, item.UserID, item.At, item.Ascent = a.ID, a.UserID, a.CreatedAt, a
+		case model.FeedAchievement:
+			w := &model.Award{}
+			if err := rows.Scan(&item.ID, &w.UserID, &w.AchievementID, &w.Group, &w.AwardedAt, &item.At, &item.DisplayName); err != nil {
+				return err
+			}
+			item.UserID, item.Award = w.UserID, w
+		}
+		*items = append(*items, item)
+	}
+	return rows.Err()
+}
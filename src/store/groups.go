@@ -0,0 +1,151 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+const groupColumns = `g.id, g.name, g.description, g.owner_id, g.join_code, g.created_at,
+	(SELECT COUNT(*) FROM group_members m WHERE m.group_id = g.id)`
+
+func scanGroup(row interface{ Scan(...any) error }) (*model.Group, error) {
+	var g model.Group
+	err := row.Scan(&g.ID, &g.Name, &g.Description, &g.OwnerID, &g.JoinCode, &g.CreatedAt, &g.MemberCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// CreateGroup creates a group with its owner as the first member
+func (s *Store) CreateGroup(group *model.Group) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	group.CreatedAt = time.Now().UTC()
+	res, err := tx.Exec(
+		`INSERT INTO groups (name, description, owner_id, join_code, created_at) VALUES (?, ?, ?, ?, ?)`,
+		group.Name, group.Description, group.OwnerID, group.JoinCode, group.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if group.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO group_members (group_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)`,
+		group.ID, group.OwnerID, model.GroupRoleOwner, group.CreatedAt,
+	); err != nil {
+		return err
+	}
+	group.MemberCount = 1
+
+	return tx.Commit()
+}
+
+func (s *Store) GetGroup(id int64) (*model.Group, error) {
+	return scanGroup(s.db.QueryRow(`SELECT `+groupColumns+` FROM groups g WHERE g.id = ?`, id))
+}
+
+func (s *Store) GetGroupByJoinCode(code string) (*model.Group, error) {
+	return scanGroup(s.db.QueryRow(`SELECT `+groupColumns+` FROM groups g WHERE g.join_code = ?`, code))
+}
+
+// ListUserGroups returns the groups a user belongs to
+func (s *Store) ListUserGroups(userID int64) ([]model.Group, error) {
+	rows, err := s.db.Query(
+		`SELECT `+groupColumns+` FROM groups g
+		 JOIN group_members gm ON gm.group_id = g.id
+		 WHERE gm.user_id = ? ORDER BY g.name`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []model.Group{}
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *g)
+	}
+	return groups, rows.Err()
+}
+
+// AddGroupMember adds a user to a group; joining twice is a no-op
+func (s *Store) AddGroupMember(groupID, userID int64) error {
+	_, err := s.db.Exec(
+		`INSERT OR IGNORE INTO group_members (group_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)`,
+		groupID, userID, model.GroupRoleMember, time.Now().UTC(),
+	)
+	return err
+}
+
+func (s *Store) RemoveGroupMember(groupID, userID int64) error {
+	res, err := s.db.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) IsGroupMember(groupID, userID int64) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID).Scan(&n)
+	return n > 0, err
+}
+
+func (s *Store) ListGroupMembers(groupID int64) ([]model.GroupMember, error) {
+	rows, err := s.db.Query(
+		`SELECT u.id, u.display_name, gm.role, gm.joined_at FROM group_members gm
+		 JOIN users u ON u.id = gm.user_id
+		 WHERE gm.group_id = ? ORDER BY gm.joined_at`,
+		groupID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []model.GroupMember{}
+	for rows.Next() {
+		var m model.GroupMember
+		if err := rows.Scan(&m.UserID, &m.DisplayName, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// ListGroupAscents returns every ascent logged by the group's members,
+// other than those they've kept private
+func (s *Store) ListGroupAscents(groupID int64) ([]model.Ascent, error) {
+	rows, err := s.db.Query(
+		`SELECT `+ascentColumns+` FROM ascents a
+		 JOIN group_members gm ON gm.user_id = a.user_id
+		 WHERE gm.group_id = ? AND a.visibility != ? ORDER BY a.climbed_at, a.id`,
+		groupID, model.VisibilityPrivate,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAscents(rows)
+}
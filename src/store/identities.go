@@ -0,0 +1,117 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// CreatePendingLogin records a sign-in sent to a provider, clearing out
+// any that were never completed
+func (s *Store) CreatePendingLogin(login *model.PendingLogin) error {
+	if _, err := s.db.Exec(`DELETE FROM pending_logins WHERE expires_at <= ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO pending_logins (state_hash, provider, nonce, verifier, next, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		login.StateHash, login.Provider, login.Nonce, login.Verifier, login.Next, login.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// TakePendingLogin returns and removes an unexpired pending sign-in, so
+// each state can only be used once
+func (s *Store) TakePendingLogin(stateHash string) (*model.PendingLogin, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	login := model.PendingLogin{StateHash: stateHash}
+	err = tx.QueryRow(
+		`SELECT provider, nonce, verifier, next, expires_at FROM pending_logins WHERE state_hash = ? AND expires_at > ?`,
+		stateHash, time.Now().UTC(),
+	).Scan(&login.Provider, &login.Nonce, &login.Verifier, &login.Next, &login.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM pending_logins WHERE state_hash = ?`, stateHash); err != nil {
+		return nil, err
+	}
+	return &login, tx.Commit()
+}
+
+// GetIdentityUser returns the user linked to a provider account
+func (s *Store) GetIdentityUser(provider, subject string) (*model.User, error) {
+	return scanUser(s.db.QueryRow(
+		`SELECT `+userColumns+`
+		 FROM user_identities i JOIN users u ON u.id = i.user_id
+		 WHERE i.provider = ? AND i.subject = ?`,
+		provider, subject,
+	))
+}
+
+// LinkIdentity links a provider account to a user
+func (s *Store) LinkIdentity(identity *model.Identity) error {
+	identity.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec(
+		`INSERT INTO user_identities (provider, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)`,
+		identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// ListIdentities returns the provider accounts linked to a user
+func (s *Store) ListIdentities(userID int64) ([]model.Identity, error) {
+	rows, err := s.db.Query(
+		`SELECT user_id, provider, subject, email, created_at FROM user_identities WHERE user_id = ? ORDER BY provider`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []model.Identity{}
+	for rows.Next() {
+		var i model.Identity
+		if err := rows.Scan(&i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+// RevokeCredentials removes a user's password and everything else that
+// lets someone act as them or receive their data: sessions, API keys,
+// webhooks (with their deliveries), the calendar feed token and emailed
+// links. It's for when someone else may have set them up.
+func (s *Store) RevokeCredentials(userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET password_hash = '' WHERE id = ?`, userID); err != nil {
+		return err
+	}
+	for _, table := range []string{"sessions", "api_keys", "webhooks", "calendar_tokens", "email_tokens"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
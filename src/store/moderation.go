@@ -0,0 +1,229 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Table holding each kind of moderated content
+var contentTables = map[string]string{
+	model.ContentReport:    "reports",
+	model.ContentPhoto:     "photos",
+	model.ContentCondition: "conditions",
+}
+
+// Status each moderator action leaves content in
+var actionStatus = map[string]string{
+	model.ActionApprove: model.ModerationApproved,
+	model.ActionReject:  model.ModerationRejected,
+	model.ActionHide:    model.ModerationHidden,
+}
+
+// ContentAuthor returns the user who posted a piece of content
+func (s *Store) ContentAuthor(contentType string, id int64) (int64, error) {
+	table, ok := contentTables[contentType]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	var userID int64
+	err := s.db.QueryRow(`SELECT user_id FROM `+table+` WHERE id = ?`, id).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
+
+// CountUserPostsSince counts the reports, photos and condition reports a
+// user has created since the given time
+func (s *Store) CountUserPostsSince(userID int64, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT (SELECT COUNT(*) FROM reports WHERE user_id = ?1 AND created_at >= ?2)
+		      + (SELECT COUNT(*) FROM photos WHERE user_id = ?1 AND created_at >= ?2)
+		      + (SELECT COUNT(*) FROM conditions WHERE user_id = ?1 AND created_at >= ?2)`,
+		userID, since.UTC(),
+	).Scan(&n)
+	return n, err
+}
+
+// CreateFlag records a user's report of some content. Flagging the same
+// content twice is a no-op.
+func (s *Store) CreateFlag(flag *model.Flag) error {
+	flag.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec(
+		`INSERT INTO flags (reporter_id, content_type, content_id, reason, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (reporter_id, content_type, content_id) DO NOTHING`,
+		flag.ReporterID, flag.ContentType, flag.ContentID, flag.Reason, flag.CreatedAt,
+	)
+	return err
+}
+
+// ListUserFlags returns the flags a user has raised
+func (s *Store) ListUserFlags(userID int64) ([]model.Flag, error) {
+	rows, err := s.db.Query(
+		`SELECT id, reporter_id, content_type, content_id, reason, created_at, resolved_at
+		 FROM flags WHERE reporter_id = ? ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []model.Flag{}
+	for rows.Next() {
+		var f model.Flag
+		if err := rows.Scan(&f.ID, &f.ReporterID, &f.ContentType, &f.ContentID, &f.Reason, &f.CreatedAt, &f.ResolvedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// ModerationQueue returns content that is pending review or has unresolved
+// flags, oldest first. Draft trip reports wait until they're published.
+func (s *Store) ModerationQueue() ([]model.QueueItem, error) {
+	const openFlags = `(SELECT COUNT(*) FROM flags f WHERE f.content_type = '%[1]s' AND f.content_id = %[2]s.id AND f.resolved_at IS NULL)`
+	const reasons = `(SELECT COALESCE(GROUP_CONCAT(f.reason, char(31)), '') FROM flags f WHERE f.content_type = '%[1]s' AND f.content_id = %[2]s.id AND f.resolved_at IS NULL)`
+	columns := func(contentType, alias string) string {
+		return fmt.Sprintf(reasons, contentType, alias) + ", " + fmt.Sprintf(openFlags, contentType, alias)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT * FROM (
+			SELECT 'report' AS content_type, r.id, r.user_id, u.display_name, 0, r.title, r.moderation AS moderation,
+				` + columns(model.ContentReport, "r") + ` AS flags, r.created_at AS created_at
+			FROM reports r JOIN users u ON u.id = r.user_id
+			WHERE r.status = 'published'
+			UNION ALL
+			SELECT 'photo', p.id, p.user_id, u.display_name, p.munro_id, p.caption, p.moderation, ` + columns(model.ContentPhoto, "p") + `, p.created_at
+			FROM photos p JOIN users u ON u.id = p.user_id
+			UNION ALL
+			SELECT 'condition', c.id, c.user_id, u.display_name, c.munro_id, c.notes, c.moderation, ` + columns(model.ContentCondition, "c") + `, c.created_at
+			FROM conditions c JOIN users u ON u.id = c.user_id
+		)
+		WHERE moderation = 'pending' OR flags > 0
+		ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queue := []model.QueueItem{}
+	for rows.Next() {
+		var item model.QueueItem
+		var reasons string
+		if err := rows.Scan(&item.ContentType, &item.ContentID, &item.AuthorID, &item.AuthorName, &item.MunroID,
+			&item.Summary, &item.Moderation, &reasons, &item.Flags, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		item.Reasons = []string{}
+		if reasons != "" {
+			item.Reasons = strings.Split(reasons, "\x1f")
+		}
+		queue = append(queue, item)
+	}
+	return queue, rows.Err()
+}
+
+// Moderate applies a moderator's action to some content, resolves any flags
+// on it and records the action in the audit log
+func (s *Store) Moderate(moderatorID int64, contentType string, id int64, action, note string) error {
+	table, ok := contentTables[contentType]
+	status, known := actionStatus[action]
+	if !ok || !known {
+		return ErrNotFound
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(`UPDATE `+table+` SET moderation = ? WHERE id = ?`, status, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE flags SET resolved_at = ? WHERE content_type = ? AND content_id = ? AND resolved_at IS NULL`,
+		now, contentType, id,
+	); err != nil {
+		return err
+	}
+
+	if err := logAction(tx, moderatorID, action, contentType, id, note, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetUserRoleAudited changes a user's role and records who did it
+func (s *Store) SetUserRoleAudited(moderatorID, userID int64, role string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if err := logAction(tx, moderatorID, model.ActionSetRole, model.ContentUser, userID, role, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func logAction(tx *sql.Tx, moderatorID int64, action, contentType string, id int64, note string, at time.Time) error {
+	_, err := tx.Exec(
+		`INSERT INTO moderation_actions (moderator_id, action, content_type, content_id, note, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		moderatorID, action, contentType, id, note, at,
+	)
+	return err
+}
+
+// ListModerationActions returns the most recent entries in the audit log
+func (s *Store) ListModerationActions(limit int) ([]model.ModerationAction, error) {
+	rows, err := s.db.Query(
+		`SELECT a.id, a.moderator_id, u.display_name, a.action, a.content_type, a.content_id, a.note, a.created_at
+		 FROM moderation_actions a JOIN users u ON u.id = a.moderator_id
+		 ORDER BY a.id DESC LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []model.ModerationAction{}
+	for rows.Next() {
+		var a model.ModerationAction
+		if err := rows.Scan(&a.ID, &a.ModeratorID, &a.ModeratorName, &a.Action, &a.ContentType, &a.ContentID,
+			&a.Note, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+const photoColumns = `p.id, p.user_id, u.display_name, p.munro_id, p.caption, p.moderation, p.blob_key, p.content_type,
+	p.width, p.height, p.latitude, p.longitude, p.taken_at, p.created_at`
+
+const photoFrom = ` FROM photos p JOIN users u ON u.id = p.user_id`
+
+func scanPhoto(row interface{ Scan(...any) error }) (*model.Photo, error) {
+	var p model.Photo
+	var lat, lon sql.NullFloat64
+	var takenAt sql.NullTime
+	err := row.Scan(&p.ID, &p.UserID, &p.AuthorName, &p.MunroID, &p.Caption, &p.Moderation, &p.BlobKey, &p.ContentType,
+		&p.Width, &p.Height, &lat, &lon, &takenAt, &p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lat.Valid && lon.Valid {
+		p.Latitude, p.Longitude = &lat.Float64, &lon.Float64
+	}
+	if takenAt.Valid {
+		p.TakenAt = &takenAt.Time
+	}
+	return &p, nil
+}
+
+func (s *Store) CreatePhoto(photo *model.Photo) error {
+	photo.CreatedAt = time.Now().UTC()
+	res, err := s.db.Exec(
+		`INSERT INTO photos (user_id, munro_id, caption, moderation, blob_key, content_type, width, height, latitude, longitude, taken_at, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		photo.UserID, photo.MunroID, photo.Caption, photo.Moderation, photo.BlobKey, photo.ContentType, photo.Width, photo.Height,
+		photo.Latitude, photo.Longitude, photo.TakenAt, photo.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	photo.ID, err = res.LastInsertId()
+	return err
+}
+
+// UpdatePhoto changes which hill a photo is of, its caption and moderation
+// status
+func (s *Store) UpdatePhoto(photo *model.Photo) error {
+	res, err := s.db.Exec(
+		`UPDATE photos SET munro_id = ?, caption = ?, moderation = ? WHERE id = ? AND user_id = ?`,
+		photo.MunroID, photo.Caption, photo.Moderation, photo.ID, photo.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) GetPhoto(id int64) (*model.Photo, error) {
+	return scanPhoto(s.db.QueryRow(`SELECT `+photoColumns+photoFrom+` WHERE p.id = ?`, id))
+}
+
+func (s *Store) queryPhotos(query string, args ...any) ([]model.Photo, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []model.Photo{}
+	for rows.Next() {
+		photo, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, *photo)
+	}
+	return photos, rows.Err()
+}
+
+// ListUserPhotos returns a user's photos, newest first
+func (s *Store) ListUserPhotos(userID int64) ([]model.Photo, error) {
+	return s.queryPhotos(`SELECT `+photoColumns+photoFrom+` WHERE p.user_id = ? ORDER BY p.created_at DESC`, userID)
+}
+
+// ListHillPhotos returns the approved photos of a hill, newest first
+func (s *Store) ListHillPhotos(munroID int) ([]model.Photo, error) {
+	return s.queryPhotos(
+		`SELECT `+photoColumns+photoFrom+` WHERE p.munro_id = ? AND p.moderation = ? ORDER BY p.created_at DESC`,
+		munroID, model.ModerationApproved,
+	)
+}
+
+func (s *Store) DeletePhoto(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM photos WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+const planColumns = `id, user_id, name, start_date, end_date, notes, share_token_hash IS NOT NULL, created_at, updated_at`
+
+func scanPlan(row interface{ Scan(...any) error }) (*model.Plan, error) {
+	var p model.Plan
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.StartDate, &p.EndDate, &p.Notes, &p.Shared, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) CreatePlan(plan *model.Plan) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	plan.CreatedAt = time.Now().UTC()
+	plan.UpdatedAt = plan.CreatedAt
+
+	res, err := tx.Exec(
+		`INSERT INTO plans (user_id, name, start_date, end_date, notes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		plan.UserID, plan.Name, plan.StartDate, plan.EndDate, plan.Notes, plan.CreatedAt, plan.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if plan.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	if err := insertPlanHills(tx, plan); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdatePlan replaces a plan's details and hill list
+func (s *Store) UpdatePlan(plan *model.Plan) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	plan.UpdatedAt = time.Now().UTC()
+
+	res, err := tx.Exec(
+		`UPDATE plans SET name = ?, start_date = ?, end_date = ?, notes = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		plan.Name, plan.StartDate, plan.EndDate, plan.Notes, plan.UpdatedAt, plan.ID, plan.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM plan_hills WHERE plan_id = ?`, plan.ID); err != nil {
+		return err
+	}
+	if err := insertPlanHills(tx, plan); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertPlanHills(tx *sql.Tx, plan *model.Plan) error {
+	for i, hill := range plan.Hills {
+		if _, err := tx.Exec(
+			`INSERT INTO plan_hills (plan_id, position, munro_id, notes) VALUES (?, ?, ?, ?)`,
+			plan.ID, i, hill.MunroID, hill.Notes,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) loadPlanHills(plan *model.Plan) error {
+	rows, err := s.db.Query(`SELECT munro_id, notes FROM plan_hills WHERE plan_id = ? ORDER BY position`, plan.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	plan.Hills = []model.PlanHill{}
+	for rows.Next() {
+		var hill model.PlanHill
+		if err := rows.Scan(&hill.MunroID, &hill.Notes); err != nil {
+			return err
+		}
+		plan.Hills = append(plan.Hills, hill)
+	}
+	return rows.Err()
+}
+
+// GetPlan returns one of a user's plans with its hills
+func (s *Store) GetPlan(userID, id int64) (*model.Plan, error) {
+	plan, err := scanPlan(s.db.QueryRow(`SELECT `+planColumns+` FROM plans WHERE id = ? AND user_id = ?`, id, userID))
+	if err != nil {
+		return nil, err
+	}
+	return plan, s.loadPlanHills(plan)
+}
+
+// GetSharedPlan returns the plan behind a share link, given its hashed token
+func (s *Store) GetSharedPlan(tokenHash string) (*model.Plan, error) {
+	plan, err := scanPlan(s.db.QueryRow(`SELECT `+planColumns+` FROM plans WHERE share_token_hash = ?`, tokenHash))
+	if err != nil {
+		return nil, err
+	}
+	return plan, s.loadPlanHills(plan)
+}
+
+// ListPlans returns a user's plans with their hills, soonest first
+func (s *Store) ListPlans(userID int64) ([]model.Plan, error) {
+	rows, err := s.db.Query(
+		`SELECT `+planColumns+` FROM plans WHERE user_id = ?
+		 ORDER BY start_date = '', start_date, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := []model.Plan{}
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		plans = append(plans, *plan)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range plans {
+		if err := s.loadPlanHills(&plans[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return plans, nil
+}
+
+func (s *Store) DeletePlan(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM plans WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetPlanShareToken sets (hashed) or, with an empty hash, revokes a plan's
+// share link
+func (s *Store) SetPlanShareToken(userID, id int64, tokenHash string) error {
+	var value any
+	if tokenHash != "" {
+		value = tokenHash
+	}
+
+	res, err := s.db.Exec(`UPDATE plans SET share_token_hash = ? WHERE id = ? AND user_id = ?`, value, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+const reportColumns = `r.id, r.user_id, u.display_name, r.title, r.body, r.status, r.moderation, r.climbed_on,
+	r.created_at, r.updated_at, r.published_at`
+
+const reportFrom = ` FROM reports r JOIN users u ON u.id = r.user_id`
+
+func scanReport(row interface{ Scan(...any) error }) (*model.Report, error) {
+	var r model.Report
+	var publishedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.UserID, &r.AuthorName, &r.Title, &r.Body, &r.Status, &r.Moderation, &r.ClimbedOn,
+		&r.CreatedAt, &r.UpdatedAt, &publishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if publishedAt.Valid {
+		r.PublishedAt = &publishedAt.Time
+	}
+	return &r, nil
+}
+
+// Set the publication time when a report is first published, and clear it
+// if the report goes back to being a draft
+func stampPublished(report *model.Report, now time.Time) {
+	switch {
+	case report.Status != model.ReportStatusPublished:
+		report.PublishedAt = nil
+	case report.PublishedAt == nil:
+		report.PublishedAt = &now
+	}
+}
+
+func (s *Store) CreateReport(report *model.Report) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	report.CreatedAt = time.Now().UTC()
+	report.UpdatedAt = report.CreatedAt
+	stampPublished(report, report.CreatedAt)
+
+	res, err := tx.Exec(
+		`INSERT INTO reports (user_id, title, body, status, moderation, climbed_on, created_at, updated_at, published_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		report.UserID, report.Title, report.Body, report.Status, report.Moderation, report.ClimbedOn,
+		report.CreatedAt, report.UpdatedAt, report.PublishedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if report.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	if err := insertReportHills(tx, report); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateReport replaces a report's content, status and hills. PublishedAt
+// should hold the stored value so that republishing keeps the original date.
+func (s *Store) UpdateReport(report *model.Report) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	report.UpdatedAt = time.Now().UTC()
+	stampPublished(report, report.UpdatedAt)
+
+	res, err := tx.Exec(
+		`UPDATE reports SET title = ?, body = ?, status = ?, moderation = ?, climbed_on = ?, updated_at = ?, published_at = ?
+		 WHERE id = ? AND user_id = ?`,
+		report.Title, report.Body, report.Status, report.Moderation, report.ClimbedOn, report.UpdatedAt, report.PublishedAt,
+		report.ID, report.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM report_hills WHERE report_id = ?`, report.ID); err != nil {
+		return err
+	}
+	if err := insertReportHills(tx, report); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertReportHills(tx *sql.Tx, report *model.Report) error {
+	for _, id := range report.MunroIDs {
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO report_hills (report_id, munro_id) VALUES (?, ?)`,
+			report.ID, id,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) loadReportHills(report *model.Report) error {
+	rows, err := s.db.Query(`SELECT munro_id FROM report_hills WHERE report_id = ? ORDER BY munro_id`, report.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	report.MunroIDs = []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		report.MunroIDs = append(report.MunroIDs, id)
+	}
+	return rows.Err()
+}
+
+// Run a report query and load each report's hills
+func (s *Store) queryReports(query string, args ...any) ([]model.Report, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []model.Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range reports {
+		if err := s.loadReportHills(&reports[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return reports, nil
+}
+
+// GetReport returns a report whatever its status; callers decide who may
+// see drafts
+func (s *Store) GetReport(id int64) (*model.Report, error) {
+	report, err := scanReport(s.db.QueryRow(`SELECT `+reportColumns+reportFrom+` WHERE r.id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return report, s.loadReportHills(report)
+}
+
+// ListUserReports returns all of a user's reports, drafts included, newest first
+func (s *Store) ListUserReports(userID int64) ([]model.Report, error) {
+	return s.queryReports(
+		`SELECT `+reportColumns+reportFrom+` WHERE r.user_id = ? ORDER BY r.updated_at DESC`,
+		userID,
+	)
+}
+
+// ListPublishedReports returns the most recently published approved reports
+func (s *Store) ListPublishedReports(limit int) ([]model.Report, error) {
+	return s.queryReports(
+		`SELECT `+reportColumns+reportFrom+` WHERE r.status = ? AND r.moderation = ?
+		 ORDER BY r.published_at DESC LIMIT ?`,
+		model.ReportStatusPublished, model.ModerationApproved, limit,
+	)
+}
+
+// ListHillReports returns the published approved reports about a hill,
+// newest first
+func (s *Store) ListHillReports(munroID int) ([]model.Report, error) {
+	return s.queryReports(
+		`SELECT `+reportColumns+reportFrom+`
+		 JOIN report_hills h ON h.report_id = r.id
+		 WHERE h.munro_id = ? AND r.status = ? AND r.moderation = ?
+		 ORDER BY r.published_at DESC`,
+		munroID, model.ReportStatusPublished, model.ModerationApproved,
+	)
+}
+
+func (s *Store) DeleteReport(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM reports WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// CreateSession stores a session for the given (already hashed) token
+func (s *Store) CreateSession(tokenHash string, userID int64, expiresAt time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		tokenHash, userID, expiresAt.UTC(),
+	)
+	return err
+}
+
+// GetSessionUser returns the user owning an unexpired session
+func (s *Store) GetSessionUser(tokenHash string) (*model.User, error) {
+	return scanUser(s.db.QueryRow(
+		`SELECT `+userColumns+`
+		 FROM sessions s JOIN users u ON u.id = s.user_id
+		 WHERE s.token_hash = ? AND s.expires_at > ?`,
+		tokenHash, time.Now().UTC(),
+	))
+}
+
+func (s *Store) DeleteSession(tokenHash string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+	return err
+}
@@ -0,0 +1,321 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// ErrNotFound is returned when a requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a row violates a uniqueness constraint
+var ErrConflict = errors.New("already exists")
+
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens (creating if needed) the SQLite database at path and applies
+// any outstanding migrations.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// DB exposes the underlying database handle
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// migrations are applied in order and tracked with PRAGMA user_version.
+// Only ever append to this list.
+var migrations = []string{
+	`CREATE TABLE users (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		email         TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		display_name  TEXT NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at    TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE sessions (
+		token_hash TEXT PRIMARY KEY,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		expires_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE ascents (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		munro_id   INTEGER NOT NULL,
+		climbed_at TIMESTAMP NOT NULL,
+		notes      TEXT NOT NULL DEFAULT '',
+		source     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX ascents_user ON ascents(user_id, climbed_at)`,
+	`CREATE TABLE plans (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name        TEXT NOT NULL,
+		start_date  TEXT NOT NULL DEFAULT '',
+		end_date    TEXT NOT NULL DEFAULT '',
+		notes       TEXT NOT NULL DEFAULT '',
+		share_token TEXT UNIQUE,
+		created_at  TIMESTAMP NOT NULL,
+		updated_at  TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE plan_hills (
+		plan_id  INTEGER NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		munro_id INTEGER NOT NULL,
+		notes    TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (plan_id, position)
+	)`,
+	`CREATE TABLE calendar_tokens (
+		user_id    INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE awards (
+		user_id        INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		achievement_id TEXT NOT NULL,
+		grp            TEXT NOT NULL DEFAULT '',
+		awarded_at     TIMESTAMP NOT NULL,
+		created_at     TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, achievement_id, grp)
+	)`,
+	`CREATE TABLE groups (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		owner_id    INTEGER NOT NULL REFERENCES users(id),
+		join_code   TEXT NOT NULL UNIQUE,
+		created_at  TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE group_members (
+		group_id  INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+		user_id   INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role      TEXT NOT NULL,
+		joined_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (group_id, user_id)
+	)`,
+	`CREATE TABLE reports (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		title        TEXT NOT NULL,
+		body         TEXT NOT NULL,
+		status       TEXT NOT NULL,
+		climbed_on   TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMP NOT NULL,
+		updated_at   TIMESTAMP NOT NULL,
+		published_at TIMESTAMP
+	)`,
+	`CREATE TABLE report_hills (
+		report_id INTEGER NOT NULL REFERENCES reports(id) ON DELETE CASCADE,
+		munro_id  INTEGER NOT NULL,
+		PRIMARY KEY (report_id, munro_id)
+	)`,
+	`CREATE INDEX report_hills_munro ON report_hills(munro_id)`,
+	`CREATE TABLE photos (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		munro_id     INTEGER NOT NULL,
+		caption      TEXT NOT NULL DEFAULT '',
+		blob_key     TEXT NOT NULL UNIQUE,
+		content_type TEXT NOT NULL,
+		width        INTEGER NOT NULL,
+		height       INTEGER NOT NULL,
+		latitude     REAL,
+		longitude    REAL,
+		taken_at     TIMESTAMP,
+		created_at   TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX photos_munro ON photos(munro_id, created_at)`,
+	`CREATE TABLE ratings (
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		munro_id   INTEGER NOT NULL,
+		scenery    INTEGER NOT NULL,
+		difficulty INTEGER NOT NULL,
+		navigation INTEGER NOT NULL,
+		bogginess  INTEGER NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, munro_id)
+	)`,
+	`CREATE INDEX ratings_munro ON ratings(munro_id)`,
+	`CREATE TABLE conditions (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id         INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		munro_id        INTEGER NOT NULL,
+		observed_on     TEXT NOT NULL,
+		snow_cover      TEXT NOT NULL DEFAULT '',
+		path            TEXT NOT NULL DEFAULT '',
+		river_crossings TEXT NOT NULL DEFAULT '',
+		notes           TEXT NOT NULL DEFAULT '',
+		created_at      TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX conditions_observed ON conditions(observed_on)`,
+	`CREATE INDEX conditions_munro ON conditions(munro_id, observed_on)`,
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`,
+	`ALTER TABLE reports ADD COLUMN moderation TEXT NOT NULL DEFAULT 'approved'`,
+	`ALTER TABLE photos ADD COLUMN moderation TEXT NOT NULL DEFAULT 'approved'`,
+	`ALTER TABLE conditions ADD COLUMN moderation TEXT NOT NULL DEFAULT 'approved'`,
+	`CREATE TABLE flags (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		reporter_id  INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		content_type TEXT NOT NULL,
+		content_id   INTEGER NOT NULL,
+		reason       TEXT NOT NULL,
+		created_at   TIMESTAMP NOT NULL,
+		resolved_at  TIMESTAMP,
+		UNIQUE (reporter_id, content_type, content_id)
+	)`,
+	`CREATE INDEX flags_content ON flags(content_type, content_id)`,
+	`CREATE TABLE moderation_actions (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		moderator_id INTEGER NOT NULL REFERENCES users(id),
+		action       TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		content_id   INTEGER NOT NULL,
+		note         TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE webhooks (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		url        TEXT NOT NULL,
+		secret     TEXT NOT NULL,
+		events     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE webhook_deliveries (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id      INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event           TEXT NOT NULL,
+		payload         TEXT NOT NULL,
+		status          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NOT NULL,
+		last_code       INTEGER NOT NULL DEFAULT 0,
+		last_error      TEXT NOT NULL DEFAULT '',
+		replay_of       INTEGER,
+		created_at      TIMESTAMP NOT NULL,
+		delivered_at    TIMESTAMP
+	)`,
+	`CREATE INDEX webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`,
+	`ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP`,
+	`CREATE TABLE user_identities (
+		provider   TEXT NOT NULL,
+		subject    TEXT NOT NULL,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		email      TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (provider, subject)
+	)`,
+	`CREATE TABLE pending_logins (
+		state_hash TEXT PRIMARY KEY,
+		provider   TEXT NOT NULL,
+		nonce      TEXT NOT NULL,
+		verifier   TEXT NOT NULL,
+		next       TEXT NOT NULL DEFAULT '',
+		expires_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE api_keys (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id         INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name            TEXT NOT NULL,
+		prefix          TEXT NOT NULL,
+		key_hash        TEXT NOT NULL UNIQUE,
+		scopes          TEXT NOT NULL,
+		rate_per_minute INTEGER NOT NULL,
+		burst           INTEGER NOT NULL,
+		created_at      TIMESTAMP NOT NULL,
+		last_used_at    TIMESTAMP
+	)`,
+	`CREATE TABLE api_key_usage (
+		key_id   INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+		day      TEXT NOT NULL,
+		requests INTEGER NOT NULL DEFAULT 0,
+		limited  INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (key_id, day)
+	)`,
+	`ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP`,
+	`ALTER TABLE users ADD COLUMN weekly_digest INTEGER NOT NULL DEFAULT 1`,
+	`ALTER TABLE users ADD COLUMN trip_alerts INTEGER NOT NULL DEFAULT 1`,
+	`CREATE TABLE email_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		purpose    TEXT NOT NULL,
+		email      TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE email_log (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		kind    TEXT NOT NULL,
+		ref     TEXT NOT NULL,
+		sent_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (user_id, kind, ref)
+	)`,
+	`ALTER TABLE ascents ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'`,
+	`CREATE TABLE follows (
+		follower_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		followee_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at  TIMESTAMP NOT NULL,
+		PRIMARY KEY (follower_id, followee_id)
+	)`,
+	`CREATE INDEX follows_followee ON follows(followee_id)`,
+	// Share tokens are stored hashed from here on, like session and calendar
+	// tokens. Existing ones can't be hashed in SQL, so those links are
+	// revoked and have to be made again.
+	`UPDATE plans SET share_token = NULL`,
+	`ALTER TABLE plans RENAME COLUMN share_token TO share_token_hash`,
+	// Awards are only as visible as the ascents that earned them. Existing
+	// ones stay private until their holder's achievements are next evaluated.
+	`ALTER TABLE awards ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private'`,
+}
+
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
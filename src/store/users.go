@@ -0,0 +1,217 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (s *Store) CreateUser(user *model.User) error {
+	user.CreatedAt = time.Now().UTC()
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+	var verifiedAt *time.Time
+	if user.EmailVerified {
+		verifiedAt = &user.CreatedAt
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO users (email, display_name, password_hash, role, created_at, email_verified_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		user.Email, user.DisplayName, user.PasswordHash, user.Role, user.CreatedAt, verifiedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrConflict
+		}
+		return err
+	}
+
+	user.ID, err = res.LastInsertId()
+	return err
+}
+
+// Columns read by scanUser, from the users table aliased as u
+const userColumns = `u.id, u.email, u.display_name, u.password_hash, u.role, u.created_at, u.email_verified_at IS NOT NULL`
+
+func scanUser(row interface{ Scan(...any) error }) (*model.User, error) {
+	var user model.User
+	err := row.Scan(&user.ID, &user.Email, &user.DisplayName, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.EmailVerified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *Store) GetUser(id int64) (*model.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users u WHERE u.id = ?`, id))
+}
+
+func (s *Store) GetUserByEmail(email string) (*model.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users u WHERE u.email = ?`, email))
+}
+
+func (s *Store) SetUserRole(id int64, role string) error {
+	res, err := s.db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeletedUserName replaces the name of a deleted user wherever their
+// anonymised history is still shown
+const DeletedUserName = "Deleted user"
+
+// Tables of personal data that are removed outright when a user is deleted.
+// Rows in child tables (plan hills, report hills, webhook deliveries) go
+// with their parents.
+var personalTables = []struct{ table, column string }{
+	{"sessions", "user_id"},
+	{"user_identities", "user_id"},
+	{"calendar_tokens", "user_id"},
+	{"plans", "user_id"},
+	{"awards", "user_id"},
+	{"reports", "user_id"},
+	{"photos", "user_id"},
+	{"ratings", "user_id"},
+	{"conditions", "user_id"},
+	{"flags", "reporter_id"},
+	{"webhooks", "user_id"},
+	{"api_keys", "user_id"},
+	{"email_tokens", "user_id"},
+	{"email_log", "user_id"},
+	{"follows", "follower_id"},
+	{"follows", "followee_id"},
+}
+
+// DeleteUser erases a user's account and everything they've posted. What
+// other people's records depend on is kept but anonymised: the user row
+// remains as a nameless tombstone, so their ascents still count towards
+// group leaderboards and first-to-bag records, and moderator actions stay
+// in the audit log. Groups they own pass to their longest-standing member.
+//
+// It returns the deleted photos so the caller can remove their files.
+func (s *Store) DeleteUser(userID int64) ([]model.Photo, error) {
+	photos, err := s.ListUserPhotos(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := handOverGroups(tx, userID); err != nil {
+		return nil, err
+	}
+
+	// Flags raised against the user's content would point at nothing
+	if _, err := tx.Exec(
+		`DELETE FROM flags WHERE
+		    (content_type = ? AND content_id IN (SELECT id FROM reports WHERE user_id = ?))
+		 OR (content_type = ? AND content_id IN (SELECT id FROM photos WHERE user_id = ?))
+		 OR (content_type = ? AND content_id IN (SELECT id FROM conditions WHERE user_id = ?))
+		 OR (content_type = ? AND content_id = ?)`,
+		model.ContentReport, userID, model.ContentPhoto, userID, model.ContentCondition, userID, model.ContentUser, userID,
+	); err != nil {
+		return nil, err
+	}
+
+	for _, t := range personalTables {
+		if _, err := tx.Exec(`DELETE FROM `+t.table+` WHERE `+t.column+` = ?`, userID); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", t.table, err)
+		}
+	}
+
+	// Ascents are kept for the leaderboards, without the user's own words
+	if _, err := tx.Exec(`UPDATE ascents SET notes = '' WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec(
+		`UPDATE users SET email = 'deleted-' || id || '@deleted.invalid', display_name = ?, password_hash = '',
+		   role = ?, email_verified_at = NULL, deleted_at = ?
+		 WHERE id = ? AND deleted_at IS NULL`,
+		DeletedUserName, model.RoleUser, time.Now().UTC(), userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+
+	return photos, tx.Commit()
+}
+
+// Give each group the user owns to its longest-standing other member, or
+// delete it if there's nobody left
+func handOverGroups(tx *sql.Tx, userID int64) error {
+	rows, err := tx.Query(`SELECT id FROM groups WHERE owner_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	var groupIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		groupIDs = append(groupIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, groupID := range groupIDs {
+		var successor int64
+		err := tx.QueryRow(
+			`SELECT user_id FROM group_members WHERE group_id = ? AND user_id != ?
+			 ORDER BY joined_at, user_id LIMIT 1`,
+			groupID, userID,
+		).Scan(&successor)
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, err := tx.Exec(`DELETE FROM groups WHERE id = ?`, groupID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE groups SET owner_id = ? WHERE id = ?`, successor, groupID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`UPDATE group_members SET role = CASE user_id WHEN ? THEN ? ELSE ? END
+			 WHERE group_id = ? AND user_id IN (?, ?)`,
+			successor, model.GroupRoleOwner, model.GroupRoleMember, groupID, successor, userID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
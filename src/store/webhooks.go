@@ -0,0 +1,190 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+const webhookColumns = `w.id, w.user_id, w.url, w.secret, w.events, w.created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }) (*model.Webhook, error) {
+	var w model.Webhook
+	var events string
+	err := row.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, &events, &w.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	w.Events = strings.Split(events, ",")
+	return &w, nil
+}
+
+func (s *Store) queryWebhooks(query string, args ...any) ([]model.Webhook, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *Store) CreateWebhook(w *model.Webhook) error {
+	w.CreatedAt = time.Now().UTC()
+	res, err := s.db.Exec(
+		`INSERT INTO webhooks (user_id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)`,
+		w.UserID, w.URL, w.Secret, strings.Join(w.Events, ","), w.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	w.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetWebhook returns one of a user's webhooks, including its secret
+func (s *Store) GetWebhook(userID, id int64) (*model.Webhook, error) {
+	return scanWebhook(s.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks w WHERE w.id = ? AND w.user_id = ?`, id, userID))
+}
+
+// GetWebhookByID returns a webhook whoever owns it, for sending deliveries
+func (s *Store) GetWebhookByID(id int64) (*model.Webhook, error) {
+	return scanWebhook(s.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks w WHERE w.id = ?`, id))
+}
+
+func (s *Store) ListWebhooks(userID int64) ([]model.Webhook, error) {
+	return s.queryWebhooks(`SELECT `+webhookColumns+` FROM webhooks w WHERE w.user_id = ? ORDER BY w.id`, userID)
+}
+
+// ListSubscribedWebhooks returns the webhooks that should receive an event
+// about the given user: the user's own, and every admin's. Events that
+// aren't about a user (userID 0) go to everyone subscribed.
+func (s *Store) ListSubscribedWebhooks(event string, userID int64) ([]model.Webhook, error) {
+	return s.queryWebhooks(
+		`SELECT `+webhookColumns+` FROM webhooks w JOIN users u ON u.id = w.user_id
+		 WHERE (',' || w.events || ',') LIKE ('%,' || ? || ',%')
+		   AND (? = 0 OR w.user_id = ? OR u.role = ?)`,
+		event, userID, userID, model.RoleAdmin,
+	)
+}
+
+func (s *Store) DeleteWebhook(userID, id int64) error {
+	res, err := s.db.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, last_code, last_error,
+	replay_of, created_at, delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }) (*model.Delivery, error) {
+	var d model.Delivery
+	var replayOf sql.NullInt64
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastCode, &d.LastError, &replayOf, &d.CreatedAt, &deliveredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if replayOf.Valid {
+		d.ReplayOf = &replayOf.Int64
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+func (s *Store) queryDeliveries(query string, args ...any) ([]model.Delivery, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// CreateDelivery queues a delivery to be sent straight away
+func (s *Store) CreateDelivery(d *model.Delivery) error {
+	d.CreatedAt = time.Now().UTC()
+	d.NextAttemptAt = d.CreatedAt
+	d.Status = model.DeliveryPending
+	res, err := s.db.Exec(
+		`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, replay_of, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.WebhookID, d.Event, d.Payload, d.Status, d.NextAttemptAt, d.ReplayOf, d.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	d.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetDelivery returns a delivery made to one of a user's webhooks
+func (s *Store) GetDelivery(userID, webhookID, id int64) (*model.Delivery, error) {
+	return scanDelivery(s.db.QueryRow(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		 WHERE id = ? AND webhook_id = (SELECT id FROM webhooks WHERE id = ? AND user_id = ?)`,
+		id, webhookID, userID,
+	))
+}
+
+// ListDeliveries returns a webhook's most recent deliveries
+func (s *Store) ListDeliveries(webhookID int64, limit int) ([]model.Delivery, error) {
+	return s.queryDeliveries(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`,
+		webhookID, limit,
+	)
+}
+
+// DueDeliveries returns pending deliveries whose next attempt is due
+func (s *Store) DueDeliveries(now time.Time, limit int) ([]model.Delivery, error) {
+	return s.queryDeliveries(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		 WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?`,
+		model.DeliveryPending, now.UTC(), limit,
+	)
+}
+
+// RecordAttempt stores the outcome of sending a delivery
+func (s *Store) RecordAttempt(d *model.Delivery) error {
+	_, err := s.db.Exec(
+		`UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_code = ?, last_error = ?,
+		   delivered_at = ?
+		 WHERE id = ?`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.LastCode, d.LastError, d.DeliveredAt, d.ID,
+	)
+	return err
+}
@@ -0,0 +1,57 @@
+package sun
+
+import (
+	"math"
+	"time"
+)
+
+// Sunrise and sunset using the sunrise equation, accurate to a few minutes
+// at Scottish latitudes. See https://en.wikipedia.org/wiki/Sunrise_equation
+
+const (
+	j2000     = 2451545.0
+	unixEpoch = 2440587.5 // Julian date of 1970-01-01T00:00:00Z
+)
+
+func sinDeg(d float64) float64 { return math.Sin(d * math.Pi / 180) }
+func cosDeg(d float64) float64 { return math.Cos(d * math.Pi / 180) }
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + unixEpoch
+}
+
+func fromJulian(j float64) time.Time {
+	return time.Unix(int64(math.Round((j-unixEpoch)*86400)), 0).UTC()
+}
+
+// Times returns sunrise and sunset on the given date for an observer at
+// lat/lon (degrees, east positive) standing elevation metres above sea level.
+// Higher observers see the sun earlier and later thanks to the dip of the
+// horizon. ok is false when the sun doesn't rise or set that day.
+func Times(date time.Time, lat, lon, elevation float64) (sunrise, sunset time.Time, ok bool) {
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+
+	// Days since J2000, itself noon UTC, so a whole number for noon. (The
+	// usual ceil(JD - 2451545 + 0.0008) is for a JD at midnight; applied to
+	// noon it gives the next day.)
+	n := math.Round(toJulian(noon) - j2000)
+	meanSolarTime := n - lon/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*sinDeg(anomaly) + 0.0200*sinDeg(2*anomaly) + 0.0003*sinDeg(3*anomaly)
+	eclipticLon := math.Mod(anomaly+center+180+102.9372, 360)
+
+	transit := j2000 + meanSolarTime + 0.0053*sinDeg(anomaly) - 0.0069*sinDeg(2*eclipticLon)
+
+	sinDecl := sinDeg(eclipticLon) * sinDeg(23.4397)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+
+	altitude := -0.833 - 2.076*math.Sqrt(math.Max(0, elevation))/60
+	cosHourAngle := (sinDeg(altitude) - sinDeg(lat)*sinDecl) / (cosDeg(lat) * cosDecl)
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360), true
+}
@@ -0,0 +1,60 @@
+package sun
+
+import (
+	"testing"
+	"time"
+)
+
+// Ben Nevis
+const (
+	benNevisLat    = 56.7969
+	benNevisLon    = -5.0036
+	benNevisHeight = 1345
+)
+
+func TestTimesBenNevis(t *testing.T) {
+	// Expected times are from NOAA's solar calculator, in UTC
+	tests := []struct {
+		date            string
+		elevation       float64
+		sunrise, sunset string
+	}{
+		{"2024-03-20", 0, "2024-03-20T06:21:00Z", "2024-03-20T18:35:00Z"},
+		{"2024-03-20", benNevisHeight, "2024-03-20T06:12:00Z", "2024-03-20T18:44:00Z"},
+		{"2024-06-21", 0, "2024-06-21T03:27:00Z", "2024-06-21T21:17:00Z"},
+		{"2024-06-21", benNevisHeight, "2024-06-21T03:12:00Z", "2024-06-21T21:31:00Z"},
+		{"2024-12-21", 0, "2024-12-21T08:55:00Z", "2024-12-21T15:41:00Z"},
+		{"2024-12-21", benNevisHeight, "2024-12-21T08:43:00Z", "2024-12-21T15:54:00Z"},
+		{"2025-09-01", benNevisHeight, "2025-09-01T05:13:00Z", "2025-09-01T19:25:00Z"},
+	}
+
+	// The sunrise equation takes the declination at noon, so near the
+	// equinoxes, when it changes fastest, it can be a couple of minutes out
+	const tolerance = 3 * time.Minute
+
+	for _, tt := range tests {
+		date, _ := time.Parse(time.DateOnly, tt.date)
+		wantRise, _ := time.Parse(time.RFC3339, tt.sunrise)
+		wantSet, _ := time.Parse(time.RFC3339, tt.sunset)
+
+		sunrise, sunset, ok := Times(date, benNevisLat, benNevisLon, tt.elevation)
+		if !ok {
+			t.Errorf("%s at %gm: no sunrise or sunset", tt.date, tt.elevation)
+			continue
+		}
+		if d := sunrise.Sub(wantRise).Abs(); d > tolerance {
+			t.Errorf("%s at %gm: sunrise %s, want %s", tt.date, tt.elevation, sunrise.Format(time.RFC3339), tt.sunrise)
+		}
+		if d := sunset.Sub(wantSet).Abs(); d > tolerance {
+			t.Errorf("%s at %gm: sunset %s, want %s", tt.date, tt.elevation, sunset.Format(time.RFC3339), tt.sunset)
+		}
+	}
+}
+
+func TestTimesPolarDay(t *testing.T) {
+	// Svalbard in midsummer: the sun never sets
+	date := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	if _, _, ok := Times(date, 78.2, 15.6, 0); ok {
+		t.Error("Times reported a sunrise and sunset during the polar day")
+	}
+}
@@ -0,0 +1,221 @@
+package track
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Minimal decoder for Garmin FIT activity files. Only "record" messages are
+// interpreted; everything else is skipped using its definition.
+
+const (
+	fitMesgRecord = 20
+
+	fitFieldTimestamp        = 253
+	fitFieldPositionLat      = 0
+	fitFieldPositionLong     = 1
+	fitFieldAltitude         = 2
+	fitFieldEnhancedAltitude = 78
+
+	fitInvalidSint32 = 0x7FFFFFFF
+	fitInvalidUint32 = 0xFFFFFFFF
+	fitInvalidUint16 = 0xFFFF
+)
+
+// FIT timestamps count seconds from 1989-12-31T00:00:00Z
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var errFITTruncated = errors.New("unexpected end of FIT data")
+
+type fitField struct {
+	num  byte
+	size int
+}
+
+type fitDefinition struct {
+	global   uint16
+	order    binary.ByteOrder
+	fields   []fitField
+	devBytes int
+}
+
+func parseFIT(data []byte) ([]Point, error) {
+	if len(data) < 12 {
+		return nil, errFITTruncated
+	}
+
+	headerSize := int(data[0])
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	if headerSize < 12 || headerSize+dataSize > len(data) {
+		return nil, errFITTruncated
+	}
+
+	buf := data[headerSize : headerSize+dataSize]
+	defs := map[byte]*fitDefinition{}
+	var points []Point
+	var lastTimestamp uint32
+
+	for pos := 0; pos < len(buf); {
+		header := buf[pos]
+		pos++
+
+		// Compressed timestamp header: always a data message
+		if header&0x80 != 0 {
+			local := (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			timestamp := (lastTimestamp &^ 0x1F) + offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			lastTimestamp = timestamp
+
+			def := defs[local]
+			if def == nil {
+				return nil, fmt.Errorf("FIT data for undefined local message %d", local)
+			}
+			n, pt, ok, err := readFITData(buf[pos:], def, &lastTimestamp, true)
+			if err != nil {
+				return nil, err
+			}
+			pos += n
+			if ok {
+				points = append(points, pt)
+			}
+			continue
+		}
+
+		local := header & 0x0F
+
+		// Definition message
+		if header&0x40 != 0 {
+			def, n, err := readFITDefinition(buf[pos:], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			defs[local] = def
+			pos += n
+			continue
+		}
+
+		def := defs[local]
+		if def == nil {
+			return nil, fmt.Errorf("FIT data for undefined local message %d", local)
+		}
+		n, pt, ok, err := readFITData(buf[pos:], def, &lastTimestamp, false)
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		if ok {
+			points = append(points, pt)
+		}
+	}
+
+	return points, nil
+}
+
+func readFITDefinition(buf []byte, hasDevFields bool) (*fitDefinition, int, error) {
+	if len(buf) < 5 {
+		return nil, 0, errFITTruncated
+	}
+
+	def := &fitDefinition{order: binary.LittleEndian}
+	if buf[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(buf[2:4])
+
+	numFields := int(buf[4])
+	pos := 5
+	if len(buf) < pos+numFields*3 {
+		return nil, 0, errFITTruncated
+	}
+	for i := 0; i < numFields; i++ {
+		def.fields = append(def.fields, fitField{num: buf[pos], size: int(buf[pos+1])})
+		pos += 3
+	}
+
+	if hasDevFields {
+		if len(buf) < pos+1 {
+			return nil, 0, errFITTruncated
+		}
+		numDev := int(buf[pos])
+		pos++
+		if len(buf) < pos+numDev*3 {
+			return nil, 0, errFITTruncated
+		}
+		for i := 0; i < numDev; i++ {
+			def.devBytes += int(buf[pos+1])
+			pos += 3
+		}
+	}
+
+	return def, pos, nil
+}
+
+// readFITData consumes one data message, returning the bytes read and, for
+// record messages with a valid position, the decoded point.
+func readFITData(buf []byte, def *fitDefinition, lastTimestamp *uint32, compressed bool) (int, Point, bool, error) {
+	var pt Point
+	var hasLat, hasLon bool
+	timestamp := *lastTimestamp
+	pos := 0
+
+	for _, f := range def.fields {
+		if len(buf) < pos+f.size {
+			return 0, pt, false, errFITTruncated
+		}
+		raw := buf[pos : pos+f.size]
+		pos += f.size
+
+		switch {
+		case f.num == fitFieldTimestamp && f.size == 4:
+			if v := def.order.Uint32(raw); v != fitInvalidUint32 {
+				timestamp = v
+				*lastTimestamp = v
+			}
+		case def.global != fitMesgRecord:
+			// Only the timestamp matters outside record messages
+		case f.num == fitFieldPositionLat && f.size == 4:
+			if v := def.order.Uint32(raw); v != fitInvalidSint32 {
+				pt.Lat = semicirclesToDegrees(int32(v))
+				hasLat = true
+			}
+		case f.num == fitFieldPositionLong && f.size == 4:
+			if v := def.order.Uint32(raw); v != fitInvalidSint32 {
+				pt.Lon = semicirclesToDegrees(int32(v))
+				hasLon = true
+			}
+		case f.num == fitFieldAltitude && f.size == 2:
+			if v := def.order.Uint16(raw); v != fitInvalidUint16 {
+				pt.Ele = float64(v)/5 - 500
+			}
+		case f.num == fitFieldEnhancedAltitude && f.size == 4:
+			if v := def.order.Uint32(raw); v != fitInvalidUint32 {
+				pt.Ele = float64(v)/5 - 500
+			}
+		}
+	}
+
+	if len(buf) < pos+def.devBytes {
+		return 0, pt, false, errFITTruncated
+	}
+	pos += def.devBytes
+
+	if def.global != fitMesgRecord || !hasLat || !hasLon {
+		return pos, pt, false, nil
+	}
+
+	if timestamp != 0 || compressed {
+		pt.Time = fitEpoch.Add(time.Duration(timestamp) * time.Second)
+	}
+
+	return pos, pt, true, nil
+}
+
+func semicirclesToDegrees(v int32) float64 {
+	return float64(v) * (180 / math.Pow(2, 31))
+}
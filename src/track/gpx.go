@@ -0,0 +1,116 @@
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Routes []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Ele  float64 `xml:"ele"`
+	Time string  `xml:"time"`
+}
+
+func (p gpxPoint) point() Point {
+	pt := Point{Lat: p.Lat, Lon: p.Lon, Ele: p.Ele}
+	if t, err := time.Parse(time.RFC3339, p.Time); err == nil {
+		pt.Time = t
+	}
+	return pt
+}
+
+func parseGPX(data []byte) ([]Point, error) {
+	var file gpxFile
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	for _, trk := range file.Tracks {
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				points = append(points, p.point())
+			}
+		}
+	}
+
+	// Fall back to routes for files without recorded tracks
+	if len(points) == 0 {
+		for _, rte := range file.Routes {
+			for _, p := range rte.Points {
+				points = append(points, p.point())
+			}
+		}
+	}
+
+	return points, nil
+}
+
+// Waypoint is a named point written to an exported GPX file
+type Waypoint struct {
+	Name string
+	Desc string
+	Lat  float64
+	Lon  float64
+	Ele  float64
+}
+
+type gpxOutWaypoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Ele  float64 `xml:"ele"`
+	Name string  `xml:"name"`
+	Desc string  `xml:"desc,omitempty"`
+}
+
+type gpxOut struct {
+	XMLName   xml.Name         `xml:"gpx"`
+	Version   string           `xml:"version,attr"`
+	Creator   string           `xml:"creator,attr"`
+	Namespace string           `xml:"xmlns,attr"`
+	Name      string           `xml:"metadata>name"`
+	Waypoints []gpxOutWaypoint `xml:"wpt"`
+	Route     struct {
+		Name   string           `xml:"name"`
+		Points []gpxOutWaypoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+// WriteGPX writes the waypoints as a GPX 1.1 file, both as individual
+// waypoints and as a route visiting them in order.
+func WriteGPX(w io.Writer, name string, waypoints []Waypoint) error {
+	out := gpxOut{
+		Version:   "1.1",
+		Creator:   "MunroMark",
+		Namespace: "http://www.topografix.com/GPX/1/1",
+		Name:      name,
+	}
+	out.Route.Name = name
+
+	for _, wp := range waypoints {
+		pt := gpxOutWaypoint{Lat: wp.Lat, Lon: wp.Lon, Ele: wp.Ele, Name: wp.Name, Desc: wp.Desc}
+		out.Waypoints = append(out.Waypoints, pt)
+		out.Route.Points = append(out.Route.Points, pt)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,140 @@
+package track
+
+import (
+	"sort"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/geo"
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// DefaultSummitRadius is how close (in metres) a track must pass to a summit
+// for it to count as reached
+const DefaultSummitRadius = 75.0
+
+// MaxSummitRadius caps user-supplied radii so a track can't claim a whole range
+const MaxSummitRadius = 500.0
+
+// MaxSegmentLength is the longest gap in metres between consecutive points
+// that is searched for summits. Longer ones are breaks in the recording,
+// such as lost signal or a device switched off between walks, and searching
+// them would mean scanning whole regions of the catalogue.
+const MaxSegmentLength = 5000.0
+
+// Summit is a catalogue hill reached by a track
+type Summit struct {
+	Munro model.Munro `json:"munro"`
+	// Distance in metres from the summit at closest approach
+	Distance float64 `json:"distance_m"`
+	// Time of closest approach, interpolated between track points.
+	// Nil when the track has no timestamps.
+	Time *time.Time `json:"time"`
+}
+
+// SummitIndex is a spatial index over the catalogue
+type SummitIndex struct {
+	munros []model.Munro
+	index  *geo.Index
+}
+
+func NewSummitIndex(munros []model.Munro) *SummitIndex {
+	lats := make([]float64, len(munros))
+	lons := make([]float64, len(munros))
+	for i, m := range munros {
+		lats[i] = m.Latitude
+		lons[i] = m.Longitude
+	}
+
+	return &SummitIndex{munros: munros, index: geo.NewIndex(lats, lons)}
+}
+
+// DetectSummits returns every hill the track passed within radius metres of,
+// in the order they were reached. Segments longer than MaxSegmentLength are
+// skipped, though the points at either end still count.
+func (s *SummitIndex) DetectSummits(points []Point, radius float64) []Summit {
+	type closest struct {
+		dist float64
+		time time.Time
+		seq  float64 // position along the track, for ordering
+	}
+	best := map[int]*closest{}
+
+	consider := func(i int, dist float64, t time.Time, seq float64) {
+		if dist > radius {
+			return
+		}
+		if c, ok := best[i]; !ok || dist < c.dist {
+			best[i] = &closest{dist: dist, time: t, seq: seq}
+		}
+	}
+
+	considerPoint := func(n int) {
+		p := points[n]
+		for _, i := range s.index.Within(p.Lat, p.Lon, radius) {
+			consider(i, geo.Distance(p.Lat, p.Lon, s.munros[i].Latitude, s.munros[i].Longitude), p.Time, float64(n))
+		}
+	}
+
+	if len(points) == 1 {
+		considerPoint(0)
+	}
+
+	for n := 1; n < len(points); n++ {
+		a, b := points[n-1], points[n]
+		length := geo.Distance(a.Lat, a.Lon, b.Lat, b.Lon)
+		if length > MaxSegmentLength {
+			considerPoint(n - 1)
+			considerPoint(n)
+			continue
+		}
+
+		// Search around the segment midpoint, widened to cover its length
+		midLat, midLon := (a.Lat+b.Lat)/2, (a.Lon+b.Lon)/2
+		halfLength := length / 2
+
+		for _, i := range s.index.Within(midLat, midLon, radius+halfLength) {
+			m := s.munros[i]
+			t, dist := geo.ClosestOnSegment(m.Latitude, m.Longitude, a.Lat, a.Lon, b.Lat, b.Lon)
+			consider(i, dist, interpolateTime(a.Time, b.Time, t), float64(n-1)+t)
+		}
+	}
+
+	indices := make([]int, 0, len(best))
+	for i := range best {
+		indices = append(indices, i)
+	}
+	sort.Slice(indices, func(x, y int) bool { return best[indices[x]].seq < best[indices[y]].seq })
+
+	summits := make([]Summit, 0, len(indices))
+	for _, i := range indices {
+		summit := Summit{Munro: s.munros[i], Distance: best[i].dist}
+		if t := best[i].time; !t.IsZero() {
+			summit.Time = &t
+		}
+		summits = append(summits, summit)
+	}
+
+	return summits
+}
+
+// Near returns the hills within radius metres of a single point, closest
+// first, e.g. to suggest which hill a photo was taken on
+func (s *SummitIndex) Near(lat, lon, radius float64) []Summit {
+	summits := []Summit{}
+	for _, i := range s.index.Within(lat, lon, radius) {
+		m := s.munros[i]
+		summits = append(summits, Summit{Munro: m, Distance: geo.Distance(lat, lon, m.Latitude, m.Longitude)})
+	}
+	sort.Slice(summits, func(x, y int) bool { return summits[x].Distance < summits[y].Distance })
+	return summits
+}
+
+func interpolateTime(a, b time.Time, t float64) time.Time {
+	switch {
+	case a.IsZero():
+		return b
+	case b.IsZero():
+		return a
+	}
+	return a.Add(time.Duration(float64(b.Sub(a)) * t)).Round(time.Second)
+}
@@ -0,0 +1,70 @@
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Laps []struct {
+			Tracks []struct {
+				Points []tcxPoint `xml:"Trackpoint"`
+			} `xml:"Track"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+	Courses []struct {
+		Tracks []struct {
+			Points []tcxPoint `xml:"Trackpoint"`
+		} `xml:"Track"`
+	} `xml:"Courses>Course"`
+}
+
+type tcxPoint struct {
+	Time     string `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lon float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Altitude float64 `xml:"AltitudeMeters"`
+}
+
+func parseTCX(data []byte) ([]Point, error) {
+	var file tcxFile
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	add := func(p tcxPoint) {
+		// Trackpoints without a position only carry heart rate etc.
+		if p.Position == nil {
+			return
+		}
+		pt := Point{Lat: p.Position.Lat, Lon: p.Position.Lon, Ele: p.Altitude}
+		if t, err := time.Parse(time.RFC3339, p.Time); err == nil {
+			pt.Time = t
+		}
+		points = append(points, pt)
+	}
+
+	for _, activity := range file.Activities {
+		for _, lap := range activity.Laps {
+			for _, trk := range lap.Tracks {
+				for _, p := range trk.Points {
+					add(p)
+				}
+			}
+		}
+	}
+	for _, course := range file.Courses {
+		for _, trk := range course.Tracks {
+			for _, p := range trk.Points {
+				add(p)
+			}
+		}
+	}
+
+	return points, nil
+}
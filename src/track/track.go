@@ -0,0 +1,107 @@
+package track
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Point is a single recorded position. Time is zero when the file did not
+// include timestamps (e.g. a planned route exported as GPX).
+type Point struct {
+	Lat  float64
+	Lon  float64
+	Ele  float64
+	Time time.Time
+}
+
+// Supported formats
+const (
+	FormatGPX = "gpx"
+	FormatTCX = "tcx"
+	FormatFIT = "fit"
+)
+
+var ErrUnknownFormat = errors.New("unrecognised track format")
+
+// DetectFormat works out the file format from its contents, falling back to
+// the file name extension.
+func DetectFormat(data []byte, filename string) (string, error) {
+	if len(data) >= 12 && string(data[8:12]) == ".FIT" {
+		return FormatFIT, nil
+	}
+
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	switch {
+	case bytes.Contains(head, []byte("<gpx")):
+		return FormatGPX, nil
+	case bytes.Contains(head, []byte("<TrainingCenterDatabase")):
+		return FormatTCX, nil
+	}
+
+	switch ext := strings.ToLower(filename); {
+	case strings.HasSuffix(ext, ".gpx"):
+		return FormatGPX, nil
+	case strings.HasSuffix(ext, ".tcx"):
+		return FormatTCX, nil
+	case strings.HasSuffix(ext, ".fit"):
+		return FormatFIT, nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+// Track is a parsed track file
+type Track struct {
+	Format string
+	Points []Point
+}
+
+// Parse reads a GPX, TCX or FIT file
+func Parse(r io.Reader, filename string) (*Track, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read track: %w", err)
+	}
+
+	format, err := DetectFormat(data, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	switch format {
+	case FormatGPX:
+		points, err = parseGPX(data)
+	case FormatTCX:
+		points, err = parseTCX(data)
+	case FormatFIT:
+		points, err = parseFIT(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s track: %w", format, err)
+	}
+
+	if len(points) == 0 {
+		return nil, fmt.Errorf("%s track contains no positions", format)
+	}
+	for i, p := range points {
+		if !validPosition(p.Lat, p.Lon) {
+			return nil, fmt.Errorf("%s track point %d is not a position on Earth: %g,%g", format, i+1, p.Lat, p.Lon)
+		}
+	}
+
+	return &Track{Format: format, Points: points}, nil
+}
+
+// Latitudes run from -90 to 90 and longitudes from -180 to 180; anything
+// else, including NaN, is a corrupt or hostile file
+func validPosition(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
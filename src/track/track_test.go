@@ -0,0 +1,338 @@
+package track
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+)
+
+// Up Ben Nevis by the tourist path and on to Carn Mor Dearg
+var walk = []Point{
+	{Lat: 56.8010, Lon: -5.0800, Ele: 300, Time: time.Date(2024, 6, 21, 8, 0, 0, 0, time.UTC)},
+	{Lat: 56.7969, Lon: -5.0036, Ele: 1345, Time: time.Date(2024, 6, 21, 11, 0, 0, 0, time.UTC)},
+	{Lat: 56.8051, Lon: -4.9878, Ele: 1220, Time: time.Date(2024, 6, 21, 13, 0, 0, 0, time.UTC)},
+}
+
+var testMunros = []model.Munro{
+	{DoBIHNumber: 1, Name: "Ben Nevis", Latitude: 56.7969, Longitude: -5.0036},
+	{DoBIHNumber: 21, Name: "Carn Mor Dearg", Latitude: 56.8051, Longitude: -4.9878},
+	{DoBIHNumber: 1010, Name: "Ben Macdui", Latitude: 57.0704, Longitude: -3.6691},
+}
+
+func checkPoints(t *testing.T, got []Point, timed bool) {
+	t.Helper()
+
+	if len(got) != len(walk) {
+		t.Fatalf("%d points, want %d", len(got), len(walk))
+	}
+	for i, p := range got {
+		want := walk[i]
+		if math.Abs(p.Lat-want.Lat) > 1e-6 || math.Abs(p.Lon-want.Lon) > 1e-6 || math.Abs(p.Ele-want.Ele) > 0.5 {
+			t.Errorf("point %d = %+v, want %+v", i, p, want)
+		}
+		if timed && !p.Time.Equal(want.Time) {
+			t.Errorf("point %d at %v, want %v", i, p.Time, want.Time)
+		}
+		if !timed && !p.Time.IsZero() {
+			t.Errorf("point %d has time %v, want none", i, p.Time)
+		}
+	}
+}
+
+func gpxFixture(points []Point) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><gpx version="1.1" creator="test"><trk><trkseg>`)
+	for _, p := range points {
+		fmt.Fprintf(&b, `<trkpt lat="%g" lon="%g"><ele>%g</ele><time>%s</time></trkpt>`, p.Lat, p.Lon, p.Ele, p.Time.Format(time.RFC3339))
+	}
+	b.WriteString(`</trkseg></trk></gpx>`)
+	return b.String()
+}
+
+func TestParseGPX(t *testing.T) {
+	trk, err := Parse(strings.NewReader(gpxFixture(walk)), "walk.gpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Format != FormatGPX {
+		t.Errorf("format %q", trk.Format)
+	}
+	checkPoints(t, trk.Points, true)
+}
+
+func TestParseGPXRoute(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`<gpx><rte>`)
+	for _, p := range walk {
+		fmt.Fprintf(&b, `<rtept lat="%g" lon="%g"><ele>%g</ele></rtept>`, p.Lat, p.Lon, p.Ele)
+	}
+	b.WriteString(`</rte></gpx>`)
+
+	trk, err := Parse(strings.NewReader(b.String()), "route.gpx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPoints(t, trk.Points, false)
+}
+
+func TestParseTCX(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><TrainingCenterDatabase><Activities><Activity><Lap><Track>`)
+	// A trackpoint with only a heart rate is skipped
+	b.WriteString(`<Trackpoint><Time>2024-06-21T07:59:00Z</Time></Trackpoint>`)
+	for _, p := range walk {
+		fmt.Fprintf(&b, `<Trackpoint><Time>%s</Time><Position><LatitudeDegrees>%g</LatitudeDegrees><LongitudeDegrees>%g</LongitudeDegrees></Position><AltitudeMeters>%g</AltitudeMeters></Trackpoint>`,
+			p.Time.Format(time.RFC3339), p.Lat, p.Lon, p.Ele)
+	}
+	b.WriteString(`</Track></Lap></Activity></Activities></TrainingCenterDatabase>`)
+
+	trk, err := Parse(strings.NewReader(b.String()), "walk.tcx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Format != FormatTCX {
+		t.Errorf("format %q", trk.Format)
+	}
+	checkPoints(t, trk.Points, true)
+}
+
+// fitWriter builds FIT files message by message
+type fitWriter struct {
+	buf bytes.Buffer
+}
+
+func semicircles(deg float64) uint32 {
+	return uint32(int32(math.Round(deg * math.Pow(2, 31) / 180)))
+}
+
+func fitAltitude(ele float64) uint16 {
+	return uint16(math.Round((ele + 500) * 5))
+}
+
+// A little-endian definition of local message local as global, with
+// fields of the given numbers and sizes, and devBytes of developer data
+func (f *fitWriter) define(local byte, global uint16, devBytes int, fields ...[2]byte) {
+	header := 0x40 | local
+	if devBytes > 0 {
+		header |= 0x20
+	}
+	f.buf.WriteByte(header)
+	f.buf.Write([]byte{0, 0})
+	f.buf.Write(binary.LittleEndian.AppendUint16(nil, global))
+	f.buf.WriteByte(byte(len(fields)))
+	for _, field := range fields {
+		f.buf.Write([]byte{field[0], field[1], 0})
+	}
+	if devBytes > 0 {
+		f.buf.Write([]byte{1, 0, byte(devBytes), 0})
+	}
+}
+
+func (f *fitWriter) data(header byte, values ...any) {
+	f.buf.WriteByte(header)
+	for _, v := range values {
+		binary.Write(&f.buf, binary.LittleEndian, v)
+	}
+}
+
+// The file, with a 14-byte header
+func (f *fitWriter) bytes() []byte {
+	b := []byte{14, 0x10, 0, 0}
+	b = binary.LittleEndian.AppendUint32(b, uint32(f.buf.Len()))
+	b = append(b, ".FIT"...)
+	b = append(b, 0, 0)
+	return append(b, f.buf.Bytes()...)
+}
+
+func fitTimestamp(t time.Time) uint32 {
+	return uint32(t.Sub(fitEpoch) / time.Second)
+}
+
+var (
+	fitFieldsTimed = [][2]byte{{fitFieldTimestamp, 4}, {fitFieldPositionLat, 4}, {fitFieldPositionLong, 4}, {fitFieldAltitude, 2}}
+	fitFieldsPlain = [][2]byte{{fitFieldPositionLat, 4}, {fitFieldPositionLong, 4}, {fitFieldAltitude, 2}}
+)
+
+func TestParseFIT(t *testing.T) {
+	var f fitWriter
+	// A file_id message, which is skipped
+	f.define(1, 0, 0, [2]byte{4, 4})
+	f.data(0x01, uint32(1234))
+	f.define(0, fitMesgRecord, 0, fitFieldsTimed...)
+	for _, p := range walk {
+		f.data(0x00, fitTimestamp(p.Time), semicircles(p.Lat), semicircles(p.Lon), fitAltitude(p.Ele))
+	}
+	// A record without a position, e.g. while the GPS has no fix
+	f.data(0x00, fitTimestamp(walk[2].Time.Add(time.Second)), uint32(fitInvalidSint32), uint32(fitInvalidSint32), fitAltitude(0))
+
+	trk, err := Parse(bytes.NewReader(f.bytes()), "walk.fit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trk.Format != FormatFIT {
+		t.Errorf("format %q", trk.Format)
+	}
+	checkPoints(t, trk.Points, true)
+}
+
+// Records with compressed timestamp headers carry a 5-bit offset from the
+// last full timestamp, and developer fields are skipped
+func TestParseFITCompressedTimestamps(t *testing.T) {
+	start := walk[0].Time
+	var f fitWriter
+	f.define(0, fitMesgRecord, 0, fitFieldsTimed...)
+	f.define(1, fitMesgRecord, 3, fitFieldsPlain...)
+	f.data(0x00, fitTimestamp(start), semicircles(walk[0].Lat), semicircles(walk[0].Lon), fitAltitude(walk[0].Ele))
+
+	offset := byte(fitTimestamp(start) & 0x1F)
+	// 20 seconds later, and then 40, wrapping the offset
+	for i, p := range walk[1:] {
+		seconds := byte(20 * (i + 1))
+		f.data(0x80|1<<5|(offset+seconds)&0x1F, semicircles(p.Lat), semicircles(p.Lon), fitAltitude(p.Ele), []byte{0xAA, 0xBB, 0xCC})
+	}
+
+	trk, err := Parse(bytes.NewReader(f.bytes()), "walk.fit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trk.Points) != 3 {
+		t.Fatalf("%d points, want 3", len(trk.Points))
+	}
+	for i, p := range trk.Points {
+		if want := start.Add(time.Duration(20*i) * time.Second); !p.Time.Equal(want) {
+			t.Errorf("point %d at %v, want %v", i, p.Time, want)
+		}
+		if math.Abs(p.Lat-walk[i].Lat) > 1e-6 || math.Abs(p.Lon-walk[i].Lon) > 1e-6 {
+			t.Errorf("point %d at %f,%f, want %f,%f", i, p.Lat, p.Lon, walk[i].Lat, walk[i].Lon)
+		}
+	}
+}
+
+func TestParseFITRejectsMalformed(t *testing.T) {
+	record := func() *fitWriter {
+		var f fitWriter
+		f.define(0, fitMesgRecord, 0, fitFieldsTimed...)
+		f.data(0x00, fitTimestamp(walk[0].Time), semicircles(walk[0].Lat), semicircles(walk[0].Lon), fitAltitude(walk[0].Ele))
+		return &f
+	}
+
+	whole := record().bytes()
+	undefined := record()
+	undefined.data(0x03, uint32(1))
+	compressedUndefined := record()
+	compressedUndefined.data(0x80|2<<5, uint32(1))
+	// The last record ends early, inside the stated data size
+	cutShort := append([]byte{}, whole[:len(whole)-3]...)
+	binary.LittleEndian.PutUint32(cutShort[4:8], uint32(len(cutShort)-14))
+	longDefinition := []byte{14, 0x10, 0, 0, 6, 0, 0, 0, '.', 'F', 'I', 'T', 0, 0, 0x40, 0, 0, 20, 0, 200}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"header only", whole[:12]},
+		{"data size past the end", whole[:len(whole)-1]},
+		{"message cut short", cutShort},
+		{"undefined local message", undefined.bytes()},
+		{"compressed header for an undefined local message", compressedUndefined.bytes()},
+		{"definition with more fields than the file holds", longDefinition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(bytes.NewReader(tt.data), "walk.fit"); err == nil {
+				t.Error("Parse succeeded")
+			}
+		})
+	}
+}
+
+func TestParseRejectsImpossiblePositions(t *testing.T) {
+	far := func(lat, lon float64) []Point {
+		return []Point{walk[0], {Lat: lat, Lon: lon, Time: walk[1].Time}}
+	}
+
+	var fit fitWriter
+	fit.define(0, fitMesgRecord, 0, fitFieldsPlain...)
+	fit.data(0x00, semicircles(walk[0].Lat), semicircles(walk[0].Lon), fitAltitude(0))
+	// Semicircles can describe latitudes up to 180°
+	fit.data(0x00, uint32(0x7FFFFFF0), semicircles(walk[0].Lon), fitAltitude(0))
+
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+	}{
+		{"latitude over 90", "walk.gpx", gpxFixture(far(91, -5))},
+		{"latitude under -90", "walk.gpx", gpxFixture(far(-90.5, -5))},
+		{"longitude over 180", "walk.gpx", gpxFixture(far(56.8, 180.1))},
+		{"longitude under -180", "walk.gpx", gpxFixture(far(56.8, -1e9))},
+		{"not a number", "walk.gpx", `<gpx><trk><trkseg><trkpt lat="NaN" lon="-5"/></trkseg></trk></gpx>`},
+		{"infinite", "walk.gpx", `<gpx><trk><trkseg><trkpt lat="56.8" lon="-Inf"/></trkseg></trk></gpx>`},
+		{"TCX latitude", "walk.tcx", `<TrainingCenterDatabase><Activities><Activity><Lap><Track><Trackpoint><Position><LatitudeDegrees>100</LatitudeDegrees><LongitudeDegrees>-5</LongitudeDegrees></Position></Trackpoint></Track></Lap></Activity></Activities></TrainingCenterDatabase>`},
+		{"FIT latitude", "walk.fit", string(fit.bytes())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if trk, err := Parse(strings.NewReader(tt.data), tt.filename); err == nil {
+				t.Errorf("Parse succeeded with %+v", trk.Points)
+			}
+		})
+	}
+}
+
+func summitNames(summits []Summit) []string {
+	var names []string
+	for _, s := range summits {
+		names = append(names, s.Munro.Name)
+	}
+	return names
+}
+
+func TestDetectSummits(t *testing.T) {
+	index := NewSummitIndex(testMunros)
+
+	summits := index.DetectSummits(walk, DefaultSummitRadius)
+	if got := summitNames(summits); len(got) != 2 || got[0] != "Ben Nevis" || got[1] != "Carn Mor Dearg" {
+		t.Fatalf("summits %q, want Ben Nevis then Carn Mor Dearg", got)
+	}
+	if summits[0].Time == nil || !summits[0].Time.Equal(walk[1].Time) {
+		t.Errorf("Ben Nevis reached at %v, want %v", summits[0].Time, walk[1].Time)
+	}
+
+	// Passing between two points still counts, with the time interpolated
+	past := []Point{
+		{Lat: 57.0704, Lon: -3.6791, Time: walk[0].Time},
+		{Lat: 57.0704, Lon: -3.6591, Time: walk[0].Time.Add(time.Hour)},
+	}
+	summits = index.DetectSummits(past, DefaultSummitRadius)
+	if len(summits) != 1 || summits[0].Munro.Name != "Ben Macdui" || !summits[0].Time.Equal(walk[0].Time.Add(30*time.Minute)) {
+		t.Errorf("summits %+v, want Ben Macdui half way", summits)
+	}
+}
+
+// A jump between points far apart is a gap in the recording, not a walk
+// over everything in between; only its ends are checked
+func TestDetectSummitsSkipsLongSegments(t *testing.T) {
+	index := NewSummitIndex(testMunros)
+
+	jump := []Point{
+		{Lat: 56.7969, Lon: -5.2036},
+		{Lat: 56.7969, Lon: -4.8036},
+	}
+	if summits := index.DetectSummits(jump, DefaultSummitRadius); len(summits) != 0 {
+		t.Errorf("summits %q across a 24km gap, want none", summitNames(summits))
+	}
+
+	jump = []Point{walk[1], {Lat: -45, Lon: 170}, {Lat: 45, Lon: -170}}
+	if got := summitNames(index.DetectSummits(jump, DefaultSummitRadius)); len(got) != 1 || got[0] != "Ben Nevis" {
+		t.Errorf("summits %q, want Ben Nevis at the start of the gap", got)
+	}
+}
@@ -55,7 +55,7 @@ func Layout(title, description string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\"><!-- Fonts --><link rel=\"preconnect\" href=\"https://fonts.googleapis.com\"><link rel=\"preconnect\" href=\"https://fonts.gstatic.com\" crossorigin><link href=\"https://fonts.googleapis.com/css2?family=Inter:ital,opsz,wght@0,14..32,100..900;1,14..32,100..900&display=swap\" rel=\"stylesheet\"><!-- Leaflet CSS --><link rel=\"stylesheet\" href=\"https://unpkg.com/leaflet@1.7.1/dist/leaflet.css\"><!-- Tailwind CSS --><script src=\"https://cdn.tailwindcss.com\"></script><script>\n\t\t\t\ttailwind.config = {\n\t\t\t\t\ttheme: {\n\t\t\t\t\t\textend: {\n\t\t\t\t\t\t\tfontFamily: {\n\t\t\t\t\t\t\t\tsans: [\n\t\t\t\t\t\t\t\t\t\"Inter\",\n\t\t\t\t\t\t\t\t\t\"ui-sans-serif\",\n\t\t\t\t\t\t\t\t\t\"system-ui\",\n\t\t\t\t\t\t\t\t\t\"sans-serif\",\n\t\t\t\t\t\t\t\t\t\"Apple Color Emoji\",\n\t\t\t\t\t\t\t\t\t\"Segoe UI Emoji\",\n\t\t\t\t\t\t\t\t\t\"Segoe UI Symbol\",\n\t\t\t\t\t\t\t\t\t\"Noto Color Emoji\",\n\t\t\t\t\t\t\t\t],\n\t\t\t\t\t\t\t},\n\t\t\t\t\t\t},\n\t\t\t\t\t},\n\t\t\t\t};\n\t\t\t</script><!-- HTMX --><script src=\"https://unpkg.com/htmx.org@1.9.10\"></script><!-- Leaflet JS --><script src=\"https://unpkg.com/leaflet@1.7.1/dist/leaflet.js\"></script><style>\n\t\t\t\thtml,\n\t\t\t\tbody {\n\t\t\t\t\tbackground-color: #f9fafb;\n\t\t\t\t}\n\n\t\t\t\t.leaflet-popup-content-wrapper {\n\t\t\t\t\tborder-radius: 0.5rem;\n\t\t\t\t}\n\n\t\t\t\t.leaflet-popup-tip {\n\t\t\t\t\tbackground: white;\n\t\t\t\t}\n\n\t\t\t\t.hero-overlay {\n\t\t\t\t\tbackdrop-filter: blur(16px);\n\t\t\t\t\tbackground-color: rgba(255, 255, 255, 0.8);\n\t\t\t\t}\n\n\t\t\t\t@keyframes spin {\n\t\t\t\t\tfrom {\n\t\t\t\t\t\ttransform: rotate(0deg);\n\t\t\t\t\t}\n\t\t\t\t\tto {\n\t\t\t\t\t\ttransform: rotate(360deg);\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\t.animate-spin {\n\t\t\t\t\tanimation: spin 1s linear infinite;\n\t\t\t\t}\n\n\t\t\t\t/* Landing page video styles */\n\t\t\t\t.video-background {\n\t\t\t\t\tposition: absolute;\n\t\t\t\t\ttop: 0;\n\t\t\t\t\tleft: 0;\n\t\t\t\t\twidth: 100%;\n\t\t\t\t\theight: 100%;\n\t\t\t\t\tobject-fit: cover;\n\t\t\t\t\tz-index: -2;\n\t\t\t\t}\n\n\t\t\t\t.video-overlay {\n\t\t\t\t\tposition: absolute;\n\t\t\t\t\ttop: 0;\n\t\t\t\t\tleft: 0;\n\t\t\t\t\twidth: 100%;\n\t\t\t\t\theight: 100%;\n\t\t\t\t\tbackground: rgba(0, 0, 0, 0.4);\n\t\t\t\t\tz-index: -1;\n\t\t\t\t}\n\n\t\t\t\t/* Smooth animations for landing page elements */\n\t\t\t\t@keyframes fadeInUp {\n\t\t\t\t\tfrom {\n\t\t\t\t\t\topacity: 0;\n\t\t\t\t\t\ttransform: translateY(30px);\n\t\t\t\t\t}\n\t\t\t\t\tto {\n\t\t\t\t\t\topacity: 1;\n\t\t\t\t\t\ttransform: translateY(0);\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\t.fade-in-up {\n\t\t\t\t\tanimation: fadeInUp 0.8s ease-out;\n\t\t\t\t}\n\n\t\t\t\t.fade-in-up-delayed {\n\t\t\t\t\tanimation: fadeInUp 0.8s ease-out 0.2s both;\n\t\t\t\t}\n\n\t\t\t\t/* Button hover effects */\n\t\t\t\t.btn-hover-scale {\n\t\t\t\t\ttransition: transform 0.3s ease, box-shadow 0.3s ease;\n\t\t\t\t}\n\n\t\t\t\t.btn-hover-scale:hover {\n\t\t\t\t\ttransform: translateY(-2px);\n\t\t\t\t\tbox-shadow: 0 20px 40px rgba(0, 0, 0, 0.2);\n\t\t\t\t}\n\t\t\t</style></head><body class=\"w-full h-screen bg-gray-50\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\"><!-- Fonts --><link rel=\"preconnect\" href=\"https://fonts.googleapis.com\"><link rel=\"preconnect\" href=\"https://fonts.gstatic.com\" crossorigin><link href=\"https://fonts.googleapis.com/css2?family=Inter:ital,opsz,wght@0,14..32,100..900;1,14..32,100..900&display=swap\" rel=\"stylesheet\"><!-- Leaflet CSS --><link rel=\"stylesheet\" href=\"https://unpkg.com/leaflet@1.7.1/dist/leaflet.css\"><!-- Tailwind CSS --><script src=\"https://cdn.tailwindcss.com\"></script><script>\n\t\t\t\ttailwind.config = {\n\t\t\t\t\ttheme: {\n\t\t\t\t\t\textend: {\n\t\t\t\t\t\t\tfontFamily: {\n\t\t\t\t\t\t\t\tsans: [\n\t\t\t\t\t\t\t\t\t\"Inter\",\n\t\t\t\t\t\t\t\t\t\"ui-sans-serif\",\n\t\t\t\t\t\t\t\t\t\"system-ui\",\n\t\t\t\t\t\t\t\t\t\"sans-serif\",\n\t\t\t\t\t\t\t\t\t\"Apple Color Emoji\",\n\t\t\t\t\t\t\t\t\t\"Segoe UI Emoji\",\n\t\t\t\t\t\t\t\t\t\"Segoe UI Symbol\",\n\t\t\t\t\t\t\t\t\t\"Noto Color Emoji\",\n\t\t\t\t\t\t\t\t],\n\t\t\t\t\t\t\t},\n\t\t\t\t\t\t},\n\t\t\t\t\t},\n\t\t\t\t};\n\t\t\t</script><!-- HTMX --><script src=\"/htmx/htmx.min.js\"></script><!-- Leaflet JS --><script src=\"https://unpkg.com/leaflet@1.7.1/dist/leaflet.js\"></script><style>\n\t\t\t\thtml,\n\t\t\t\tbody {\n\t\t\t\t\tbackground-color: #f9fafb;\n\t\t\t\t}\n\n\t\t\t\t.leaflet-popup-content-wrapper {\n\t\t\t\t\tborder-radius: 0.5rem;\n\t\t\t\t}\n\n\t\t\t\t.leaflet-popup-tip {\n\t\t\t\t\tbackground: white;\n\t\t\t\t}\n\n\t\t\t\t.hero-overlay {\n\t\t\t\t\tbackdrop-filter: blur(16px);\n\t\t\t\t\tbackground-color: rgba(255, 255, 255, 0.8);\n\t\t\t\t}\n\n\t\t\t\t@keyframes spin {\n\t\t\t\t\tfrom {\n\t\t\t\t\t\ttransform: rotate(0deg);\n\t\t\t\t\t}\n\t\t\t\t\tto {\n\t\t\t\t\t\ttransform: rotate(360deg);\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\t.animate-spin {\n\t\t\t\t\tanimation: spin 1s linear infinite;\n\t\t\t\t}\n\n\t\t\t\t/* Landing page video styles */\n\t\t\t\t.video-background {\n\t\t\t\t\tposition: absolute;\n\t\t\t\t\ttop: 0;\n\t\t\t\t\tleft: 0;\n\t\t\t\t\twidth: 100%;\n\t\t\t\t\theight: 100%;\n\t\t\t\t\tobject-fit: cover;\n\t\t\t\t\tz-index: -2;\n\t\t\t\t}\n\n\t\t\t\t.video-overlay {\n\t\t\t\t\tposition: absolute;\n\t\t\t\t\ttop: 0;\n\t\t\t\t\tleft: 0;\n\t\t\t\t\twidth: 100%;\n\t\t\t\t\theight: 100%;\n\t\t\t\t\tbackground: rgba(0, 0, 0, 0.4);\n\t\t\t\t\tz-index: -1;\n\t\t\t\t}\n\n\t\t\t\t/* Smooth animations for landing page elements */\n\t\t\t\t@keyframes fadeInUp {\n\t\t\t\t\tfrom {\n\t\t\t\t\t\topacity: 0;\n\t\t\t\t\t\ttransform: translateY(30px);\n\t\t\t\t\t}\n\t\t\t\t\tto {\n\t\t\t\t\t\topacity: 1;\n\t\t\t\t\t\ttransform: translateY(0);\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\t.fade-in-up {\n\t\t\t\t\tanimation: fadeInUp 0.8s ease-out;\n\t\t\t\t}\n\n\t\t\t\t.fade-in-up-delayed {\n\t\t\t\t\tanimation: fadeInUp 0.8s ease-out 0.2s both;\n\t\t\t\t}\n\n\t\t\t\t/* Button hover effects */\n\t\t\t\t.btn-hover-scale {\n\t\t\t\t\ttransition: transform 0.3s ease, box-shadow 0.3s ease;\n\t\t\t\t}\n\n\t\t\t\t.btn-hover-scale:hover {\n\t\t\t\t\ttransform: translateY(-2px);\n\t\t\t\t\tbox-shadow: 0 20px 40px rgba(0, 0, 0, 0.2);\n\t\t\t\t}\n\t\t\t</style></head><body class=\"w-full h-screen bg-gray-50\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+// ErrForbiddenAddress is returned for webhook URLs that reach this server's
+// own network rather than the internet
+var ErrForbiddenAddress = errors.New("webhooks can't be sent to local or private addresses")
+
+// Whether deliveries may be sent to ip. Loopback, link-local, private and
+// unspecified addresses would let users make the server probe the network
+// it runs on, e.g. a cloud metadata service.
+func allowedIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified()
+}
+
+// CheckURL resolves a webhook URL's host and returns ErrForbiddenAddress if
+// any of its addresses may not be sent to. It's checked again when each
+// delivery connects, since the host can resolve differently by then.
+func CheckURL(ctx context.Context, u *url.URL) error {
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !allowedIP(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("can't resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !allowedIP(ip) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// A dialer Control hook refusing connections to forbidden addresses. It
+// sees the address actually being connected to, after DNS resolution, so
+// a host can't pass CheckURL and then be pointed somewhere local.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !allowedIP(addr.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr.Addr())
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+// Package webhooks sends signed event notifications to registered URLs,
+// retrying failed deliveries with exponential backoff
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+// Events a webhook can subscribe to
+const (
+	EventDatasetReloaded = "dataset.reloaded"
+	EventAscentLogged    = "ascent.logged"
+	EventCompleation     = "compleation.achieved"
+	EventReportPublished = "report.published"
+)
+
+var Events = []string{EventDatasetReloaded, EventAscentLogged, EventCompleation, EventReportPublished}
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it's marked failed
+	MaxAttempts = 8
+	// The first retry waits this long, doubling each time after
+	baseBackoff = 30 * time.Second
+	// How often to look for due deliveries when nothing new has been queued
+	pollInterval = 5 * time.Second
+	batchSize    = 20
+)
+
+// Headers sent with each delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret.
+const (
+	HeaderEvent     = "X-MunroMark-Event"
+	HeaderDelivery  = "X-MunroMark-Delivery"
+	HeaderTimestamp = "X-MunroMark-Timestamp"
+	HeaderSignature = "X-MunroMark-Signature"
+)
+
+// Envelope is the JSON body of every delivery
+type Envelope struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// Dispatcher queues events in the database and delivers them in the
+// background, so deliveries survive a restart
+type Dispatcher struct {
+	store  *store.Store
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewDispatcher(s *store.Store) *Dispatcher {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: checkDial}
+	return &Dispatcher{
+		store: s,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// No proxy, so the dialer checks the endpoint's own address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Sign returns the signature header value for a delivery body
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish queues an event for every webhook subscribed to it. userID is
+// the user the event is about, or 0 for site-wide events.
+func (d *Dispatcher) Publish(event string, userID int64, data any) error {
+	return d.PublishVisible(event, userID, data, data)
+}
+
+// PublishVisible is Publish for events that may carry data only userID
+// should see. Their own webhooks receive data; anyone else's, such as an
+// admin's, receive public instead, or nothing if public is nil.
+func (d *Dispatcher) PublishVisible(event string, userID int64, data, public any) error {
+	hooks, err := d.store.ListSubscribedWebhooks(event, userID)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(Envelope{Event: event, OccurredAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+	var publicBody []byte
+	if public != nil {
+		if publicBody, err = json.Marshal(Envelope{Event: event, OccurredAt: now, Data: public}); err != nil {
+			return err
+		}
+	}
+
+	for _, hook := range hooks {
+		payload := body
+		if hook.UserID != userID {
+			if publicBody == nil {
+				continue
+			}
+			payload = publicBody
+		}
+		if err := d.store.CreateDelivery(&model.Delivery{WebhookID: hook.ID, Event: event, Payload: string(payload)}); err != nil {
+			return err
+		}
+	}
+
+	d.notify()
+	return nil
+}
+
+// Replay queues a fresh copy of an earlier delivery
+func (d *Dispatcher) Replay(original *model.Delivery) (*model.Delivery, error) {
+	replay := &model.Delivery{
+		WebhookID: original.WebhookID,
+		Event:     original.Event,
+		Payload:   original.Payload,
+		ReplayOf:  &original.ID,
+	}
+	if err := d.store.CreateDelivery(replay); err != nil {
+		return nil, err
+	}
+
+	d.notify()
+	return replay, nil
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.sendDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := d.store.DueDeliveries(time.Now(), batchSize)
+		if err != nil {
+			slog.Error("Error reading webhook deliveries", "err", err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+
+		for i := range due {
+			d.attempt(ctx, &due[i])
+		}
+	}
+}
+
+// Try to send a delivery once and record the outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery *model.Delivery) {
+	delivery.Attempts++
+
+	// A webhook that can't be read counts as a failed attempt, so the
+	// delivery isn't due again straight away
+	hook, err := d.store.GetWebhookByID(delivery.WebhookID)
+	if err != nil {
+		slog.Error("Error reading webhook", "webhook_id", delivery.WebhookID, "err", err)
+		delivery.LastCode = 0
+		err = fmt.Errorf("reading webhook: %w", err)
+	} else {
+		delivery.LastCode, err = d.post(ctx, hook, delivery)
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = model.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(baseBackoff << (delivery.Attempts - 1))
+	}
+
+	if err := d.store.RecordAttempt(delivery); err != nil {
+		slog.Error("Error recording webhook delivery", "delivery_id", delivery.ID, "err", err)
+	}
+}
+
+// POST a delivery, returning the response status. Anything but a 2xx is an
+// error.
+func (d *Dispatcher) post(ctx context.Context, hook *model.Webhook, delivery *model.Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MunroMark-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
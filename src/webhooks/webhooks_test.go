@@ -0,0 +1,353 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexM141200/munros-api/src/model"
+	"github.com/AlexM141200/munros-api/src/store"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("secret", 1700000000, []byte(`{"event":"ascent.logged"}`))
+	want := "sha256=48ee9ad3c65979da3feac5c17df95578681a76e0835d4b473e502bd45e980e00"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://203.0.113.10/hook", true},
+		{"https://[2001:4860:4860::8888]/hook", true},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[fe80::1]/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://172.16.1.1/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://[fd00::1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://[::]/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckURL(context.Background(), u)
+			if tt.allowed && err != nil {
+				t.Errorf("CheckURL = %v, want allowed", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbiddenAddress) {
+				t.Errorf("CheckURL = %v, want ErrForbiddenAddress", err)
+			}
+		})
+	}
+}
+
+// An endpoint recording the deliveries it receives and answering each with
+// the next of its statuses, then 200s
+type endpoint struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   [][]byte
+}
+
+func newEndpoint(t *testing.T, statuses ...int) *endpoint {
+	e := &endpoint{statuses: statuses}
+	e.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.received = append(e.received, r)
+		e.bodies = append(e.bodies, body)
+		status := http.StatusOK
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(e.server.Close)
+	return e
+}
+
+// The requests received so far and their bodies
+func (e *endpoint) deliveries() ([]*http.Request, [][]byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*http.Request(nil), e.received...), append([][]byte(nil), e.bodies...)
+}
+
+// A dispatcher and a webhook subscribed to ascents, sending to e. The
+// dispatcher uses the test server's client, as the endpoint is local.
+func newTestDispatcher(t *testing.T, e *endpoint) (*Dispatcher, *model.Webhook) {
+	t.Helper()
+
+	s, err := store.Open(filepath.Join(t.TempDir(), "munro.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	user := &model.User{Email: "walker@example.com", DisplayName: "Walker"}
+	if err := s.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	hook := &model.Webhook{UserID: user.ID, URL: e.server.URL + "/hook", Events: []string{EventAscentLogged}, Secret: "secret"}
+	if err := s.CreateWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDispatcher(s)
+	d.client = e.server.Client()
+	return d, hook
+}
+
+func deliveries(t *testing.T, d *Dispatcher, hook *model.Webhook) []model.Delivery {
+	t.Helper()
+	list, err := d.store.ListDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestDeliverySigned(t *testing.T) {
+	e := newEndpoint(t)
+	d, hook := newTestDispatcher(t, e)
+
+	if err := d.Publish(EventAscentLogged, hook.UserID, map[string]int{"munro_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	d.sendDue(context.Background())
+
+	received, bodies := e.deliveries()
+	if len(received) != 1 {
+		t.Fatalf("endpoint received %d deliveries, want 1", len(received))
+	}
+	r, body := received[0], bodies[0]
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp header: %v", err)
+	}
+	if got, want := r.Header.Get(HeaderSignature), Sign(hook.Secret, timestamp, body); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+	if got := r.Header.Get(HeaderEvent); got != EventAscentLogged {
+		t.Errorf("event header = %q", got)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Event != EventAscentLogged {
+		t.Errorf("body = %s (%v)", body, err)
+	}
+
+	list := deliveries(t, d, hook)
+	if len(list) != 1 || list[0].Status != model.DeliverySucceeded || list[0].LastCode != http.StatusOK || list[0].DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want succeeded", list)
+	}
+	if got := r.Header.Get(HeaderDelivery); got != strconv.FormatInt(list[0].ID, 10) {
+		t.Errorf("delivery header = %q, want %d", got, list[0].ID)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	failures := make([]int, MaxAttempts)
+	for i := range failures {
+		failures[i] = http.StatusInternalServerError
+	}
+	e := newEndpoint(t, failures...)
+	d, hook := newTestDispatcher(t, e)
+
+	if err := d.Publish(EventAscentLogged, hook.UserID, map[string]int{"munro_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		delivery := deliveries(t, d, hook)[0]
+		before := time.Now()
+		d.attempt(context.Background(), &delivery)
+
+		delivery = deliveries(t, d, hook)[0]
+		if delivery.Attempts != attempt || delivery.LastCode != http.StatusInternalServerError || delivery.LastError == "" {
+			t.Fatalf("after attempt %d: %+v", attempt, delivery)
+		}
+		if attempt == MaxAttempts {
+			if delivery.Status != model.DeliveryFailed {
+				t.Errorf("after %d attempts status is %q, want %q", attempt, delivery.Status, model.DeliveryFailed)
+			}
+			break
+		}
+
+		if delivery.Status != model.DeliveryPending {
+			t.Fatalf("after attempt %d status is %q, want %q", attempt, delivery.Status, model.DeliveryPending)
+		}
+		// 30s, then doubling
+		wait := baseBackoff << (attempt - 1)
+		if delivery.NextAttemptAt.Before(before.Add(wait).Truncate(time.Second)) || delivery.NextAttemptAt.After(time.Now().Add(wait)) {
+			t.Errorf("after attempt %d next attempt is in %v, want %v", attempt, delivery.NextAttemptAt.Sub(before), wait)
+		}
+		// Not due again until then
+		if due, err := d.store.DueDeliveries(time.Now(), batchSize); err != nil || len(due) != 0 {
+			t.Errorf("after attempt %d due deliveries are %v (%v), want none", attempt, due, err)
+		}
+	}
+
+	if received, _ := e.deliveries(); len(received) != MaxAttempts {
+		t.Errorf("endpoint received %d deliveries, want %d", len(received), MaxAttempts)
+	}
+}
+
+// Other people's webhooks, such as an admin's, get the public version of an
+// event, or none
+func TestPublishVisible(t *testing.T) {
+	e := newEndpoint(t)
+	d, hook := newTestDispatcher(t, e)
+
+	admin := &model.User{Email: "admin@example.com", DisplayName: "Admin", Role: model.RoleAdmin}
+	if err := d.store.CreateUser(admin); err != nil {
+		t.Fatal(err)
+	}
+	adminHook := &model.Webhook{UserID: admin.ID, URL: e.server.URL + "/admin", Events: []string{EventAscentLogged}, Secret: "secret"}
+	if err := d.store.CreateWebhook(adminHook); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.PublishVisible(EventAscentLogged, hook.UserID, "everything", "public part"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PublishVisible(EventAscentLogged, hook.UserID, "private only", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := func(h *model.Webhook) []string {
+		var data []string
+		for _, delivery := range deliveries(t, d, h) {
+			var envelope Envelope
+			if err := json.Unmarshal([]byte(delivery.Payload), &envelope); err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, envelope.Data.(string))
+		}
+		return data
+	}
+	// Newest first
+	if got := payloads(hook); len(got) != 2 || got[0] != "private only" || got[1] != "everything" {
+		t.Errorf("owner's webhook received %q, want everything", got)
+	}
+	if got := payloads(adminHook); len(got) != 1 || got[0] != "public part" {
+		t.Errorf("admin's webhook received %q, want only the public part", got)
+	}
+}
+
+// A delivery whose webhook can't be read backs off like any failure, rather
+// than staying due
+func TestAttemptUnreadableWebhook(t *testing.T) {
+	e := newEndpoint(t)
+	d, hook := newTestDispatcher(t, e)
+
+	if err := d.Publish(EventAscentLogged, hook.UserID, map[string]int{"munro_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	delivery := deliveries(t, d, hook)[0]
+	delivery.WebhookID = hook.ID + 100
+	d.attempt(context.Background(), &delivery)
+
+	stored := deliveries(t, d, hook)[0]
+	if stored.Attempts != 1 || stored.Status != model.DeliveryPending || stored.LastError == "" {
+		t.Errorf("delivery = %+v, want a failed attempt", stored)
+	}
+	if due, err := d.store.DueDeliveries(time.Now(), batchSize); err != nil || len(due) != 0 {
+		t.Errorf("due deliveries are %v (%v), want none until the backoff ends", due, err)
+	}
+	if received, _ := e.deliveries(); len(received) != 0 {
+		t.Errorf("endpoint received %d deliveries, want none", len(received))
+	}
+}
+
+func TestReplay(t *testing.T) {
+	e := newEndpoint(t)
+	d, hook := newTestDispatcher(t, e)
+
+	if err := d.Publish(EventAscentLogged, hook.UserID, map[string]int{"munro_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	d.sendDue(context.Background())
+	original := deliveries(t, d, hook)[0]
+
+	replay, err := d.Replay(&original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ID == original.ID || replay.ReplayOf == nil || *replay.ReplayOf != original.ID {
+		t.Errorf("replay = %+v, want a new delivery of %d", replay, original.ID)
+	}
+	d.sendDue(context.Background())
+
+	received, bodies := e.deliveries()
+	if len(received) != 2 {
+		t.Fatalf("endpoint received %d deliveries, want 2", len(received))
+	}
+	if string(bodies[1]) != string(bodies[0]) {
+		t.Errorf("replayed body %s, want %s", bodies[1], bodies[0])
+	}
+	if got := received[1].Header.Get(HeaderDelivery); got != strconv.FormatInt(replay.ID, 10) {
+		t.Errorf("replay delivery header = %q, want %d", got, replay.ID)
+	}
+	stored, err := d.store.GetDelivery(hook.UserID, hook.ID, replay.ID)
+	if err != nil || stored.Status != model.DeliverySucceeded {
+		t.Errorf("replay = %+v (%v), want succeeded", stored, err)
+	}
+}
+
+// The dispatcher's own client refuses to connect to local addresses,
+// whatever the URL was when the webhook was registered
+func TestDeliveryRefusesLocalAddress(t *testing.T) {
+	e := newEndpoint(t)
+	d, hook := newTestDispatcher(t, e)
+	d.client = NewDispatcher(d.store).client
+
+	if err := d.Publish(EventAscentLogged, hook.UserID, map[string]int{"munro_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	d.sendDue(context.Background())
+
+	if received, _ := e.deliveries(); len(received) != 0 {
+		t.Errorf("endpoint received %d deliveries, want none", len(received))
+	}
+	delivery := deliveries(t, d, hook)[0]
+	if delivery.Attempts != 1 || delivery.Status != model.DeliveryPending || delivery.LastError == "" {
+		t.Errorf("delivery = %+v, want a failed attempt", delivery)
+	}
+
+	if err := checkDial("tcp", netip.MustParseAddrPort("[::1]:80").String(), nil); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("checkDial(::1) = %v, want ErrForbiddenAddress", err)
+	}
+	if err := checkDial("tcp", "203.0.113.10:443", nil); err != nil {
+		t.Errorf("checkDial(203.0.113.10) = %v, want nil", err)
+	}
+}